@@ -22,6 +22,32 @@ func SendAccept(senderActor *actor.Actor, recevierActorID string, followActiveOb
 	// append to the sender's outbox
 	// senderActor.AppendOutboxObject(acceptActive["id"].(string))
 
+	// 本站的 actor 直接更新追蹤狀態，不需要透過 HTTP 送到自己的 inbox
+	if receiver, err := actor.FindActorByFullID(recevierActorID); err == nil {
+		acceptLocalFollow(receiver, senderActor.GetFullID())
+		return
+	}
+
 	SendActivity(senderActor.GetUsername(), recevierActorID, acceptActive)
 
 }
+
+// SendReject 會拒絕 recevierActorID 送來的 Follow，用法和 SendAccept 相同
+// https://www.w3.org/TR/activitypub/#reject-activity-inbox
+func SendReject(senderActor *actor.Actor, recevierActorID string, followActiveObjectID string) {
+	slog.Info("SendReject", "sender", senderActor.GetUsername(), "receiver", recevierActorID, "object", followActiveObjectID)
+
+	rejectActive := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Reject",
+		"actor":    senderActor.GetFullID(),
+		"object":   followActiveObjectID,
+	}
+
+	if receiver, err := actor.FindActorByFullID(recevierActorID); err == nil {
+		rejectLocalFollow(receiver, senderActor.GetFullID())
+		return
+	}
+
+	SendActivity(senderActor.GetUsername(), recevierActorID, rejectActive)
+}
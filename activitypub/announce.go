@@ -0,0 +1,268 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#announce-activity-outbox
+// 以及 https://www.w3.org/TR/activitypub/#announce-activity-inbox
+
+// SendAnnounce 會由 senderActor 轉推 objectID，Announce 會放進 senderActor 的 outbox，
+// 並送給 senderActor 的 followers 以及 object 的作者。
+func SendAnnounce(senderActor *actor.Actor, objectID string) error {
+	slog.Info("SendAnnounce", "sender", senderActor.GetUsername(), "object", objectID)
+
+	objectID, authorID, err := findObjectAuthor(senderActor, objectID)
+	if err != nil {
+		return err
+	}
+
+	// followers 限定和私訊的 object 不能轉推
+	if o, err := GetObject(objectID, senderActor.GetUsername()); err != nil {
+		return err
+	} else if v := objectVisibility(o); v != VisibilityPublic && v != VisibilityUnlisted {
+		return errors.New("object cannot be announced")
+	}
+
+	// 已經轉推過的話就不需要再送一次
+	if _, ok := senderActor.GetAnnounceActivityID(objectID); ok {
+		return nil
+	}
+
+	announce := object.NewAnnounce(senderActor.GetFullID(), objectID)
+	announce.AddTo("https://www.w3.org/ns/activitystreams#Public")
+	announce.AddCC(senderActor.GetFullID() + "/followers")
+	announce.AddCC(authorID)
+
+	senderActor.SetAnnounceActivityID(objectID, announce.GetFullID())
+	senderActor.AppendOutboxObject(announce.GetFullID())
+
+	if o, err := object.FindObjectByID(objectID); err == nil {
+		o.AddShare(senderActor.GetFullID(), announce.GetFullID())
+	}
+
+	SendActivityToActors(senderActor.GetUsername(), announceTargets(senderActor, authorID), newAnnounceActivity(announce))
+	return object.SaveObject("./object.json")
+}
+
+// SendUndoAnnounce 會取消 senderActor 對 objectID 的轉推，並送出 Undo{Announce} 給當初收到 Announce 的人。
+func SendUndoAnnounce(senderActor *actor.Actor, objectID string) error {
+	slog.Info("SendUndoAnnounce", "sender", senderActor.GetUsername(), "object", objectID)
+
+	localObject, err := object.FindObjectByID(objectID)
+	if err == nil {
+		objectID = localObject.GetFullID()
+	}
+
+	announceID, ok := senderActor.GetAnnounceActivityID(objectID)
+	if !ok {
+		return errors.New("object not announced")
+	}
+	senderActor.RemoveAnnounceActivityID(objectID)
+	senderActor.RemoveOutboxObject(announceID)
+
+	if localObject != nil {
+		localObject.RemoveShare(senderActor.GetFullID())
+	}
+
+	announce, err := object.FindObjectByID(announceID)
+	if err != nil {
+		// 找不到當初的 Announce 的話，就沒辦法知道要送給誰了
+		slog.Warn("SendUndoAnnounce", "error", "announce not found", "announce", announceID)
+		return object.SaveObject("./object.json")
+	}
+	object.RemoveObject(announceID)
+
+	authorID := ""
+	for _, cc := range announce.GetCC() {
+		if cc != senderActor.GetFullID()+"/followers" {
+			authorID = cc
+		}
+	}
+
+	undoActivity := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       announceID + "/undo",
+		"type":     "Undo",
+		"actor":    senderActor.GetFullID(),
+		"to":       announce.GetTo(),
+		"cc":       announce.GetCC(),
+		"object":   newAnnounceActivity(announce),
+	}
+
+	SendActivityToActors(senderActor.GetUsername(), announceTargets(senderActor, authorID), undoActivity)
+	return object.SaveObject("./object.json")
+}
+
+// newAnnounceActivity 會把存起來的 Announce 轉成要送出的 activity
+func newAnnounceActivity(announce *object.Object) map[string]interface{} {
+	return map[string]interface{}{
+		"@context":  "https://www.w3.org/ns/activitystreams",
+		"id":        announce.GetFullID(),
+		"type":      "Announce",
+		"actor":     announce.GetActor(),
+		"object":    announce.GetObject(),
+		"published": announce.GetPublished(),
+		"to":        announce.GetTo(),
+		"cc":        announce.GetCC(),
+	}
+}
+
+// announceTargets 會回傳 Announce 要送給的 actor，也就是 followers 和 object 的作者
+func announceTargets(senderActor *actor.Actor, authorID string) []string {
+	targets := map[string]bool{}
+	for _, followerID := range senderActor.GetFollowerIDs() {
+		targets[followerID] = true
+	}
+	// 本站的作者已經直接記錄在 object 上了
+	if authorID != "" {
+		if _, err := actor.FindActorByFullID(authorID); err != nil {
+			targets[authorID] = true
+		}
+	}
+	delete(targets, senderActor.GetFullID())
+
+	list := []string{}
+	for id := range targets {
+		list = append(list, id)
+	}
+	return list
+}
+
+// PostInboxAnnounce 會處理送進 inbox 的 Announce，
+// 被轉推的 object 會放進有追蹤轉推者的本站使用者的 inbox，如果是本站的 object 則記錄轉推。
+func PostInboxAnnounce(w http.ResponseWriter, r *http.Request, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxAnnounce", "info", "announce", "requestMap.object", getIDFromField(requestMap["object"]))
+
+	actorID := getIDFromField(requestMap["actor"])
+	objectID := getIDFromField(requestMap["object"])
+	announceID, _ := requestMap["id"].(string)
+	if objectID == "" || announceID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad request"})
+		return
+	}
+
+	// 內嵌的 object 已經在 CheckActivityOrigin 中確認過來源，可以直接使用作者的資料
+	authorID := ""
+	if o, ok := requestMap["object"].(map[string]interface{}); ok {
+		authorID = getIDFromField(o["attributedTo"])
+		storeRemoteObject(o)
+		if _, err := object.FindObjectByID(objectID); err != nil {
+			IndexHashtags(objectID, o["tag"])
+		}
+	}
+
+	if o, err := object.FindObjectByID(objectID); err == nil {
+		o.AddShare(actorID, announceID)
+		objectID = o.GetFullID()
+		err = object.SaveObject("./object.json")
+		if err != nil {
+			slog.Warn("activitypub.PostInboxAnnounce", "error", "object save error", "err", err)
+		}
+	}
+
+	actor.RangeActors(func(a *actor.Actor) bool {
+		if !isFollowing(a, actorID) || a.HasInboxObject(objectID) {
+			return true
+		}
+		a.AppendInboxObject(objectID)
+		a.SetInboxAnnounce(announceID, objectID)
+		if authorID != "" {
+			a.SetInboxObjectAuthor(objectID, authorID)
+		}
+		return true
+	})
+
+	err := remoteobject.SaveRemoteObject("./remote_object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxAnnounce", "error", "remote object save error", "err", err)
+	}
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxAnnounce", "error", "actor save error", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// undoAnnounce 會移除 announcerID 的轉推，包括本站 object 上的紀錄以及因此加入 inbox 的 object。
+// announce 可能是內嵌的 Announce activity，或是 Announce activity 的 ID。
+func undoAnnounce(announcerID string, announce interface{}) error {
+	announceID := ""
+	switch an := announce.(type) {
+	case map[string]interface{}:
+		// 只能取消自己送出的 Announce
+		if getIDFromField(an["actor"]) != announcerID {
+			return errors.New("announce actor does not match undo actor")
+		}
+		announceID = getIDFromField(an)
+	case string:
+		announceID = an
+	default:
+		return errors.New("object type error")
+	}
+	if announceID == "" {
+		return errors.New("announce id not found")
+	}
+
+	found := false
+	object.RangeObjects(func(o *object.Object) bool {
+		if id, ok := o.FindShareByActivityID(announceID); ok && id == announcerID {
+			o.RemoveShare(announcerID)
+			found = true
+			return false
+		}
+		return true
+	})
+
+	actor.RangeActors(func(a *actor.Actor) bool {
+		if objectID, ok := a.RemoveInboxAnnounce(announceID); ok {
+			a.RemoveInboxObject(objectID)
+			found = true
+		}
+		return true
+	})
+
+	if !found {
+		return errors.New("announce activity not found")
+	}
+
+	slog.Info("activitypub.undoAnnounce", "announce", announceID, "actor", announcerID)
+	err := object.SaveObject("./object.json")
+	if err != nil {
+		return err
+	}
+	return actor.SaveActor("./actor.json")
+}
+
+// isFollowing 會回傳 a 是否正在追蹤 actorID
+func isFollowing(a *actor.Actor, actorID string) bool {
+	for _, id := range a.GetFollowingIDs() {
+		if id == actorID {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteObjectShares 會回傳轉推 object 的 actor 清單
+// 舉例來說會像是 GET /.activitypub/object/{object}/shares
+func RouteObjectShares(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteObjectShares", "request", r.URL.String())
+
+	o, err := findVisibleObject(r.PathValue("object"), requestViewer(r))
+	if err != nil {
+		writeObjectError(w, err)
+		return
+	}
+
+	writeIDCollection(w, r, o.GetFullID()+"/shares", o.GetShares(), false)
+}
@@ -0,0 +1,75 @@
+package activitypub
+
+// 相關文件請參閱: https://www.w3.org/TR/activitystreams-vocabulary/#dfn-attachment
+
+// attachmentFields 是其他站的 attachment 中會保留下來的欄位
+var attachmentFields = []string{"type", "mediaType", "name", "width", "height", "blurhash", "focalPoint"}
+
+// normalizeAttachments 會把 o 的 attachment 整理成陣列，直接修改 o，
+// 每個項目的 url 會整理成 http 或 https 的網址字串，沒有合法網址的項目會被拿掉。
+// 個人資料欄位 (PropertyValue) 沒有 url，會原封不動保留。
+func normalizeAttachments(o map[string]interface{}) {
+	var list []interface{}
+	switch v := o["attachment"].(type) {
+	case nil:
+		return
+	case []interface{}:
+		list = v
+	case map[string]interface{}:
+		list = []interface{}{v}
+	default:
+		delete(o, "attachment")
+		return
+	}
+
+	attachments := []interface{}{}
+	for _, v := range list {
+		a, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if a["type"] == "PropertyValue" {
+			attachments = append(attachments, a)
+			continue
+		}
+
+		href, mediaType := attachmentURL(a["url"])
+		if href == "" {
+			continue
+		}
+		m := map[string]interface{}{"url": href}
+		for _, field := range attachmentFields {
+			if v, ok := a[field]; ok {
+				m[field] = v
+			}
+		}
+		if _, ok := m["mediaType"]; !ok && mediaType != "" {
+			m["mediaType"] = mediaType
+		}
+		if _, ok := m["type"]; !ok {
+			m["type"] = "Document"
+		}
+		attachments = append(attachments, m)
+	}
+	o["attachment"] = attachments
+}
+
+// attachmentURL 會從 url 欄位中取出網址，url 可能是字串、Link 物件或是陣列，
+// 是 Link 的話會一併回傳它的 mediaType。
+func attachmentURL(v interface{}) (string, string) {
+	switch u := v.(type) {
+	case string:
+		return sanitizeURL(u), ""
+	case map[string]interface{}:
+		href, _ := u["href"].(string)
+		mediaType, _ := u["mediaType"].(string)
+		return sanitizeURL(href), mediaType
+	case []interface{}:
+		for _, i := range u {
+			if href, mediaType := attachmentURL(i); href != "" {
+				return href, mediaType
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,194 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#followers
+// 以及 https://www.w3.org/TR/activitypub/#following
+
+// 每一頁 followers/following 的數量
+const actorCollectionPageSize = 40
+
+// 這邊會接收所有 /.activitypub/actor/{actor}/followers 的請求
+func RouteActorFollowers(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteActorFollowers", "request", r.URL.String())
+
+	username := r.PathValue("actor")
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "actor not found"})
+		return
+	}
+
+	id := "https://" + config.GetDomain() + "/.activitypub/actor/" + a.GetUsername() + "/followers"
+	writeIDCollection(w, r, id, a.GetFollowerIDs(), a.GetHideFollowers())
+}
+
+// 這邊會接收所有 /.activitypub/actor/{actor}/following 的請求
+func RouteActorFollowing(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteActorFollowing", "request", r.URL.String())
+
+	username := r.PathValue("actor")
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "actor not found"})
+		return
+	}
+
+	id := "https://" + config.GetDomain() + "/.activitypub/actor/" + a.GetUsername() + "/following"
+	writeIDCollection(w, r, id, a.GetFollowingIDs(), a.GetHideFollowing())
+}
+
+// writeIDCollection 會把 ID 的清單以 OrderedCollection 回傳，
+// 有 page 參數的話回傳該頁的 OrderedCollectionPage，最新加入的會排在最前面。
+// hidden 為 true 時 (使用者不公開清單) 只會回傳 totalItems，和 Mastodon 的行為相同。
+func writeIDCollection(w http.ResponseWriter, r *http.Request, id string, ids []string, hidden bool) {
+	w.Header().Set("Content-Type", "application/activity+json")
+	m := map[string]interface{}{}
+
+	c := []interface{}{}
+	c = append(c, "https://www.w3.org/ns/activitystreams")
+	m["@context"] = c
+
+	// 這邊是在 ActivityPub 中的必要 (MUST) 欄位
+	m["id"] = id
+	m["type"] = "OrderedCollection"
+	m["totalItems"] = len(ids)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if hidden || err != nil || page < 1 {
+		if !hidden && len(ids) > 0 {
+			m["first"] = id + "?page=1"
+		}
+		json.NewEncoder(w).Encode(m)
+		return
+	}
+
+	// 新的在前面
+	reversed := make([]string, len(ids))
+	for i, v := range ids {
+		reversed[len(ids)-1-i] = v
+	}
+
+	start := (page - 1) * actorCollectionPageSize
+	end := start + actorCollectionPageSize
+	if start > len(reversed) {
+		start = len(reversed)
+	}
+	if end > len(reversed) {
+		end = len(reversed)
+	}
+
+	m["id"] = id + "?page=" + strconv.Itoa(page)
+	m["type"] = "OrderedCollectionPage"
+	m["partOf"] = id
+	m["orderedItems"] = reversed[start:end]
+	if end < len(reversed) {
+		m["next"] = id + "?page=" + strconv.Itoa(page+1)
+	}
+	if page > 1 {
+		m["prev"] = id + "?page=" + strconv.Itoa(page-1)
+	}
+
+	json.NewEncoder(w).Encode(m)
+}
+
+// paginateIDs 會依照 max_id 或 min_id 從 ids 中取出一頁，ids 必須是由舊到新排列，
+// 回傳的 items 則是由新到舊，hasOlder 和 hasNewer 表示這一頁之外是否還有更舊或更新的項目。
+//
+// 和 Mastodon 相同，max_id 會取得比游標更舊的項目，min_id 則是取得緊接在游標之後較新的項目，
+// 游標是 key 所回傳的值，必須和 ids 的順序一樣由小到大 (例如本站 object 的 UUIDv7 或是 seqCursor)，
+// 這樣即使游標指向的項目已被刪除，仍然可以用字串大小判斷先後。
+func paginateIDs(ids []string, key func(string) string, maxID, minID string, size int) (items []string, hasOlder, hasNewer bool) {
+	start, end := 0, len(ids)
+	if maxID != "" {
+		end = cursorIndex(ids, key, maxID)
+		start = max(0, end-size)
+	} else if minID != "" {
+		start = cursorIndex(ids, key, minID)
+		if start < len(ids) && key(ids[start]) == minID {
+			start++
+		}
+		end = min(len(ids), start+size)
+	} else {
+		start = max(0, end-size)
+	}
+
+	items = make([]string, 0, end-start)
+	for i := end - 1; i >= start; i-- {
+		items = append(items, ids[i])
+	}
+	return items, start > 0, end < len(ids)
+}
+
+// cursorIndex 回傳游標在 ids 中的位置，找不到的話回傳第一個 key 大於游標的位置
+func cursorIndex(ids []string, key func(string) string, cursor string) int {
+	for i, id := range ids {
+		if key(id) == cursor {
+			return i
+		}
+	}
+	for i, id := range ids {
+		if key(id) > cursor {
+			return i
+		}
+	}
+	return len(ids)
+}
+
+// writePageLinks 會在 OrderedCollectionPage 加上 id、partOf、next 和 prev，
+// next 指向更舊的一頁，prev 指向更新的一頁。
+func writePageLinks(m map[string]interface{}, r *http.Request, collectionID string, items []string, key func(string) string, hasOlder, hasNewer bool) {
+	q := url.Values{}
+	q.Set("page", "true")
+	if v := r.URL.Query().Get("max_id"); v != "" {
+		q.Set("max_id", v)
+	} else if v := r.URL.Query().Get("min_id"); v != "" {
+		q.Set("min_id", v)
+	}
+
+	m["id"] = collectionID + "?" + q.Encode()
+	m["type"] = "OrderedCollectionPage"
+	m["partOf"] = collectionID
+
+	if len(items) == 0 {
+		return
+	}
+	if hasOlder {
+		q := url.Values{}
+		q.Set("page", "true")
+		q.Set("max_id", key(items[len(items)-1]))
+		m["next"] = collectionID + "?" + q.Encode()
+	}
+	if hasNewer {
+		q := url.Values{}
+		q.Set("page", "true")
+		q.Set("min_id", key(items[0]))
+		m["prev"] = collectionID + "?" + q.Encode()
+	}
+}
+
+// seqCursor 會把序號轉成固定長度的游標，這樣用字串比較的結果才會和數字的大小相同
+func seqCursor(seq int64) string {
+	return fmt.Sprintf("%019d", seq)
+}
+
+// objectCursor 會把 object 的 ID 轉成游標，本站的 object 取最後的 UUIDv7 部分
+func objectCursor(id string) string {
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		return id[i+1:]
+	}
+	return id
+}
@@ -0,0 +1,125 @@
+package activitypub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPaginateIDs(t *testing.T) {
+	type TestCase struct {
+		name     string
+		ids      []string
+		maxID    string
+		minID    string
+		size     int
+		items    []string
+		hasOlder bool
+		hasNewer bool
+	}
+
+	// 游標使用序號，和收件匣一樣每個項目有一個遞增的序號
+	ids := []string{"a", "b", "c", "d", "e"}
+	seqs := map[string]int64{"a": 1, "b": 2, "c": 3, "d": 5, "e": 8}
+	key := func(id string) string {
+		return seqCursor(seqs[id])
+	}
+
+	testCases := []TestCase{
+		{
+			name:     "first page",
+			ids:      ids,
+			size:     2,
+			items:    []string{"e", "d"},
+			hasOlder: true,
+		},
+		{
+			name:     "everything fits",
+			ids:      ids,
+			size:     10,
+			items:    []string{"e", "d", "c", "b", "a"},
+			hasOlder: false,
+		},
+		{
+			name:     "older than max_id",
+			ids:      ids,
+			maxID:    seqCursor(5),
+			size:     2,
+			items:    []string{"c", "b"},
+			hasOlder: true,
+			hasNewer: true,
+		},
+		{
+			name:     "last page",
+			ids:      ids,
+			maxID:    seqCursor(2),
+			size:     2,
+			items:    []string{"a"},
+			hasNewer: true,
+		},
+		{
+			name:     "max_id of a removed item",
+			ids:      ids,
+			maxID:    seqCursor(4),
+			size:     2,
+			items:    []string{"c", "b"},
+			hasOlder: true,
+			hasNewer: true,
+		},
+		{
+			name:     "newer than min_id",
+			ids:      ids,
+			minID:    seqCursor(1),
+			size:     2,
+			items:    []string{"c", "b"},
+			hasOlder: true,
+			hasNewer: true,
+		},
+		{
+			name:     "min_id of a removed item",
+			ids:      ids,
+			minID:    seqCursor(6),
+			size:     2,
+			items:    []string{"e"},
+			hasOlder: true,
+		},
+		{
+			name:     "min_id zero starts from the oldest",
+			ids:      ids,
+			minID:    seqCursor(0),
+			size:     2,
+			items:    []string{"b", "a"},
+			hasNewer: true,
+		},
+		{
+			name:     "max_id older than everything",
+			ids:      ids,
+			maxID:    seqCursor(1),
+			size:     2,
+			items:    []string{},
+			hasNewer: true,
+		},
+		{
+			name:  "empty",
+			ids:   []string{},
+			size:  2,
+			items: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		items, hasOlder, hasNewer := paginateIDs(tc.ids, key, tc.maxID, tc.minID, tc.size)
+		if !reflect.DeepEqual(items, tc.items) || hasOlder != tc.hasOlder || hasNewer != tc.hasNewer {
+			t.Errorf("%s: paginateIDs() = %v, %v, %v, expected %v, %v, %v", tc.name, items, hasOlder, hasNewer, tc.items, tc.hasOlder, tc.hasNewer)
+		}
+	}
+}
+
+func TestSeqCursorOrder(t *testing.T) {
+	// 游標是用字串比較的，所以位數不同的序號也必須保持數字的大小順序
+	seqs := []int64{0, 1, 9, 10, 99, 100, 12345678901}
+	for i := 1; i < len(seqs); i++ {
+		if seqCursor(seqs[i-1]) >= seqCursor(seqs[i]) {
+			t.Errorf("seqCursor(%d) = %q is not less than seqCursor(%d) = %q", seqs[i-1], seqCursor(seqs[i-1]), seqs[i], seqCursor(seqs[i]))
+		}
+	}
+}
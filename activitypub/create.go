@@ -1,7 +1,6 @@
 package activitypub
 
 import (
-	"log"
 	"log/slog"
 
 	"github.com/pichuchen/hatsuaki/datastore/actor"
@@ -17,53 +16,47 @@ func SendCreate(senderActor *actor.Actor, object *object.Object) {
 		"actor":    senderActor.GetFullID(),
 		"object":   object,
 	}
-	receivers := map[string]bool{}
-
 	// 如果有任何 to, bto, cc, bcc, audience 的話，都要加進去
 	if to := object.GetTo(); len(to) > 0 {
 		createActivity["to"] = to
-		for _, to := range to {
-			receivers[to] = true
-		}
 	}
 
 	if bto := object.GetBto(); len(bto) > 0 {
 		createActivity["bto"] = bto
-		for _, bto := range bto {
-			receivers[bto] = true
-		}
 	}
 
 	if cc := object.GetCC(); len(cc) > 0 {
 		createActivity["cc"] = cc
-		for _, cc := range cc {
-			receivers[cc] = true
-		}
 	}
 
 	if bcc := object.GetBCC(); len(bcc) > 0 {
 		createActivity["bcc"] = bcc
-		for _, bcc := range bcc {
-			receivers[bcc] = true
-		}
 	}
 
 	if audience := object.GetAudience(); len(audience) > 0 {
 		createActivity["audience"] = audience
-		for _, audience := range audience {
-			receivers[audience] = true
-		}
 	}
 
 	createActivity["id"] = object.GetFullID() + "/activity"
 	createActivity["published"] = object.GetPublished()
 
-	followers := senderActor.GetFollowerIDs()
-	followerMap := map[string]bool{}
-	for _, followerID := range followers {
-		followerMap[followerID] = true
+	targetList := objectTargets(senderActor, object)
+	SendActivityToActors(senderActor.GetUsername(), targetList, createActivity)
+	slog.Info("SendCreate", "targets", len(targetList))
+}
+
+// objectTargets 會從 object 的 to, bto, cc, bcc, audience 整理出要送達的 actor，
+// followers collection 會展開成所有的 followers，之後會再依照 inbox 合併，
+// 這樣同一個伺服器上的多個 followers 只會收到一次。
+func objectTargets(senderActor *actor.Actor, object *object.Object) []string {
+	receivers := map[string]bool{}
+	for _, list := range [][]string{object.GetTo(), object.GetBto(), object.GetCC(), object.GetBCC(), object.GetAudience()} {
+		for _, id := range list {
+			receivers[id] = true
+		}
 	}
-	sendCnt := 0
+
+	targets := map[string]bool{}
 	for recevierActorID := range receivers {
 		if recevierActorID == senderActor.GetFullID() {
 			continue
@@ -71,22 +64,22 @@ func SendCreate(senderActor *actor.Actor, object *object.Object) {
 		if recevierActorID == object.GetAttributedTo() {
 			continue
 		}
-		if _, ok := followerMap[recevierActorID]; ok {
-			continue
-		}
 		if recevierActorID == "https://www.w3.org/ns/activitystreams#Public" {
 			continue
 		}
 		if recevierActorID == object.GetAttributedTo()+"/followers" {
 			// 轉傳給所有的 followers
-			for recevierActorID, _ := range followerMap {
-				go SendActivity(senderActor.GetUsername(), recevierActorID, createActivity)
-				sendCnt++
+			for _, followerID := range senderActor.GetFollowerIDs() {
+				targets[followerID] = true
 			}
 			continue
 		}
-		go SendActivity(senderActor.GetUsername(), recevierActorID, createActivity)
-		sendCnt++
+		targets[recevierActorID] = true
+	}
+
+	targetList := []string{}
+	for recevierActorID := range targets {
+		targetList = append(targetList, recevierActorID)
 	}
-	log.Println("SendCreate", "receivers", receivers, "sendCnt", sendCnt)
+	return targetList
 }
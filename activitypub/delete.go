@@ -0,0 +1,190 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#delete-activity-outbox
+// 以及 https://www.w3.org/TR/activitypub/#delete-activity-inbox
+
+// SendDelete 會把 senderActor 的 object 換成 Tombstone，
+// 並且送出 Delete 給當初收到這個 object 的人 (包括轉推過的人)。
+func SendDelete(senderActor *actor.Actor, o *object.Object) error {
+	slog.Info("SendDelete", "sender", senderActor.GetUsername(), "object", o.GetFullID())
+
+	if o.GetAttributedTo() != senderActor.GetFullID() {
+		return errors.New("object is not attributed to sender")
+	}
+	if o.IsTombstone() {
+		return errors.New("object already deleted")
+	}
+
+	// 換成 Tombstone 之後就沒有收件人的資料了，所以要先整理好
+	targets := objectRecipients(senderActor, o)
+	to, cc := o.GetTo(), o.GetCC()
+	removeReply(o.GetInReplyTo(), o.GetFullID())
+
+	o.Tombstone()
+	unindexHashtags(o.GetFullID())
+	senderActor.RemoveOutboxObject(o.GetFullID())
+	senderActor.RemoveOutboxObject(o.GetID())
+	actor.RangeActors(func(a *actor.Actor) bool {
+		a.RemoveInboxObject(o.GetFullID())
+		removeLocalReactions(a, o.GetFullID())
+		return true
+	})
+
+	deleteActivity := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       o.GetFullID() + "#delete",
+		"type":     "Delete",
+		"actor":    senderActor.GetFullID(),
+		"to":       to,
+		"cc":       cc,
+		"object":   newTombstone(o),
+	}
+
+	SendActivityToActors(senderActor.GetUsername(), targets, deleteActivity)
+
+	return object.SaveObject("./object.json")
+}
+
+// removeLocalReactions 會移除本站使用者 a 對 objectID 的按讚和轉推紀錄，
+// 轉推時建立的 Announce 也會從 outbox 和 object 中移除。
+func removeLocalReactions(a *actor.Actor, objectID string) {
+	a.RemoveLikedObject(objectID)
+
+	announceID, ok := a.GetAnnounceActivityID(objectID)
+	if !ok {
+		return
+	}
+	a.RemoveAnnounceActivityID(objectID)
+	a.RemoveOutboxObject(announceID)
+	object.RemoveObject(announceID)
+}
+
+// newTombstone 會回傳要對外顯示的 Tombstone
+func newTombstone(o *object.Object) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         o.GetFullID(),
+		"type":       "Tombstone",
+		"formerType": o.GetFormerType(),
+		"deleted":    o.GetDeleted(),
+	}
+}
+
+// PostInboxDelete 會處理送進 inbox 的 Delete，
+// 被刪除的如果是 object 則從本站使用者的 inbox 中移除，
+// 如果是 actor 本身，則移除和他有關的所有資料 (追蹤關係、按讚、轉推以及 inbox 中他的 object)。
+func PostInboxDelete(w http.ResponseWriter, r *http.Request, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxDelete", "info", "delete", "requestMap.object", getIDFromField(requestMap["object"]))
+
+	actorID := getIDFromField(requestMap["actor"])
+	objectID := getIDFromField(requestMap["object"])
+	if objectID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad request"})
+		return
+	}
+
+	// 只能刪除自己伺服器上的東西，本站的 object 則只能由本站刪除
+	if !isSameOrigin(objectID, actorID) || isSameOrigin(objectID, "https://"+config.GetDomain()+"/") {
+		slog.Warn("activitypub.PostInboxDelete", "error", "object origin not match", "object", objectID, "actor", actorID)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "forbidden"})
+		return
+	}
+
+	if objectID == actorID {
+		deleteRemoteActor(actorID)
+	} else {
+		deleteRemoteObject(actorID, objectID)
+	}
+
+	err := actor.SaveActor("./actor.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxDelete", "error", "actor save error", "err", err)
+	}
+	err = object.SaveObject("./object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxDelete", "error", "object save error", "err", err)
+	}
+	err = remoteobject.SaveRemoteObject("./remote_object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxDelete", "error", "remote object save error", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deleteRemoteObject 會把 actorID 所刪除的 objectID 從本站使用者的 inbox 中移除
+func deleteRemoteObject(actorID string, objectID string) {
+	actor.RangeActors(func(a *actor.Actor) bool {
+		if !a.HasInboxObject(objectID) {
+			return true
+		}
+		// 有記錄作者的話，只有作者本人可以刪除
+		if authorID, ok := a.GetInboxObjectAuthor(objectID); ok && authorID != actorID {
+			return true
+		}
+		slog.Info("activitypub.deleteRemoteObject", "actor", a.GetUsername(), "object", objectID)
+		a.RemoveInboxObject(objectID)
+		return true
+	})
+
+	if o, err := remoteobject.FindRemoteObjectByID(objectID); err == nil && o.GetAttributedTo() == actorID {
+		removeReply(o.GetInReplyTo(), objectID)
+		remoteobject.RemoveRemoteObject(objectID)
+	}
+	// 來源已經在 PostInboxDelete 中檢查過了
+	unindexHashtags(objectID)
+}
+
+// deleteRemoteActor 會移除本站中所有和 actorID 有關的資料
+func deleteRemoteActor(actorID string) {
+	slog.Info("activitypub.deleteRemoteActor", "actor", actorID)
+
+	actor.RangeActors(func(a *actor.Actor) bool {
+		a.RemoveFollowerID(actorID)
+		a.RemovePendingFollower(actorID)
+		a.RemoveFollowingID(actorID)
+		a.RemovePendingFollowing(actorID)
+		a.RemoveFollowingActivityID(actorID)
+
+		objects, _ := a.GetInboxObjects()
+		for _, id := range objects {
+			authorID, ok := a.GetInboxObjectAuthor(id)
+			// 比較舊的資料沒有記錄作者，只能從 ID 判斷 (例如 Mastodon 的 object 會在 actor ID 底下)
+			if (ok && authorID == actorID) || (!ok && strings.HasPrefix(id, actorID+"/")) {
+				a.RemoveInboxObject(id)
+			}
+		}
+		return true
+	})
+
+	object.RangeObjects(func(o *object.Object) bool {
+		o.RemoveLike(actorID)
+		o.RemoveShare(actorID)
+		return true
+	})
+
+	remoteobject.RangeRemoteObjects(func(o *remoteobject.RemoteObject) bool {
+		if o.GetAttributedTo() == actorID {
+			removeReply(o.GetInReplyTo(), o.GetID())
+			remoteobject.RemoveRemoteObject(o.GetID())
+			unindexHashtags(o.GetID())
+		}
+		return true
+	})
+
+	InvalidateRemoteActor(actorID)
+}
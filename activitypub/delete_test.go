@@ -0,0 +1,106 @@
+package activitypub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+)
+
+func TestPostInboxDelete(t *testing.T) {
+	type TestCase struct {
+		name       string
+		actor      string
+		object     interface{}
+		statusCode int
+		deleted    bool
+	}
+
+	const bob = "https://remote.example/users/bob"
+	const carol = "https://remote.example/users/carol"
+	bobNote := "https://remote.example/notes/bob"
+	carolNote := "https://remote.example/notes/carol"
+	otherNote := "https://other.example/notes/1"
+
+	testCases := []TestCase{
+		{
+			name:       "own object",
+			actor:      bob,
+			object:     bobNote,
+			statusCode: http.StatusAccepted,
+			deleted:    true,
+		},
+		{
+			name:       "own object as tombstone",
+			actor:      bob,
+			object:     map[string]interface{}{"id": bobNote, "type": "Tombstone"},
+			statusCode: http.StatusAccepted,
+			deleted:    true,
+		},
+		{
+			// 同一個伺服器上的其他人也不能刪除，但是不會讓對方知道
+			name:       "object of another actor on the same server",
+			actor:      bob,
+			object:     carolNote,
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:       "object on another server",
+			actor:      bob,
+			object:     otherNote,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "local object",
+			actor:      bob,
+			object:     "https://" + testDomain + "/.activitypub/object/1",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "missing object",
+			actor:      bob,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "missing actor",
+			object:     bobNote,
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, doc := range []map[string]interface{}{
+			{"id": bobNote, "type": "Note", "attributedTo": bob},
+			{"id": carolNote, "type": "Note", "attributedTo": carol},
+			{"id": otherNote, "type": "Note", "attributedTo": "https://other.example/users/dave"},
+		} {
+			if _, err := remoteobject.StoreRemoteObject(doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		requestMap := map[string]interface{}{"type": "Delete"}
+		if tc.actor != "" {
+			requestMap["actor"] = tc.actor
+		}
+		if tc.object != nil {
+			requestMap["object"] = tc.object
+		}
+		w := httptest.NewRecorder()
+		PostInboxDelete(w, httptest.NewRequest("POST", "/.activitypub/inbox", nil), requestMap)
+		if w.Code != tc.statusCode {
+			t.Errorf("%s: status code = %d, expected %d", tc.name, w.Code, tc.statusCode)
+		}
+
+		// 本站的 object 不會存在 remoteobject 中，不需要檢查
+		id := getIDFromField(tc.object)
+		if id == "" || isSameOrigin(id, "https://"+testDomain+"/") {
+			continue
+		}
+		_, err := remoteobject.FindRemoteObjectByID(id)
+		if deleted := err != nil; deleted != tc.deleted {
+			t.Errorf("%s: deleted = %v, expected %v", tc.name, deleted, tc.deleted)
+		}
+	}
+}
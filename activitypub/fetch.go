@@ -15,11 +15,18 @@ import (
 )
 
 func FetchObject(id string, actorUsername string, sign bool) (map[string]interface{}, error) {
+	m, _, err := fetchObject(id, actorUsername, sign)
+	return m, err
+}
+
+// fetchObject 和 FetchObject 相同，但是會另外回傳回應的 header，
+// 讓需要快取的地方可以讀取 Cache-Control。
+func fetchObject(id string, actorUsername string, sign bool) (map[string]interface{}, http.Header, error) {
 
 	reqURL := id
 	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	req.Header.Set("Accept", "application/activity+json, application/ld+json")
@@ -36,48 +43,57 @@ func FetchObject(id string, actorUsername string, sign bool) (map[string]interfa
 		a, err := actor.FindActorByUsername(actorUsername)
 		if err != nil {
 			slog.Error("FetchObject", "error", err)
-			return nil, err
+			return nil, nil, err
 		}
 		keyID := fmt.Sprintf("%s#main-key", a.GetFullID())
 		signature.Signature(a.GetPrivateKey(), keyID, req)
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		slog.Error("FetchObject", "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
+	// 開啟 authorized fetch 的伺服器會對沒有簽章的請求回傳 401，這時候加上簽章再試一次
+	if resp.StatusCode == http.StatusUnauthorized && !sign {
+		slog.Info("request not signed, retry with signature", "object", id)
+		return fetchObject(id, actorUsername, true)
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("status code: %d", resp.StatusCode)
 	}
 
 	respByte, err := io.ReadAll(resp.Body)
 	if err != nil {
 		slog.Error("Read response body failed", "Error", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	respMap := map[string]interface{}{}
 	err = json.Unmarshal(respByte, &respMap)
 	if err != nil {
 		slog.Error("Unmarshal response body failed", "Error", err, "body", string(respByte))
-		return nil, err
+		return nil, nil, err
 	}
 
 	slog.Info("fetch object success", "object", id, "Response", respMap)
 
 	errorStr, ok := respMap["error"]
 	if ok {
-		if strings.Contains(errorStr.(string), "Request not signed") {
+		if str, _ := errorStr.(string); strings.Contains(str, "Request not signed") && !sign {
 			slog.Info("request not signed, retry with signature")
-			return FetchObject(id, actorUsername, true)
+			return fetchObject(id, actorUsername, true)
 		}
 		slog.Error("fetch object failed", "object", id, "Error", errorStr)
-		return nil, errors.New("get actor failed")
+		return nil, nil, errors.New("get actor failed")
 	}
 
-	return respMap, nil
+	// 其他站的 HTML 不能直接相信，取得之後一律先清理過
+	sanitizeObject(respMap)
+
+	return respMap, resp.Header, nil
 }
@@ -0,0 +1,257 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#follow-activity-outbox
+
+// SendFollow 會由 senderActor 送出 Follow 給 recevierActorID，
+// 在對方回覆 Accept 之前，這個追蹤會先放在 senderActor 的等待清單中。
+func SendFollow(senderActor *actor.Actor, recevierActorID string) {
+	slog.Info("SendFollow", "sender", senderActor.GetUsername(), "receiver", recevierActorID)
+
+	followActivity := newFollowActivity(senderActor, recevierActorID, senderActor.GetFullID()+"/follow/"+object.GenerateUUIDv7())
+	senderActor.AppendPendingFollowing(recevierActorID, followActivity["id"].(string))
+
+	// 本站的 actor 不需要透過 HTTP 送到自己的 inbox，直接處理就好
+	if target, err := actor.FindActorByFullID(recevierActorID); err == nil {
+		followLocalActor(senderActor, target, followActivity["id"].(string))
+		return
+	}
+
+	SendActivity(senderActor.GetUsername(), recevierActorID, followActivity)
+}
+
+// followLocalActor 會處理本站 actor 之間的追蹤，規則和 PostActorInboxFollow 相同，
+// 需要手動核准的話放進 target 的待審核清單，不需要的話直接接受。
+func followLocalActor(senderActor *actor.Actor, target *actor.Actor, followID string) {
+	followerID := senderActor.GetFullID()
+	alreadyFollower := false
+	for _, id := range target.GetFollowerIDs() {
+		if id == followerID {
+			alreadyFollower = true
+			break
+		}
+	}
+
+	if target.GetManuallyApprovesFollowers() && !alreadyFollower {
+		target.AppendPendingFollower(followerID, followID)
+		return
+	}
+
+	target.AppendFollowerID(followerID)
+	target.SetFollowActivityID(followerID, followID)
+	acceptLocalFollow(senderActor, target.GetFullID())
+}
+
+// acceptLocalFollow 會把 follower 對本站 actor followingID 等待中的追蹤改成已追蹤，
+// 相當於收到 Accept 時 PostInboxAccept 所做的事。
+func acceptLocalFollow(follower *actor.Actor, followingID string) {
+	pending, ok := follower.RemovePendingFollowing(followingID)
+	if !ok {
+		return
+	}
+	follower.AppendFollowingID(followingID)
+	follower.SetFollowingActivityID(followingID, pending["id"])
+}
+
+// rejectLocalFollow 會取消 follower 對本站 actor followingID 的追蹤，相當於收到 Reject 時 PostInboxReject 所做的事。
+func rejectLocalFollow(follower *actor.Actor, followingID string) {
+	follower.RemovePendingFollowing(followingID)
+	follower.RemoveFollowingID(followingID)
+	follower.RemoveFollowingActivityID(followingID)
+}
+
+// SendUndoFollow 會由 senderActor 送出 Undo{Follow} 給 recevierActorID，
+// 不論對方是已經接受或是還在等待中的追蹤都會一起取消。
+func SendUndoFollow(senderActor *actor.Actor, recevierActorID string) {
+	slog.Info("SendUndoFollow", "sender", senderActor.GetUsername(), "receiver", recevierActorID)
+
+	// Undo 需要帶上當初送出的 Follow，找不到的話 (例如很久以前的資料) 就只能給一個新的 ID
+	followID, ok := senderActor.GetFollowingActivityID(recevierActorID)
+	if p, pending := senderActor.RemovePendingFollowing(recevierActorID); pending {
+		followID, ok = p["id"], true
+	}
+	if !ok {
+		followID = senderActor.GetFullID() + "/follow/" + object.GenerateUUIDv7()
+	}
+
+	senderActor.RemoveFollowingID(recevierActorID)
+	senderActor.RemoveFollowingActivityID(recevierActorID)
+
+	if target, err := actor.FindActorByFullID(recevierActorID); err == nil {
+		target.RemoveFollowerID(senderActor.GetFullID())
+		target.RemovePendingFollower(senderActor.GetFullID())
+		return
+	}
+
+	undoActivity := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       followID + "/undo",
+		"type":     "Undo",
+		"actor":    senderActor.GetFullID(),
+		"object":   newFollowActivity(senderActor, recevierActorID, followID),
+	}
+
+	SendActivity(senderActor.GetUsername(), recevierActorID, undoActivity)
+}
+
+func newFollowActivity(senderActor *actor.Actor, recevierActorID string, followID string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       followID,
+		"type":     "Follow",
+		"actor":    senderActor.GetFullID(),
+		"object":   recevierActorID,
+	}
+}
+
+// PostInboxAccept 會處理對方送來的 Accept{Follow}，把等待中的追蹤改成已追蹤，
+// localActor 是收到的 inbox 的擁有者，如果是 shared inbox 的話會是 nil。
+func PostInboxAccept(w http.ResponseWriter, r *http.Request, localActor *actor.Actor, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxAccept", "info", "accept", "requestMap.object", requestMap["object"])
+
+	remoteActorID := getIDFromField(requestMap["actor"])
+	a, pending, err := findPendingFollowing(localActor, remoteActorID, requestMap["object"])
+	if err != nil {
+		slog.Warn("activitypub.PostInboxAccept", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad request"})
+		return
+	}
+
+	a.RemovePendingFollowing(remoteActorID)
+	a.AppendFollowingID(remoteActorID)
+	a.SetFollowingActivityID(remoteActorID, pending["id"])
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxAccept", "error", "actor save error", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// PostInboxReject 會處理對方送來的 Reject{Follow}，
+// 不論是等待中的追蹤，或是對方事後把我們移除 (已追蹤的情況) 都會一起取消。
+func PostInboxReject(w http.ResponseWriter, r *http.Request, localActor *actor.Actor, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxReject", "info", "reject", "requestMap.object", requestMap["object"])
+
+	remoteActorID := getIDFromField(requestMap["actor"])
+	a, _, err := findPendingFollowing(localActor, remoteActorID, requestMap["object"])
+	if err != nil {
+		// 已經被接受的追蹤就不在等待清單中了，改用當初記錄的 Follow activity 比對
+		a, err = findFollowing(localActor, remoteActorID, requestMap["object"])
+	}
+	if err != nil {
+		slog.Warn("activitypub.PostInboxReject", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad request"})
+		return
+	}
+
+	a.RemovePendingFollowing(remoteActorID)
+	a.RemoveFollowingID(remoteActorID)
+	a.RemoveFollowingActivityID(remoteActorID)
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxReject", "error", "actor save error", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// findPendingFollowing 會找出 Accept 或 Reject 所回應的、我們送給 remoteActorID 的 Follow，
+// follow 可能是內嵌的 Follow activity，也可能只有 ID。
+func findPendingFollowing(localActor *actor.Actor, remoteActorID string, follow interface{}) (*actor.Actor, map[string]string, error) {
+	followID, followerID, err := parseFollowResponseObject(remoteActorID, follow)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var target *actor.Actor
+	var pending map[string]string
+	actor.RangeActors(func(a *actor.Actor) bool {
+		if localActor != nil && a != localActor {
+			return true
+		}
+		if followerID != "" && a.GetFullID() != followerID {
+			return true
+		}
+		for _, p := range a.GetPendingFollowing() {
+			if p["actor"] != remoteActorID {
+				continue
+			}
+			// 有些實作的 Follow ID 會被改寫，所以內嵌 Follow 時只比對 actor 和 object
+			if followerID == "" && p["id"] != followID {
+				continue
+			}
+			target = a
+			pending = p
+			return false
+		}
+		return true
+	})
+
+	if target == nil {
+		return nil, nil, errors.New("pending follow not found")
+	}
+	return target, pending, nil
+}
+
+// findFollowing 會找出已經追蹤 remoteActorID、並且符合 follow 的本站 actor
+func findFollowing(localActor *actor.Actor, remoteActorID string, follow interface{}) (*actor.Actor, error) {
+	followID, followerID, err := parseFollowResponseObject(remoteActorID, follow)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *actor.Actor
+	actor.RangeActors(func(a *actor.Actor) bool {
+		if localActor != nil && a != localActor {
+			return true
+		}
+		if followerID != "" && a.GetFullID() != followerID {
+			return true
+		}
+		id, ok := a.GetFollowingActivityID(remoteActorID)
+		if !ok {
+			return true
+		}
+		if followerID == "" && id != followID {
+			return true
+		}
+		target = a
+		return false
+	})
+
+	if target == nil {
+		return nil, errors.New("following not found")
+	}
+	return target, nil
+}
+
+// parseFollowResponseObject 會解析 Accept 或 Reject 的 object，
+// 回傳 Follow activity 的 ID 以及 (內嵌 Follow 時) 送出 Follow 的本站 actor ID。
+func parseFollowResponseObject(remoteActorID string, follow interface{}) (string, string, error) {
+	switch f := follow.(type) {
+	case string:
+		return f, "", nil
+	case map[string]interface{}:
+		if t, _ := f["type"].(string); t != "Follow" {
+			return "", "", errors.New("object is not a follow")
+		}
+		// 被追蹤的必須是回覆的人自己
+		if getIDFromField(f["object"]) != remoteActorID {
+			return "", "", errors.New("follow object does not match actor")
+		}
+		return getIDFromField(f), getIDFromField(f["actor"]), nil
+	}
+	return "", "", errors.New("object type error")
+}
@@ -0,0 +1,196 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+	"github.com/pichuchen/hatsuaki/datastore/tag"
+	"github.com/pichuchen/hatsuaki/mediaproxy"
+)
+
+// hashtagPattern 會找出 #hatsuaki 或是 #初秋 這樣的 hashtag，
+// 前面必須是開頭或是空白之類的字元，這樣網址中的 # 或是 &#39; 這類的 HTML entity 才不會被當成 hashtag。
+var hashtagPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_/&#])#([\p{L}\p{N}_]+)`)
+
+// hashtagURL 會回傳本站 hashtag 頁面的網址
+func hashtagURL(name string) string {
+	return "https://" + config.GetDomain() + "/tags/" + url.PathEscape(tag.NormalizeName(name))
+}
+
+// ApplyHashtags 會找出 content 中的 hashtag 並加上 Hashtag tag，
+// 回傳的是 hashtag 換成連結之後的 content，content 必須是已經跳脫過的 HTML 文字。
+func ApplyHashtags(o *object.Object, content string) string {
+	return hashtagPattern.ReplaceAllStringFunc(content, func(match string) string {
+		sub := hashtagPattern.FindStringSubmatch(match)
+		prefix, name := sub[1], sub[2]
+
+		// 只有數字的 (例如 #1) 通常不是 hashtag
+		if strings.Trim(name, "0123456789") == "" {
+			return match
+		}
+
+		href := hashtagURL(name)
+		o.AddHashtag("#"+name, href)
+		return prefix + `<a href="` + html.EscapeString(href) + `" class="mention hashtag" rel="tag">#<span>` + html.EscapeString(name) + `</span></a>`
+	})
+}
+
+// IndexHashtags 會依照 tags (object 的 tag 欄位) 重新建立 objectID 的 hashtag 索引
+func IndexHashtags(objectID string, tags interface{}) {
+	tag.RemoveObject(objectID)
+	for _, name := range hashtagNames(tags) {
+		tag.AddObject(name, objectID)
+	}
+
+	err := tag.SaveTag("./tag.json")
+	if err != nil {
+		slog.Warn("activitypub.IndexHashtags", "error", "tag save error", "err", err)
+	}
+}
+
+// unindexHashtags 會把 objectID 從 hashtag 索引中移除
+func unindexHashtags(objectID string) {
+	IndexHashtags(objectID, nil)
+}
+
+// hashtagNames 會從 tag 欄位中取出 Hashtag 的名稱，
+// tag 可能是本站的 []map[string]string，或是從 JSON 讀進來的陣列或單一物件。
+func hashtagNames(tags interface{}) []string {
+	list := []map[string]interface{}{}
+	switch t := tags.(type) {
+	case []map[string]string:
+		for _, m := range t {
+			list = append(list, map[string]interface{}{"type": m["type"], "name": m["name"]})
+		}
+	case []interface{}:
+		for _, i := range t {
+			if m, ok := i.(map[string]interface{}); ok {
+				list = append(list, m)
+			}
+		}
+	case map[string]interface{}:
+		list = append(list, t)
+	}
+
+	names := []string{}
+	for _, m := range list {
+		if t, _ := m["type"].(string); t != "Hashtag" {
+			continue
+		}
+		if name, _ := m["name"].(string); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RouteTag 會接收 /tags/{name} 的請求，
+// 要求 ActivityPub 格式的話回傳本站公開 object 的 OrderedCollection，
+// 否則回傳給前端使用的 JSON，包含本站和已知的其他站的公開 object。
+func RouteTag(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteTag", "request", r.URL.String())
+
+	name := tag.NormalizeName(r.PathValue("name"))
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "application/activity+json") || strings.Contains(accept, "application/ld+json") {
+		routeTagCollection(w, r, name)
+		return
+	}
+
+	// 索引中有其他站的 object，沒有辦法用 ID 比較先後，所以使用加入索引時的序號當作游標
+	// 先過濾掉不公開的 object 再分頁，這樣每一頁的數量才會固定
+	objects := map[string]map[string]interface{}{}
+	ids := []string{}
+	for _, id := range tag.GetObjectIDs(name) {
+		if o, ok := knownPublicObject(id); ok {
+			objects[id] = o
+			ids = append(ids, id)
+		}
+	}
+	seqs := tag.GetObjectSeqs(name)
+	cursor := func(id string) string {
+		return seqCursor(seqs[id])
+	}
+	q := r.URL.Query()
+	pageIDs, hasOlder, _ := paginateIDs(ids, cursor, q.Get("max_id"), q.Get("min_id"), config.GetCollectionPageSize())
+
+	items := []interface{}{}
+	for _, id := range pageIDs {
+		// 給前端使用的 JSON 和 timeline 一樣，其他站的圖片都透過 media proxy 取得
+		items = append(items, mediaproxy.RewriteObject(objects[id]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	m := map[string]interface{}{
+		"success": true,
+		"tag":     name,
+		"items":   items,
+	}
+	if hasOlder && len(pageIDs) > 0 {
+		m["max_id"] = cursor(pageIDs[len(pageIDs)-1])
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// routeTagCollection 會回傳 hashtag 中本站公開 object 的 OrderedCollection
+func routeTagCollection(w http.ResponseWriter, r *http.Request, name string) {
+	ids := []string{}
+	for _, id := range tag.GetObjectIDs(name) {
+		if _, err := object.FindObjectByID(id); err != nil {
+			continue
+		}
+		if _, ok := knownPublicObject(id); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/activity+json")
+	m := map[string]interface{}{}
+	m["@context"] = "https://www.w3.org/ns/activitystreams"
+
+	id := hashtagURL(name)
+	if r.URL.Query().Get("page") != "true" {
+		m["id"] = id
+		m["type"] = "OrderedCollection"
+		m["totalItems"] = len(ids)
+		m["first"] = id + "?page=true"
+		m["last"] = id + "?min_id=0&page=true"
+		json.NewEncoder(w).Encode(m)
+		return
+	}
+
+	q := r.URL.Query()
+	pageIDs, hasOlder, hasNewer := paginateIDs(ids, objectCursor, q.Get("max_id"), q.Get("min_id"), config.GetCollectionPageSize())
+	writePageLinks(m, r, id, pageIDs, objectCursor, hasOlder, hasNewer)
+	m["orderedItems"] = pageIDs
+	json.NewEncoder(w).Encode(m)
+}
+
+// knownPublicObject 會從本站或是已經收過的 object 中找出 id，只有公開 (public) 的 object 才會回傳
+func knownPublicObject(id string) (map[string]interface{}, bool) {
+	var m map[string]interface{}
+	if o, err := object.FindObjectByID(id); err == nil {
+		if o.IsTombstone() || o.GetType() != "Note" {
+			return nil, false
+		}
+		m = newNoteObject(o)
+	} else if o, err := remoteobject.FindRemoteObjectByID(id); err == nil {
+		m = o.ToMap()
+	} else {
+		return nil, false
+	}
+
+	// 不列出 (unlisted) 的 object 不會出現在公開的時間軸
+	if objectVisibility(m) != VisibilityPublic {
+		return nil, false
+	}
+	return m, true
+}
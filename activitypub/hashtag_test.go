@@ -0,0 +1,89 @@
+package activitypub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+func TestApplyHashtags(t *testing.T) {
+	type TestCase struct {
+		content  string
+		expected string
+		names    []string
+	}
+
+	link := func(name string, href string) string {
+		return `<a href="https://` + testDomain + `/tags/` + href + `" class="mention hashtag" rel="tag">#<span>` + name + `</span></a>`
+	}
+
+	testCases := []TestCase{
+		{
+			content:  "#hatsuaki",
+			expected: link("hatsuaki", "hatsuaki"),
+			names:    []string{"#hatsuaki"},
+		},
+		{
+			content:  "hello #Go and #go",
+			expected: "hello " + link("Go", "go") + " and " + link("go", "go"),
+			names:    []string{"#Go"},
+		},
+		{
+			content:  "秋天 #初秋",
+			expected: "秋天 " + link("初秋", "%E5%88%9D%E7%A7%8B"),
+			names:    []string{"#初秋"},
+		},
+		{
+			// 只有數字的不是 hashtag
+			content:  "issue #123",
+			expected: "issue #123",
+			names:    []string{},
+		},
+		{
+			// 網址中的 # 以及 HTML entity 都不是 hashtag
+			content:  "a#b https://example.org/#tag &#39;quoted&#39;",
+			expected: "a#b https://example.org/#tag &#39;quoted&#39;",
+			names:    []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		o := &object.Object{}
+		actual := ApplyHashtags(o, tc.content)
+		if actual != tc.expected {
+			t.Errorf("ApplyHashtags(%q) = %q, expected %q", tc.content, actual, tc.expected)
+		}
+		names := []string{}
+		for _, tag := range o.GetTag() {
+			if tag["type"] == "Hashtag" {
+				names = append(names, tag["name"])
+			}
+		}
+		if !reflect.DeepEqual(names, tc.names) {
+			t.Errorf("ApplyHashtags(%q) tags = %v, expected %v", tc.content, names, tc.names)
+		}
+	}
+}
+
+func TestHashtagNames(t *testing.T) {
+	type TestCase struct {
+		tags     interface{}
+		expected []string
+	}
+
+	testCases := []TestCase{
+		{tags: nil, expected: []string{}},
+		{tags: []map[string]string{{"type": "Hashtag", "name": "#go"}, {"type": "Mention", "name": "@alice"}}, expected: []string{"#go"}},
+		{tags: []interface{}{map[string]interface{}{"type": "Hashtag", "name": "#go"}, "invalid"}, expected: []string{"#go"}},
+		{tags: map[string]interface{}{"type": "Hashtag", "name": "#single"}, expected: []string{"#single"}},
+		{tags: []interface{}{map[string]interface{}{"type": "Emoji", "name": ":blob:"}}, expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		actual := hashtagNames(tc.tags)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("hashtagNames(%v) = %v, expected %v", tc.tags, actual, tc.expected)
+		}
+	}
+}
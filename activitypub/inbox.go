@@ -2,14 +2,16 @@ package activitypub
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"strings"
-	"time"
+	"sync"
 
 	"github.com/pichuchen/hatsuaki/datastore/actor"
 	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
 )
 
 // 相關文件請參閱: https://www.w3.org/TR/activitypub/#inbox
@@ -56,15 +58,18 @@ func RouteSharedInbox(w http.ResponseWriter, r *http.Request) {
 
 func GetActorInbox(w http.ResponseWriter, r *http.Request, a *actor.Actor) {
 
+	// inbox 裡面可能有不公開的訊息，所以只有該使用者自己可以讀取
+	if !verifyInboxOwner(w, r, a) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/activity+json")
 	m := map[string]interface{}{}
 
-	// 這個部分需要驗證進行取 inbox 的人必須要是該使用者
-
 	page := r.URL.Query().Get("page")
 	if page == "true" {
-		// 如果有 page=true 的參數，則回傳一個 OrderedCollection
-		// 這個 OrderedCollection 會包含所有的 Object
+		// 如果有 page=true 的參數，則回傳一個 OrderedCollectionPage
+		// 可以用 max_id 和 min_id 指定要從哪裡開始
 		RouteActoInboxPage(w, r, a)
 		return
 	}
@@ -83,7 +88,7 @@ func GetActorInbox(w http.ResponseWriter, r *http.Request, a *actor.Actor) {
 	m["type"] = "OrderedCollection"
 	m["totalItems"] = a.GetInboxObjectsCount()
 	m["first"] = id + "?page=true"
-	m["last"] = id + "?page=true"
+	m["last"] = id + "?min_id=0&page=true"
 
 	json.NewEncoder(w).Encode(m)
 }
@@ -99,22 +104,38 @@ func RouteActoInboxPage(w http.ResponseWriter, r *http.Request, a *actor.Actor)
 
 	id := "https://" + config.GetDomain() + "/.activitypub/actor/" + a.GetUsername() + "/inbox"
 
-	// 這邊是在 ActivityPub 中的必要 (MUST) 欄位
-	m["id"] = id
-	m["type"] = "OrderedCollection"
-	m["totalItems"] = a.GetInboxObjectsCount()
-	m["first"] = id + "?page=true"
-	m["last"] = id + "?page=true"
-
-	objectIDs, err := a.GetOutboxObjects()
+	objectIDs, err := a.GetInboxObjects()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
 		return
 	}
+
+	// inbox 裡的是其他站的 object ID，沒有辦法比較先後，所以使用加入 inbox 時的序號當作游標
+	q := r.URL.Query()
+	cursor := inboxCursor(a)
+	pageIDs, hasOlder, hasNewer := paginateIDs(objectIDs, cursor, q.Get("max_id"), q.Get("min_id"), config.GetCollectionPageSize())
+
+	// 這邊是在 ActivityPub 中的必要 (MUST) 欄位
+	writePageLinks(m, r, id, pageIDs, cursor, hasOlder, hasNewer)
+
+	// 每一個 object 都可能需要向其他站取得，所以同時進行
+	activities := make([]map[string]interface{}, len(pageIDs))
+	wg := sync.WaitGroup{}
+	for i, oid := range pageIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			activities[i] = inboxActivity(a, oid)
+		}()
+	}
+	wg.Wait()
+
 	orderedItems := []interface{}{}
-	for _, oid := range objectIDs {
-		orderedItems = append(orderedItems, map[string]interface{}{"id": oid})
+	for _, v := range activities {
+		if v != nil {
+			orderedItems = append(orderedItems, v)
+		}
 	}
 	m["orderedItems"] = orderedItems
 
@@ -122,12 +143,71 @@ func RouteActoInboxPage(w http.ResponseWriter, r *http.Request, a *actor.Actor)
 
 }
 
+// verifyInboxOwner 會檢查請求是否帶有 a 本人的 token (和 API 使用的相同)，
+// 沒有帶或是 token 不合法的話回傳 401，是其他使用者的話回傳 403。
+func verifyInboxOwner(w http.ResponseWriter, r *http.Request, a *actor.Actor) bool {
+	username, err := verifyLocalUser(r)
+	if err != nil {
+		slog.Warn("activitypub.verifyInboxOwner", "warn", err)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return false
+	}
+
+	if username != a.GetUsername() {
+		slog.Warn("activitypub.verifyInboxOwner", "warn", "not inbox owner", "username", username, "owner", a.GetUsername())
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "forbidden"})
+		return false
+	}
+	return true
+}
+
+// inboxActivity 會把 inbox 中的 object ID 還原成 Create activity，取得 object 失敗的話回傳 nil。
+func inboxActivity(a *actor.Actor, oid string) map[string]interface{} {
+	o, err := GetObject(oid, a.GetUsername())
+	if err != nil {
+		slog.Warn("activitypub.inboxActivity", "id", oid, "error", err.Error())
+		return nil
+	}
+
+	activityMap := map[string]interface{}{}
+	activityMap["type"] = "Create"
+	activityMap["actor"] = getIDFromField(o["attributedTo"])
+	activityMap["published"] = o["published"]
+	activityMap["object"] = o
+	return activityMap
+}
+
+// inboxCursor 會回傳 a 的 inbox 使用的游標，也就是 object 加入 inbox 時的序號
+func inboxCursor(a *actor.Actor) func(string) string {
+	return func(id string) string {
+		return seqCursor(a.GetInboxObjectSeq(id))
+	}
+}
+
 func PostActorInbox(w http.ResponseWriter, r *http.Request, a *actor.Actor) {
 	slog.Info("activitypub.PostActorInbox", "info", "inbox")
 
+	// 所有送進 inbox 的請求都必須要有合法的 HTTP Signature，
+	// 否則任何人都可以假冒其他站的使用者送出 Follow 或是 Create
+	body, keyID, err := VerifyInboxRequest(w, r)
+	if errors.Is(err, errInboxBodyTooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": "request entity too large"})
+		return
+	}
+	if err != nil {
+		slog.Warn("activitypub.PostActorInbox", "error", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return
+	}
+
 	// 解碼送入的 JSON
 	var requestMap map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&requestMap)
+	err = json.Unmarshal(body, &requestMap)
 	if err != nil {
 		slog.Warn("activitypub.PostActorInbox", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -135,11 +215,51 @@ func PostActorInbox(w http.ResponseWriter, r *http.Request, a *actor.Actor) {
 		return
 	}
 
+	// 簽章合法之後，還要確認 activity 的內容確實屬於簽署者
+	err = CheckActivityOrigin(keyID, requestMap)
+	if err != nil {
+		slog.Warn("activitypub.PostActorInbox", "error", err)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "forbidden"})
+		return
+	}
+
+	// actor 更新了自己的資料 (例如換了 key 或是 inbox) 的話，快取就不能再用了
+	invalidateRemoteActorByActivity(requestMap)
+
 	requestType := requestMap["type"].(string)
 	if requestType == "Follow" {
 		PostActorInboxFollow(w, r, a, requestMap)
 		return
 	}
+	if requestType == "Undo" {
+		PostInboxUndo(w, r, a, requestMap)
+		return
+	}
+	if requestType == "Accept" {
+		PostInboxAccept(w, r, a, requestMap)
+		return
+	}
+	if requestType == "Reject" {
+		PostInboxReject(w, r, a, requestMap)
+		return
+	}
+	if requestType == "Like" {
+		PostInboxLike(w, r, requestMap)
+		return
+	}
+	if requestType == "Announce" {
+		PostInboxAnnounce(w, r, requestMap)
+		return
+	}
+	if requestType == "Delete" {
+		PostInboxDelete(w, r, requestMap)
+		return
+	}
+	if requestType == "Update" {
+		PostInboxUpdate(w, r, requestMap)
+		return
+	}
 
 	slog.Debug("activitypub.PostActorInbox", "info", requestMap)
 
@@ -198,23 +318,59 @@ func PostActorInboxFollow(w http.ResponseWriter, r *http.Request, a *actor.Actor
 
 	slog.Info("activitypub.PostActorInboxFollow", "followID", followID)
 
-	if config.GetEnableAutoAcceptFollow() {
-		// 這邊暫停五秒是讓 Debug Log 看起來比較清楚
-		time.Sleep(5 * time.Second)
+	// 已經是 follower 的話 (例如對方重新送了一次 Follow)，直接接受就好
+	alreadyFollower := false
+	for _, id := range a.GetFollowerIDs() {
+		if id == actorID {
+			alreadyFollower = true
+			break
+		}
+	}
+
+	if !a.GetManuallyApprovesFollowers() || alreadyFollower {
 		slog.Info("activitypub.PostActorInboxFollow", "info", "auto accept follow")
 		SendAccept(a, actorID, followID)
 		a.AppendFollowerID(actorID)
-		actor.SaveActor("./actor.json")
+		a.SetFollowActivityID(actorID, followID)
+		err := actor.SaveActor("./actor.json")
+		if err != nil {
+			slog.Warn("activitypub.PostActorInboxFollow", "error", "actor save error", "err", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
 	}
 
+	// 使用者需要手動核准的話，先放進待審核清單，等使用者透過 API 接受或拒絕
+	slog.Info("activitypub.PostActorInboxFollow", "info", "pending follow request")
+	a.AppendPendingFollower(actorID, followID)
+	err := actor.SaveActor("./actor.json")
+	if err != nil {
+		slog.Warn("activitypub.PostActorInboxFollow", "error", "actor save error", "err", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
 }
 
 func PostSharedInbox(w http.ResponseWriter, r *http.Request) {
 	slog.Info("activitypub.PostSharedInbox", "info", "shared inbox")
 
+	// 所有送進 inbox 的請求都必須要有合法的 HTTP Signature，
+	// 否則任何人都可以假冒其他站的使用者送出 Follow 或是 Create
+	body, keyID, err := VerifyInboxRequest(w, r)
+	if errors.Is(err, errInboxBodyTooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": "request entity too large"})
+		return
+	}
+	if err != nil {
+		slog.Warn("activitypub.PostSharedInbox", "error", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return
+	}
+
 	// 解碼送入的 JSON
 	var requestMap map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&requestMap)
+	err = json.Unmarshal(body, &requestMap)
 	if err != nil {
 		slog.Warn("activitypub.PostSharedInbox", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -222,11 +378,51 @@ func PostSharedInbox(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 簽章合法之後，還要確認 activity 的內容確實屬於簽署者
+	err = CheckActivityOrigin(keyID, requestMap)
+	if err != nil {
+		slog.Warn("activitypub.PostSharedInbox", "error", err)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "forbidden"})
+		return
+	}
+
+	// actor 更新了自己的資料 (例如換了 key 或是 inbox) 的話，快取就不能再用了
+	invalidateRemoteActorByActivity(requestMap)
+
 	requestType := requestMap["type"].(string)
 	if requestType == "Create" {
 		PostSharedInboxCreate(w, r, requestMap)
 		return
 	}
+	if requestType == "Undo" {
+		PostInboxUndo(w, r, nil, requestMap)
+		return
+	}
+	if requestType == "Accept" {
+		PostInboxAccept(w, r, nil, requestMap)
+		return
+	}
+	if requestType == "Reject" {
+		PostInboxReject(w, r, nil, requestMap)
+		return
+	}
+	if requestType == "Like" {
+		PostInboxLike(w, r, requestMap)
+		return
+	}
+	if requestType == "Announce" {
+		PostInboxAnnounce(w, r, requestMap)
+		return
+	}
+	if requestType == "Delete" {
+		PostInboxDelete(w, r, requestMap)
+		return
+	}
+	if requestType == "Update" {
+		PostInboxUpdate(w, r, requestMap)
+		return
+	}
 
 	slog.Debug("activitypub.PostSharedInbox", "info", requestMap)
 
@@ -251,29 +447,36 @@ func PostSharedInboxCreate(w http.ResponseWriter, r *http.Request, requestMap ma
 	fmt.Printf("%s\n", string(encoded))
 
 	o := requestMap["object"].(map[string]interface{})
+	// object 的來源已經在 CheckActivityOrigin 中和簽署的 key 比對過，
+	// 如果不同源的話這邊拿到的會是向原始伺服器重新取得的版本。
 	oid := o["id"].(string)
-	// 這邊需要驗證 oid 的 id 是否和簽署的 key 的 domain 相同
-	// 在這邊的驗證我們沒辦法信任來源 IP, 能信任的只有簽發的 Key 而已。
-
-	prefix := "https://" + config.GetDomain() + "/.activitypub/actor/"
-	toList := requestMap["to"].([]interface{})
-	for _, v := range toList {
-		to := v.(string)
-		if !strings.HasPrefix(to, prefix) {
-			slog.Warn("activitypub.PostSharedInboxCreate", "skip", "to", "to", to)
-			continue
-		}
-		actorName := to[len(prefix):]
-		a, err := actor.FindActorByUsername(actorName)
-		if err != nil {
-			slog.Warn("activitypub.PostSharedInboxCreate", "error", "actor not found", "actorName", actorName)
+
+	// 放進收件人以及 (公開或是 followers 限定的話) 追蹤作者的本站使用者的 inbox
+	for _, a := range localRecipients(requestMap, o) {
+		if a.HasInboxObject(oid) {
 			continue
 		}
-
 		a.AppendInboxObject(oid)
+		a.SetInboxObjectAuthor(oid, getIDFromField(o["attributedTo"]))
 	}
 
-	err := actor.SaveActor("./actor.json")
+	// 回覆本站的 object 的話，記錄在被回覆的 object 上
+	inReplyTo, _ := o["inReplyTo"].(string)
+	recordReply(inReplyTo, oid)
+	err := object.SaveObject("./object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostSharedInboxCreate", "error", "object save error", "err", err)
+	}
+
+	// 存起來之後 timeline 就不需要再向對方伺服器取得
+	storeRemoteObject(o)
+	IndexHashtags(oid, o["tag"])
+	err = remoteobject.SaveRemoteObject("./remote_object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostSharedInboxCreate", "error", "remote object save error", "err", err)
+	}
+
+	err = actor.SaveActor("./actor.json")
 	if err != nil {
 		slog.Warn("activitypub.PostSharedInboxCreate", "error", "actor save error", "err", err)
 	}
@@ -0,0 +1,145 @@
+package activitypub
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/activitypub/signature"
+	"github.com/pichuchen/hatsuaki/datastore/remoteactor"
+)
+
+// 簽章驗證失敗時，actor 的快取至少要是這麼久以前取得的才會重新取得 key
+const publicKeyRefreshMinAge = 10 * time.Minute
+
+// keyOwnerCache 以 keyId 為 key 存放 key 的擁有者 (actor ID)，
+// 只有當 key 是獨立的文件 (keyId 沒有 # 的情況，例如 GoToSocial) 時才需要，
+// key 本身則是從 remoteactor 的快取中讀取。
+var keyOwnerCache = &sync.Map{}
+
+// GetPublicKeyByKeyID 會回傳 keyId 所對應的 PEM 格式 public key，
+// 如果 refresh 是 true 而且快取已經超過 publicKeyRefreshMinAge 的話，會忽略快取重新向對方取得。
+func GetPublicKeyByKeyID(keyID string, refresh bool) (string, error) {
+	pem, _, err := getPublicKey(keyID, refresh)
+	return pem, err
+}
+
+// GetKeyOwnerByKeyID 會回傳 keyId 所屬的 actor ID
+func GetKeyOwnerByKeyID(keyID string) (string, error) {
+	_, owner, err := getPublicKey(keyID, false)
+	return owner, err
+}
+
+// getPublicKey 會回傳 keyId 所對應的 PEM 格式 public key 以及擁有者
+func getPublicKey(keyID string, refresh bool) (string, string, error) {
+	owner, err := getKeyOwner(keyID)
+	if err != nil {
+		slog.Warn("activitypub.getPublicKey", "error", err, "keyID", keyID)
+		return "", "", err
+	}
+
+	getActor := GetRemoteActor
+	if refresh && canRefreshPublicKey(owner) {
+		getActor = RefreshRemoteActor
+	}
+	a, err := getActor(owner)
+	if err != nil {
+		slog.Warn("activitypub.getPublicKey", "error", err, "keyID", keyID)
+		return "", "", err
+	}
+
+	// 一定要是 actor 自己列出來的 key 才算數，避免其他人宣稱自己的 key 屬於某個 actor
+	for _, k := range a.GetPublicKeys() {
+		if id, _ := k["id"].(string); id != keyID {
+			continue
+		}
+		if pem, ok := k["publicKeyPem"].(string); ok {
+			return pem, a.GetID(), nil
+		}
+	}
+
+	slog.Warn("activitypub.getPublicKey", "error", "public key not found", "keyID", keyID, "owner", owner)
+	return "", "", errors.New("public key not found")
+}
+
+// canRefreshPublicKey 會檢查 actor 的快取是否已經超過 publicKeyRefreshMinAge，
+// 快取的 key 驗證失敗時只有快取夠舊才會重新取得，避免隨便一個簽章錯誤的請求就讓我們去連線對方的伺服器。
+func canRefreshPublicKey(actorID string) bool {
+	a, err := remoteactor.FindRemoteActorByID(actorID)
+	if err != nil {
+		return true
+	}
+	return time.Since(a.GetFetchedAt()) >= publicKeyRefreshMinAge
+}
+
+// getKeyOwner 會找出 keyId 所屬的 actor ID
+func getKeyOwner(keyID string) (string, error) {
+	// keyId 通常會是 https://example.com/users/alice#main-key 這樣的形式，
+	// 去掉 # 後面的部分就是 actor 本身的位置
+	if pos := strings.Index(keyID, "#"); pos != -1 {
+		return keyID[:pos], nil
+	}
+
+	if v, ok := keyOwnerCache.Load(keyID); ok {
+		return v.(string), nil
+	}
+
+	// 沒有 # 的話 keyId 會是一個獨立的 key 文件，需要讀取裡面的 owner
+	m, err := FetchObject(keyID, "instance.actor", true)
+	if err != nil {
+		return "", err
+	}
+	owner, _ := m["owner"].(string)
+	if !isSameOrigin(owner, keyID) {
+		return "", errors.New("key owner is not on the same origin")
+	}
+
+	keyOwnerCache.Store(keyID, owner)
+	return owner, nil
+}
+
+// inbox 的 body 在驗證簽章之前就要讀取，所以限制大小，一般的 activity 遠小於這個大小
+const inboxMaxBodySize = 1 << 20
+
+// errInboxBodyTooLarge 表示 inbox 的 body 超過 inboxMaxBodySize
+var errInboxBodyTooLarge = errors.New("request body too large")
+
+// VerifyInboxRequest 會讀取整個 body 並驗證 HTTP Signature，
+// 驗證成功時回傳 body 以及簽署用的 keyId。
+// 因為驗證 Digest 需要完整的 body，所以呼叫後請改用回傳的 body 而不是 r.Body。
+// body 超過 inboxMaxBodySize 的話回傳 errInboxBodyTooLarge。
+func VerifyInboxRequest(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, inboxMaxBodySize))
+	if err != nil {
+		slog.Warn("activitypub.VerifyInboxRequest", "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, "", errInboxBodyTooLarge
+		}
+		return nil, "", err
+	}
+
+	keyID, err := signature.VerifyRequest(r, body, GetPublicKeyByKeyID)
+	if err != nil {
+		slog.Warn("activitypub.VerifyInboxRequest", "error", err)
+		return nil, "", err
+	}
+
+	return body, keyID, nil
+}
+
+// VerifyFetchRequest 會驗證 GET 請求 (例如其他站來取得 object) 的 HTTP Signature，
+// 驗證成功的話回傳簽署者的 actor ID。
+func VerifyFetchRequest(r *http.Request) (string, error) {
+	keyID, err := signature.VerifyRequest(r, nil, GetPublicKeyByKeyID)
+	if err != nil {
+		slog.Warn("activitypub.VerifyFetchRequest", "error", err)
+		return "", err
+	}
+
+	return GetKeyOwnerByKeyID(keyID)
+}
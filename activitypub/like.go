@@ -0,0 +1,198 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#like-activity-outbox
+// 以及 https://www.w3.org/TR/activitypub/#like-activity-inbox
+
+// SendLike 會由 senderActor 對 objectID 按讚，並把 Like 送給 object 的作者。
+// 本站的 object 會直接記錄，不需要經過 inbox。
+func SendLike(senderActor *actor.Actor, objectID string) error {
+	slog.Info("SendLike", "sender", senderActor.GetUsername(), "object", objectID)
+
+	objectID, authorID, err := findObjectAuthor(senderActor, objectID)
+	if err != nil {
+		return err
+	}
+
+	likeActivity := newLikeActivity(senderActor, objectID, senderActor.GetFullID()+"/like/"+object.GenerateUUIDv7())
+	senderActor.AppendLikedObject(objectID, likeActivity["id"].(string))
+
+	if o, err := object.FindObjectByID(objectID); err == nil {
+		o.AddLike(senderActor.GetFullID(), likeActivity["id"].(string))
+		return object.SaveObject("./object.json")
+	}
+
+	SendActivity(senderActor.GetUsername(), authorID, likeActivity)
+	return nil
+}
+
+// SendUndoLike 會取消 senderActor 對 objectID 的按讚，並送出 Undo{Like} 給 object 的作者。
+func SendUndoLike(senderActor *actor.Actor, objectID string) error {
+	slog.Info("SendUndoLike", "sender", senderActor.GetUsername(), "object", objectID)
+
+	objectID, authorID, err := findObjectAuthor(senderActor, objectID)
+	if err != nil {
+		return err
+	}
+
+	likeID, ok := senderActor.RemoveLikedObject(objectID)
+	if !ok {
+		return errors.New("object not liked")
+	}
+
+	if o, err := object.FindObjectByID(objectID); err == nil {
+		o.RemoveLike(senderActor.GetFullID())
+		return object.SaveObject("./object.json")
+	}
+
+	undoActivity := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       likeID + "/undo",
+		"type":     "Undo",
+		"actor":    senderActor.GetFullID(),
+		"object":   newLikeActivity(senderActor, objectID, likeID),
+	}
+
+	SendActivity(senderActor.GetUsername(), authorID, undoActivity)
+	return nil
+}
+
+func newLikeActivity(senderActor *actor.Actor, objectID string, likeID string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       likeID,
+		"type":     "Like",
+		"actor":    senderActor.GetFullID(),
+		"object":   objectID,
+	}
+}
+
+// findObjectAuthor 會回傳 objectID 完整的 ID 以及作者的 actor ID，
+// 本站的 object 從 datastore 讀取 (a 看不到的 object 會回傳錯誤)，其他站的則向原始伺服器取得。
+func findObjectAuthor(a *actor.Actor, objectID string) (string, string, error) {
+	if _, err := object.FindObjectByID(objectID); err == nil {
+		o, err := findVisibleObject(objectID, a.GetFullID())
+		if err != nil {
+			return "", "", err
+		}
+		return o.GetFullID(), o.GetAttributedTo(), nil
+	}
+
+	o, err := FetchObject(objectID, a.GetUsername(), false)
+	if err != nil {
+		return "", "", err
+	}
+	authorID := getIDFromField(o["attributedTo"])
+	if authorID == "" {
+		return "", "", errors.New("object author not found")
+	}
+	return objectID, authorID, nil
+}
+
+// PostInboxLike 會處理送進 inbox 的 Like，只會記錄對本站 object 的按讚。
+func PostInboxLike(w http.ResponseWriter, r *http.Request, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxLike", "info", "like", "requestMap.object", requestMap["object"])
+
+	actorID := getIDFromField(requestMap["actor"])
+	o, err := findVisibleObject(getIDFromField(requestMap["object"]), actorID)
+	if err != nil {
+		// 不是本站的 object、已經被刪除或是按讚的人看不到的話就不記錄，
+		// 回應也和成功時相同，避免其他站藉此判斷 object 是否存在
+		slog.Info("activitypub.PostInboxLike", "info", "object not found", "object", requestMap["object"], "err", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	likeID, _ := requestMap["id"].(string)
+	o.AddLike(actorID, likeID)
+	err = object.SaveObject("./object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxLike", "error", "object save error", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// undoLike 會移除 likerID 對本站 object 的按讚並儲存。
+// like 可能是內嵌的 Like activity，或是 Like activity 的 ID。
+func undoLike(likerID string, like interface{}) error {
+	var target *object.Object
+
+	switch l := like.(type) {
+	case map[string]interface{}:
+		// 只能取消自己送出的 Like
+		if getIDFromField(l["actor"]) != likerID {
+			return errors.New("like actor does not match undo actor")
+		}
+		o, err := object.FindObjectByID(getIDFromField(l["object"]))
+		if err != nil {
+			return err
+		}
+		target = o
+	case string:
+		// 只有 ID 的話，要從當初記錄的 Like activity 中找出是對哪個 object 按讚
+		object.RangeObjects(func(o *object.Object) bool {
+			if id, ok := o.FindLikeByActivityID(l); ok && id == likerID {
+				target = o
+				return false
+			}
+			return true
+		})
+		if target == nil {
+			return errors.New("like activity not found")
+		}
+	default:
+		return errors.New("object type error")
+	}
+
+	slog.Info("activitypub.undoLike", "object", target.GetFullID(), "actor", likerID)
+	target.RemoveLike(likerID)
+	return object.SaveObject("./object.json")
+}
+
+// RouteObjectLikes 會回傳對 object 按讚的 actor 清單
+// 舉例來說會像是 GET /.activitypub/object/{object}/likes
+func RouteObjectLikes(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteObjectLikes", "request", r.URL.String())
+
+	o, err := findVisibleObject(r.PathValue("object"), requestViewer(r))
+	if err != nil {
+		writeObjectError(w, err)
+		return
+	}
+
+	writeIDCollection(w, r, o.GetFullID()+"/likes", o.GetLikes(), false)
+}
+
+// RouteActorLiked 會回傳使用者按過讚的 object 清單
+// 舉例來說會像是 GET /.activitypub/actor/alice/liked
+func RouteActorLiked(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteActorLiked", "request", r.URL.String())
+
+	a, err := actor.FindActorByUsername(r.PathValue("actor"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "actor not found"})
+		return
+	}
+
+	// 和 RouteObjectReplies 一樣，看不到的 object 不會出現在清單中
+	viewerID := requestViewer(r)
+	liked := []string{}
+	for _, id := range a.GetLikedObjectIDs() {
+		if m, ok := lookupKnownObject(id); ok && !canViewObject(m, viewerID) {
+			continue
+		}
+		liked = append(liked, id)
+	}
+	writeIDCollection(w, r, a.GetFullID()+"/liked", liked, false)
+}
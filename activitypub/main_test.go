@@ -0,0 +1,45 @@
+package activitypub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+)
+
+// 測試中使用的本站網域
+const testDomain = "example.com"
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "activitypub-test")
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	err = os.WriteFile(path, []byte(`{"domain": "`+testDomain+`"}`), 0644)
+	if err == nil {
+		err = config.LoadConfig(path)
+	}
+	// 測試中存檔的 ./*.json 都寫到暫存目錄裡
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testActor 會回傳本站的使用者 username，還不存在的話會建立一個
+func testActor(username string) *actor.Actor {
+	if a, err := actor.FindActorByUsername(username); err == nil {
+		return a
+	}
+	return actor.NewActor(username)
+}
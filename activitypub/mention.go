@@ -0,0 +1,91 @@
+package activitypub
+
+import (
+	"html"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/webfinger"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitystreams-vocabulary/#microsyntaxes
+
+// mentionPattern 會找出 @alice 或是 @alice@example.com 這樣的提及，
+// 前面必須是開頭或是空白之類的字元，這樣 email 或是網址中的 @ 才不會被當成提及。
+var mentionPattern = regexp.MustCompile(`(^|[^\w/@.])@(\w+(?:[\w.-]*\w)?)(?:@([\w-]+(?:\.[\w-]+)+))?`)
+
+// 一次轉換中最多解析幾個不同的提及，超過的提及會維持原本的文字，
+// 避免一篇內容中塞了大量的提及讓伺服器對外送出大量的 WebFinger 查詢。
+const maxMentions = 20
+
+// mentionResolver 會記錄一次轉換中已經解析過的提及 (包含解析失敗的)，
+// 同一個 handle 在整篇內容中只會查詢一次，查詢的次數也不會超過 maxMentions。
+type mentionResolver struct {
+	resolved map[string]string
+}
+
+func newMentionResolver() *mentionResolver {
+	return &mentionResolver{resolved: map[string]string{}}
+}
+
+// resolve 會回傳 handle 的 actor ID，解析不到或是已經超過上限的話回傳 false
+func (m *mentionResolver) resolve(handle string) (string, bool) {
+	key := strings.ToLower(handle)
+	if actorID, ok := m.resolved[key]; ok {
+		return actorID, actorID != ""
+	}
+	if len(m.resolved) >= maxMentions {
+		slog.Info("activitypub.mentionResolver", "info", "too many mentions", "handle", handle)
+		return "", false
+	}
+
+	actorID, err := webfinger.Resolve(handle)
+	if err != nil {
+		slog.Info("activitypub.mentionResolver", "info", "mention not resolved", "handle", handle, "error", err)
+		actorID = ""
+	}
+	m.resolved[key] = actorID
+	return actorID, actorID != ""
+}
+
+// RemoveMentions 會移除 o 原本的提及，編輯內容時重新轉換之前需要先呼叫，
+// 新的內容中已經沒有提到的人才不會繼續留在 tag 和 cc 中。
+// 回覆對象的作者是由 SetReplyTarget 加進 cc 的，即使也被提及了仍然會保留。
+func RemoveMentions(o *object.Object) {
+	keep := ""
+	if parent, ok := lookupKnownObject(o.GetInReplyTo()); ok {
+		keep = getIDFromField(parent["attributedTo"])
+	}
+	o.RemoveMentions(keep)
+}
+
+// ApplyMentions 會找出 content 中提到的人並透過 mentions 解析，
+// 解析成功的會加上 Mention tag 並放進 cc，這樣 SendCreate 就會送給他們，
+// 回傳的是提及換成連結之後的 content，解析不到的提及則維持原本的文字。
+// content 必須是已經跳脫過的 HTML 文字，一般是由 RenderContent 呼叫，
+// 同一次轉換中的每一段文字都要使用同一個 mentions。
+func ApplyMentions(o *object.Object, mentions *mentionResolver, content string) string {
+	return mentionPattern.ReplaceAllStringFunc(content, func(match string) string {
+		sub := mentionPattern.FindStringSubmatch(match)
+		prefix, username, domain := sub[1], sub[2], sub[3]
+		if domain == "" {
+			domain = config.GetDomain()
+		}
+		handle := "@" + username + "@" + domain
+
+		actorID, ok := mentions.resolve(handle)
+		if !ok {
+			return match
+		}
+
+		o.AddTag(handle, actorID)
+		if actorID != o.GetAttributedTo() {
+			o.AddCC(actorID)
+		}
+
+		return prefix + `<span class="h-card"><a href="` + html.EscapeString(actorID) + `" class="u-url mention">@<span>` + html.EscapeString(username) + `</span></a></span>`
+	})
+}
@@ -0,0 +1,99 @@
+package activitypub
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+func TestApplyMentions(t *testing.T) {
+	type TestCase struct {
+		content  string
+		expected string
+		cc       []string
+	}
+
+	alice := testActor("mention-alice")
+	author := testActor("mention-author")
+	aliceLink := `<span class="h-card"><a href="` + alice.GetFullID() + `" class="u-url mention">@<span>mention-alice</span></a></span>`
+
+	testCases := []TestCase{
+		{
+			content:  "hi @mention-alice",
+			expected: "hi " + aliceLink,
+			cc:       []string{alice.GetFullID()},
+		},
+		{
+			content:  "hi @mention-alice@" + testDomain + "!",
+			expected: "hi " + aliceLink + "!",
+			cc:       []string{alice.GetFullID()},
+		},
+		{
+			// 找不到的使用者維持原本的文字
+			content:  "hi @mention-nobody",
+			expected: "hi @mention-nobody",
+			cc:       []string{},
+		},
+		{
+			// email 不是提及
+			content:  "mail mention-alice@" + testDomain,
+			expected: "mail mention-alice@" + testDomain,
+			cc:       []string{},
+		},
+		{
+			// 提到自己的話不需要放進 cc
+			content:  "me @mention-author",
+			expected: `me <span class="h-card"><a href="` + author.GetFullID() + `" class="u-url mention">@<span>mention-author</span></a></span>`,
+			cc:       []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		o := &object.Object{"attributedTo": author.GetFullID()}
+		actual := ApplyMentions(o, newMentionResolver(), tc.content)
+		if actual != tc.expected {
+			t.Errorf("ApplyMentions(%q) = %q, expected %q", tc.content, actual, tc.expected)
+		}
+		if !reflect.DeepEqual(o.GetCC(), tc.cc) {
+			t.Errorf("ApplyMentions(%q) cc = %v, expected %v", tc.content, o.GetCC(), tc.cc)
+		}
+	}
+}
+
+func TestMentionResolverShared(t *testing.T) {
+	alice := testActor("mention-alice")
+	o := &object.Object{"attributedTo": testActor("mention-author").GetFullID()}
+
+	// 同一次轉換中的每一段文字共用解析的結果，同一個人只會解析一次
+	mentions := newMentionResolver()
+	ApplyMentions(o, mentions, "@mention-alice @MENTION-ALICE")
+	ApplyMentions(o, mentions, "@mention-alice@"+testDomain+" @mention-nobody @mention-nobody")
+	if len(mentions.resolved) != 2 {
+		t.Errorf("resolved %d handles, expected 2: %v", len(mentions.resolved), mentions.resolved)
+	}
+	if !reflect.DeepEqual(o.GetCC(), []string{alice.GetFullID()}) {
+		t.Errorf("cc = %v, expected %v", o.GetCC(), []string{alice.GetFullID()})
+	}
+}
+
+func TestMentionResolverLimit(t *testing.T) {
+	testActor("mention-alice")
+	o := &object.Object{"attributedTo": testActor("mention-author").GetFullID()}
+
+	// 超過上限之後的提及都不會再解析，就算是存在的使用者也一樣
+	handles := []string{}
+	for i := 0; i < maxMentions; i++ {
+		handles = append(handles, fmt.Sprintf("@mention-nobody%d", i))
+	}
+	content := strings.Join(handles, " ") + " @mention-alice"
+	actual := ApplyMentions(o, newMentionResolver(), content)
+	if actual != content {
+		t.Errorf("ApplyMentions() = %q, expected %q", actual, content)
+	}
+	if len(o.GetCC()) != 0 {
+		t.Errorf("cc = %v, expected none", o.GetCC())
+	}
+}
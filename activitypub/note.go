@@ -0,0 +1,154 @@
+package activitypub
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#update-activity-outbox
+// 以及 https://www.w3.org/TR/activitypub/#update-activity-inbox
+
+// GetObject 會回傳 id 所指的 object，本站的從 datastore 讀取，
+// 其他站的會先找已經收過的版本，沒有的話才向原始伺服器取得並存起來。
+func GetObject(id string, actorUsername string) (map[string]interface{}, error) {
+	if o, err := object.FindObjectByID(id); err == nil {
+		if o.IsTombstone() {
+			return nil, errors.New("object deleted")
+		}
+		if o.GetType() == "Announce" {
+			return newAnnounceActivity(o), nil
+		}
+		return newNoteObject(o), nil
+	}
+
+	if o, err := remoteobject.FindRemoteObjectByID(id); err == nil {
+		return o.ToMap(), nil
+	}
+
+	fetched, err := FetchObject(id, actorUsername, false)
+	if err != nil {
+		return nil, err
+	}
+	// 這邊只放進記憶體中，下次 inbox 收到東西時會一起寫進檔案
+	storeRemoteObject(fetched)
+	return fetched, nil
+}
+
+// storeRemoteObject 會把其他站的 object 清理過後存起來，本站的 object 不需要另外存，
+// o 會被直接修改成清理過的內容，attachment 也會整理成一致的格式。
+func storeRemoteObject(o map[string]interface{}) {
+	normalizeAttachments(o)
+	sanitizeObject(o)
+	if _, err := object.FindObjectByID(getIDFromField(o)); err == nil {
+		return
+	}
+	_, err := remoteobject.StoreRemoteObject(o)
+	if err != nil {
+		slog.Warn("activitypub.storeRemoteObject", "error", err)
+		return
+	}
+	if inReplyTo, _ := o["inReplyTo"].(string); inReplyTo != "" {
+		indexReply(inReplyTo, getIDFromField(o))
+	}
+}
+
+// objectRecipients 會回傳收到過 object 的 actor，也就是 object 的收件人加上轉推過的人，
+// Update 和 Delete 都需要送給這些人。
+func objectRecipients(senderActor *actor.Actor, o *object.Object) []string {
+	targets := map[string]bool{}
+	for _, id := range objectTargets(senderActor, o) {
+		targets[id] = true
+	}
+	for _, id := range o.GetShares() {
+		if _, err := actor.FindActorByFullID(id); err != nil {
+			targets[id] = true
+		}
+	}
+
+	list := []string{}
+	for id := range targets {
+		list = append(list, id)
+	}
+	return list
+}
+
+// SendUpdate 會把編輯過的 object 以 Update 送給當初收到這個 object 的人
+func SendUpdate(senderActor *actor.Actor, o *object.Object) error {
+	slog.Info("SendUpdate", "sender", senderActor.GetUsername(), "object", o.GetFullID())
+
+	if o.GetAttributedTo() != senderActor.GetFullID() {
+		return errors.New("object is not attributed to sender")
+	}
+
+	updateActivity := map[string]interface{}{
+		"@context":  "https://www.w3.org/ns/activitystreams",
+		"id":        o.GetFullID() + "#updates/" + object.GenerateUUIDv7(),
+		"type":      "Update",
+		"actor":     senderActor.GetFullID(),
+		"published": o.GetUpdated(),
+		"to":        o.GetTo(),
+		"cc":        o.GetCC(),
+		"object":    newNoteObject(o),
+	}
+
+	SendActivityToActors(senderActor.GetUsername(), objectRecipients(senderActor, o), updateActivity)
+	return nil
+}
+
+// PostInboxUpdate 會處理送進 inbox 的 Update，
+// 如果被更新的是我們收過的 object，就換成新的版本，timeline 就會顯示最新的內容。
+// actor 自己的 Update 已經在收到時清掉快取了，這邊不需要另外處理。
+func PostInboxUpdate(w http.ResponseWriter, r *http.Request, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxUpdate", "info", "update", "requestMap.object", getIDFromField(requestMap["object"]))
+
+	o, ok := requestMap["object"].(map[string]interface{})
+	if !ok {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	objectID := getIDFromField(o)
+	if t, _ := o["type"].(string); isActorType(t) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// 來源已經在 CheckActivityOrigin 中檢查過，這邊還需要確認是作者本人更新的
+	if getIDFromField(o["attributedTo"]) != getIDFromField(requestMap["actor"]) {
+		slog.Warn("activitypub.PostInboxUpdate", "error", "object not attributed to actor", "object", objectID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if !isKnownRemoteObject(objectID) {
+		slog.Info("activitypub.PostInboxUpdate", "info", "unknown object", "object", objectID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	storeRemoteObject(o)
+	IndexHashtags(objectID, o["tag"])
+	err := remoteobject.SaveRemoteObject("./remote_object.json")
+	if err != nil {
+		slog.Warn("activitypub.PostInboxUpdate", "error", "remote object save error", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// isKnownRemoteObject 會回傳 objectID 是否已經存起來，或是在本站使用者的 inbox 中
+func isKnownRemoteObject(objectID string) bool {
+	if _, err := remoteobject.FindRemoteObjectByID(objectID); err == nil {
+		return true
+	}
+	known := false
+	actor.RangeActors(func(a *actor.Actor) bool {
+		known = a.HasInboxObject(objectID)
+		return !known
+	})
+	return known
+}
@@ -0,0 +1,81 @@
+package activitypub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+)
+
+func TestRemoveMentions(t *testing.T) {
+	type TestCase struct {
+		name      string
+		inReplyTo string
+		cc        []string
+	}
+
+	const bob = "https://remote.example/users/bob"
+	const carol = "https://remote.example/users/carol"
+	author := testActor("mention-author")
+	followers := author.GetFullID() + "/followers"
+
+	// 回覆的對象是 carol 的 note
+	parentID := "https://remote.example/notes/carol"
+	_, err := remoteobject.StoreRemoteObject(map[string]interface{}{"id": parentID, "type": "Note", "attributedTo": carol})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []TestCase{
+		{
+			name: "not a reply",
+			cc:   []string{followers},
+		},
+		{
+			name:      "reply author stays in cc",
+			inReplyTo: parentID,
+			cc:        []string{followers, carol},
+		},
+	}
+
+	for _, tc := range testCases {
+		o := &object.Object{
+			"attributedTo": author.GetFullID(),
+			"inReplyTo":    tc.inReplyTo,
+			"cc":           []string{followers, bob, carol},
+		}
+		o.AddTag("@bob@remote.example", bob)
+		o.AddTag("@carol@remote.example", carol)
+		o.AddHashtag("#go", "https://"+testDomain+"/tags/go")
+
+		RemoveMentions(o)
+		if !reflect.DeepEqual(o.GetCC(), tc.cc) {
+			t.Errorf("%s: GetCC() = %v, expected %v", tc.name, o.GetCC(), tc.cc)
+		}
+		// 只會移除 Mention，hashtag 需要留著
+		if !reflect.DeepEqual(o.GetHashtags(), []string{"#go"}) || len(o.GetTag()) != 1 {
+			t.Errorf("%s: GetTag() = %v, expected only the hashtag", tc.name, o.GetTag())
+		}
+	}
+}
+
+func TestStoreRemoteObjectSanitizesAttachment(t *testing.T) {
+	// 只有一個 PropertyValue 的 attachment 整理成陣列之後也必須是清理過的
+	id := "https://remote.example/users/bob"
+	storeRemoteObject(map[string]interface{}{
+		"id":         id,
+		"type":       "Person",
+		"attachment": map[string]interface{}{"type": "PropertyValue", "name": "site", "value": `<script>alert(1)</script>ok`},
+	})
+
+	o, err := remoteobject.FindRemoteObjectByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{map[string]interface{}{"type": "PropertyValue", "name": "site", "value": "ok"}}
+	if !reflect.DeepEqual(o.ToMap()["attachment"], expected) {
+		t.Errorf("attachment = %v, expected %v", o.ToMap()["attachment"], expected)
+	}
+	remoteobject.RemoveRemoteObject(id)
+}
@@ -2,12 +2,18 @@ package activitypub
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
 	"github.com/pichuchen/hatsuaki/datastore/object"
 )
 
+var (
+	errObjectDeleted    = errors.New("object deleted")
+	errObjectNotVisible = errors.New("object not visible")
+)
+
 func RouteObject(w http.ResponseWriter, r *http.Request) {
 	slog.Debug("activitypub.RouteObject", "request", r.URL.String())
 
@@ -21,7 +27,31 @@ func RouteObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/activity+json")
-	m := map[string]interface{}{}
+
+	// 已經被刪除的 object 回傳 410 Gone 以及 Tombstone
+	if o.IsTombstone() {
+		m := newTombstone(o)
+		m["@context"] = "https://www.w3.org/ns/activitystreams"
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(m)
+		return
+	}
+
+	// 本站送出的 Announce 也存在 object 中，直接回傳整個 activity
+	if o.GetType() == "Announce" {
+		json.NewEncoder(w).Encode(newAnnounceActivity(o))
+		return
+	}
+
+	m := newNoteObject(o)
+
+	// followers 限定或是私訊的 object 只有能看到的人可以取得，其他人就當作不存在
+	if !canViewObject(m, requestViewer(r)) {
+		slog.Warn("activitypub.RouteObject", "error", "object not visible", "object", o.GetFullID())
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "object not found"})
+		return
+	}
 
 	// 在 JSON-LD 的回應中分為兩個大部分，@context 和其他的
 	// @context 理論上是必須，但是實際上實作中大家通常都不會去讀取他，所以比較偏向會給工程師除錯用的。
@@ -34,6 +64,41 @@ func RouteObject(w http.ResponseWriter, r *http.Request) {
 	c = append(c, "https://w3id.org/security/v1")
 	m["@context"] = c
 
+	json.NewEncoder(w).Encode(m)
+}
+
+// findVisibleObject 會找出 viewer 能看到的本站 object，
+// 已經被刪除或是 viewer 看不到的 object 都會回傳錯誤，讓按讚和集合的處理方式和 RouteObject 一致。
+func findVisibleObject(objectID string, viewer string) (*object.Object, error) {
+	o, err := object.FindObjectByID(objectID)
+	if err != nil {
+		return nil, err
+	}
+	if o.IsTombstone() {
+		return nil, errObjectDeleted
+	}
+	if o.GetType() != "Announce" && !canViewObject(newNoteObject(o), viewer) {
+		return nil, errObjectNotVisible
+	}
+	return o, nil
+}
+
+// writeObjectError 會依照 findVisibleObject 的錯誤回傳 410 或 404
+func writeObjectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errObjectDeleted) {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]string{"error": "object deleted"})
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{"error": "object not found"})
+}
+
+// newNoteObject 會把本站的 object 轉成要對外顯示的內容 (不包含 @context)，
+// RouteObject 和送出的 Update 都會使用。
+func newNoteObject(o *object.Object) map[string]interface{} {
+	m := map[string]interface{}{}
+
 	// All objects must have an id and type property
 	m["id"] = o.GetFullID()
 	m["type"] = o.GetType()
@@ -49,6 +114,35 @@ func RouteObject(w http.ResponseWriter, r *http.Request) {
 
 	// 這邊是在 ActivityPub 中的也許 (MAY) 欄位
 	m["inReplyTo"] = o.GetInReplyTo()
-
-	json.NewEncoder(w).Encode(m)
+	if tag := o.GetTag(); len(tag) > 0 {
+		m["tag"] = tag
+	}
+	if attachment := o.GetAttachment(); len(attachment) > 0 {
+		m["attachment"] = attachment
+	}
+	if source, mediaType := o.GetSource(); mediaType != "" {
+		m["source"] = map[string]string{
+			"content":   source,
+			"mediaType": mediaType,
+		}
+	}
+	m["replies"] = map[string]interface{}{
+		"id":         o.GetFullID() + "/replies",
+		"type":       "OrderedCollection",
+		"totalItems": len(o.GetReplies()),
+	}
+	if updated := o.GetUpdated(); updated != "" {
+		m["updated"] = updated
+	}
+	m["likes"] = map[string]interface{}{
+		"id":         o.GetFullID() + "/likes",
+		"type":       "OrderedCollection",
+		"totalItems": len(o.GetLikes()),
+	}
+	m["shares"] = map[string]interface{}{
+		"id":         o.GetFullID() + "/shares",
+		"type":       "OrderedCollection",
+		"totalItems": len(o.GetShares()),
+	}
+	return m
 }
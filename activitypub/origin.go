@@ -0,0 +1,112 @@
+package activitypub
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+)
+
+// 在 inbox 收到的請求，我們能信任的只有簽章的 key 而已，
+// 來源 IP 或是 activity 裡面自己宣稱的 actor 都是可以偽造的。
+// 這邊的檢查是確保 activity 內容和簽署者是同一個來源 (origin)，
+// 避免某個被入侵的伺服器可以用其他站的使用者名義發文。
+
+// CheckActivityOrigin 會檢查 activity 的 actor 是否就是簽署 keyID 的人，
+// 如果內嵌的 object 不是來自同一個來源，則會改向 object 的原始位置重新取得並取代。
+func CheckActivityOrigin(keyID string, activity map[string]interface{}) error {
+	owner, err := GetKeyOwnerByKeyID(keyID)
+	if err != nil {
+		return err
+	}
+
+	actorID := getIDFromField(activity["actor"])
+	if actorID == "" {
+		return errors.New("actor not found in activity")
+	}
+	if actorID != owner {
+		slog.Warn("activitypub.CheckActivityOrigin", "error", "actor not match key owner", "actor", actorID, "owner", owner)
+		return errors.New("actor does not match key owner")
+	}
+
+	// object 只是 ID 的話，之後需要的人會自己去原始位置取得，這邊不需要處理
+	o, ok := activity["object"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	oid := getIDFromField(o)
+	attributedTo := getIDFromField(o["attributedTo"])
+	if oid != "" && isSameOrigin(oid, actorID) && (attributedTo == "" || isSameOrigin(attributedTo, actorID)) {
+		return nil
+	}
+
+	// 沒有 id 的 object 是 transient 的，只能相信和 actor 同一來源的內容
+	if oid == "" {
+		if attributedTo != "" && !isSameOrigin(attributedTo, actorID) {
+			return errors.New("transient object is not attributed to actor origin")
+		}
+		return nil
+	}
+
+	// 內嵌的是本站的 object (例如 Accept 內嵌我們送出的 Follow)，
+	// 本站的資料以我們自己存的為準，處理的地方需要自己和本站資料比對，這邊不需要重新取得
+	activityType, _ := activity["type"].(string)
+	if isSameOrigin(oid, "https://"+config.GetDomain()+"/") {
+		if activityType == "Create" || activityType == "Update" {
+			return errors.New("remote actor cannot create or update local object")
+		}
+		return nil
+	}
+
+	// 內嵌的 object 不是來自 actor 的伺服器，所以不能相信內嵌的內容，
+	// 改向 object 的原始伺服器重新取得一次。
+	slog.Info("activitypub.CheckActivityOrigin", "info", "refetch object from origin", "object", oid, "actor", actorID)
+	fetched, err := FetchObject(oid, "instance.actor", true)
+	if err != nil {
+		return err
+	}
+	if getIDFromField(fetched) != oid {
+		return errors.New("fetched object id does not match")
+	}
+
+	// Create 和 Update 只能由作者本人的伺服器送出，
+	// 至於 Announce 之類的 activity 內嵌其他人的 object 是正常的。
+	if activityType == "Create" || activityType == "Update" {
+		if !isSameOrigin(getIDFromField(fetched["attributedTo"]), actorID) {
+			slog.Warn("activitypub.CheckActivityOrigin", "error", "object not attributed to actor", "object", oid, "actor", actorID)
+			return errors.New("object is not attributed to actor")
+		}
+	}
+
+	activity["object"] = fetched
+	return nil
+}
+
+// isSameOrigin 會檢查兩個 URL 是否有相同的 scheme 和 host
+func isSameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil || ub.Host == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// getIDFromField 會從 actor 或是 object 這類的欄位取出 ID，
+// 這類欄位可能是字串本身，也可能是帶有 id 的物件。
+func getIDFromField(v interface{}) string {
+	switch f := v.(type) {
+	case string:
+		return f
+	case map[string]interface{}:
+		id, _ := f["id"].(string)
+		return id
+	}
+	return ""
+}
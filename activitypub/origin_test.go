@@ -0,0 +1,202 @@
+package activitypub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/remoteactor"
+)
+
+func TestCheckActivityOrigin(t *testing.T) {
+	type TestCase struct {
+		name     string
+		keyID    string
+		activity map[string]interface{}
+		isErr    bool
+	}
+
+	// keyId 帶有 # 的話擁有者就是 # 前面的部分，不需要連線取得
+	const keyID = "https://remote.example/users/bob#main-key"
+	const bob = "https://remote.example/users/bob"
+
+	// 預先放進快取，驗證 key 的擁有者時就不會連線取得 actor
+	_, err := remoteactor.StoreRemoteActor(map[string]interface{}{
+		"id":        bob,
+		"type":      "Person",
+		"inbox":     bob + "/inbox",
+		"publicKey": map[string]interface{}{"id": keyID, "owner": bob, "publicKeyPem": "-----BEGIN PUBLIC KEY-----"},
+	}, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []TestCase{
+		{
+			name:  "object id only",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":   "Like",
+				"actor":  bob,
+				"object": "https://other.example/notes/1",
+			},
+		},
+		{
+			name:  "actor as object",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":   "Like",
+				"actor":  map[string]interface{}{"id": bob},
+				"object": "https://other.example/notes/1",
+			},
+		},
+		{
+			name:  "key not listed by actor",
+			keyID: bob + "#other-key",
+			activity: map[string]interface{}{
+				"type":   "Like",
+				"actor":  bob,
+				"object": "https://other.example/notes/1",
+			},
+			isErr: true,
+		},
+		{
+			name:  "missing actor",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":   "Like",
+				"object": "https://other.example/notes/1",
+			},
+			isErr: true,
+		},
+		{
+			name:  "actor does not match key owner",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":   "Like",
+				"actor":  "https://remote.example/users/alice",
+				"object": "https://other.example/notes/1",
+			},
+			isErr: true,
+		},
+		{
+			name:  "actor on another host",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":   "Like",
+				"actor":  "https://evil.example/users/bob",
+				"object": "https://other.example/notes/1",
+			},
+			isErr: true,
+		},
+		{
+			name:  "embedded object from actor origin",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":  "Create",
+				"actor": bob,
+				"object": map[string]interface{}{
+					"id":           "https://remote.example/notes/1",
+					"type":         "Note",
+					"attributedTo": bob,
+				},
+			},
+		},
+		{
+			name:  "transient object",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":  "Create",
+				"actor": bob,
+				"object": map[string]interface{}{
+					"type": "Note",
+				},
+			},
+		},
+		{
+			name:  "transient object attributed to another origin",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":  "Create",
+				"actor": bob,
+				"object": map[string]interface{}{
+					"type":         "Note",
+					"attributedTo": "https://other.example/users/carol",
+				},
+			},
+			isErr: true,
+		},
+		{
+			name:  "accept of a local follow",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":  "Accept",
+				"actor": bob,
+				"object": map[string]interface{}{
+					"id":     "https://" + testDomain + "/activities/1",
+					"type":   "Follow",
+					"actor":  "https://" + testDomain + "/users/alice",
+					"object": bob,
+				},
+			},
+		},
+		{
+			name:  "create of a local object",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":  "Create",
+				"actor": bob,
+				"object": map[string]interface{}{
+					"id":           "https://" + testDomain + "/notes/1",
+					"type":         "Note",
+					"attributedTo": bob,
+				},
+			},
+			isErr: true,
+		},
+		{
+			name:  "update of a local object",
+			keyID: keyID,
+			activity: map[string]interface{}{
+				"type":  "Update",
+				"actor": bob,
+				"object": map[string]interface{}{
+					"id":   "https://" + testDomain + "/notes/1",
+					"type": "Note",
+				},
+			},
+			isErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := CheckActivityOrigin(tc.keyID, tc.activity)
+		if (err != nil) != tc.isErr {
+			t.Errorf("%s: CheckActivityOrigin() error = %v, expected error %v", tc.name, err, tc.isErr)
+		}
+	}
+}
+
+func TestIsSameOrigin(t *testing.T) {
+	type TestCase struct {
+		a        string
+		b        string
+		expected bool
+	}
+
+	testCases := []TestCase{
+		{"https://example.com/users/alice", "https://example.com/notes/1", true},
+		{"https://Example.com/a", "https://example.COM/b", true},
+		{"https://example.com/a", "https://example.com:8443/a", false},
+		{"https://example.com/a", "http://example.com/a", false},
+		{"https://example.com/a", "https://sub.example.com/a", false},
+		{"https://example.com/a", "/a", false},
+		{"", "", false},
+	}
+
+	for _, tc := range testCases {
+		actual := isSameOrigin(tc.a, tc.b)
+		if actual != tc.expected {
+			t.Errorf("isSameOrigin(%q, %q) = %v, expected %v", tc.a, tc.b, actual, tc.expected)
+		}
+	}
+}
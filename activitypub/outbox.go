@@ -31,8 +31,8 @@ func RouteActorOutbox(w http.ResponseWriter, r *http.Request) {
 
 	page := r.URL.Query().Get("page")
 	if page == "true" {
-		// 如果有 page=true 的參數，則回傳一個 OrderedCollection
-		// 這個 OrderedCollection 會包含所有的 Object
+		// 如果有 page=true 的參數，則回傳一個 OrderedCollectionPage
+		// 可以用 max_id 和 min_id 指定要從哪裡開始
 		RouteActorOutboxPage(w, r, a)
 		return
 	}
@@ -52,14 +52,15 @@ func RouteActorOutbox(w http.ResponseWriter, r *http.Request) {
 	m["type"] = "OrderedCollection"
 	m["totalItems"] = a.GetOutboxObjectsCount()
 	m["first"] = id + "?page=true"
-	m["last"] = id + "?page=true"
+	// min_id=0 會比所有的 UUIDv7 都小，所以會是最舊的一頁
+	m["last"] = id + "?min_id=0&page=true"
 
 	json.NewEncoder(w).Encode(m)
 
 }
 
-// RouteActorOutboxPage 會回傳一個 OrderedCollection
-// 這個 OrderedCollection 會包含所有的 Object
+// RouteActorOutboxPage 會回傳一個 OrderedCollectionPage，新的 Object 排在前面，
+// 每一頁的數量由設定檔的 collection_page_size 決定。
 func RouteActorOutboxPage(w http.ResponseWriter, r *http.Request, a *actor.Actor) {
 	w.Header().Set("Content-Type", "application/activity+json")
 	m := map[string]interface{}{}
@@ -71,33 +72,56 @@ func RouteActorOutboxPage(w http.ResponseWriter, r *http.Request, a *actor.Actor
 
 	id := "https://" + config.GetDomain() + "/.activitypub/actor/" + a.GetUsername() + "/outbox"
 
-	// 這邊是在 ActivityPub 中的必要 (MUST) 欄位
-	m["id"] = id
-	m["type"] = "OrderedCollection"
-	m["totalItems"] = a.GetOutboxObjectsCount()
-	m["first"] = id + "?page=true"
-	m["last"] = id + "?page=true"
-
 	objectIDs, err := a.GetOutboxObjects()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
 		return
 	}
-	orderedItems := []interface{}{}
 
+	// followers 限定或是私訊的 object 只有能看到的人才會出現在 outbox 中，
+	// 要在分頁之前先過濾掉，每一頁的數量才會正確
+	viewer := requestViewer(r)
+	visibleIDs := []string{}
 	for _, oid := range objectIDs {
+		o, err := object.FindObjectByID(oid)
+		if err != nil || o.IsTombstone() {
+			continue
+		}
+		if o.GetType() != "Announce" && !canViewObject(newNoteObject(o), viewer) {
+			continue
+		}
+		visibleIDs = append(visibleIDs, oid)
+	}
+
+	q := r.URL.Query()
+	pageIDs, hasOlder, hasNewer := paginateIDs(visibleIDs, objectCursor, q.Get("max_id"), q.Get("min_id"), config.GetCollectionPageSize())
+
+	// 這邊是在 ActivityPub 中的必要 (MUST) 欄位
+	writePageLinks(m, r, id, pageIDs, objectCursor, hasOlder, hasNewer)
+
+	orderedItems := []interface{}{}
+
+	for _, oid := range pageIDs {
 		o, err := object.FindObjectByID(oid)
 		if err != nil {
 			slog.Warn("activitypub.RouteActorOutboxPage", "error", err.Error())
 			continue
 		}
+		if o.GetType() == "Announce" {
+			announce := newAnnounceActivity(o)
+			delete(announce, "@context")
+			orderedItems = append(orderedItems, announce)
+			continue
+		}
 		activityMap := map[string]interface{}{}
 		actor := "https://" + config.GetDomain() + "/.activitypub/actor/" + a.GetUsername()
 		activityMap["id"] = o.GetFullID() + "/activity"
 		activityMap["type"] = "Create"
 		activityMap["published"] = o.GetPublished()
 		activityMap["actor"] = actor
+		activityMap["to"] = o.GetTo()
+		activityMap["cc"] = o.GetCC()
 
 		objectMap := map[string]interface{}{}
 
@@ -106,6 +130,11 @@ func RouteActorOutboxPage(w http.ResponseWriter, r *http.Request, a *actor.Actor
 		objectMap["published"] = o.GetPublished()
 		objectMap["attributedTo"] = o.GetAttributedTo()
 		objectMap["content"] = o.GetContent()
+		objectMap["to"] = o.GetTo()
+		objectMap["cc"] = o.GetCC()
+		if attachment := o.GetAttachment(); len(attachment) > 0 {
+			objectMap["attachment"] = attachment
+		}
 
 		activityMap["object"] = objectMap
 
@@ -0,0 +1,158 @@
+package activitypub
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#actor-objects
+// 以及 Mastodon 的個人資料欄位: https://docs.joinmastodon.org/spec/activitypub/#PropertyValue
+
+// actorContext 會回傳 actor 使用的 @context，
+// 除了 ActivityStreams 和 security 之外，還有個人資料欄位和 discoverable 使用的自訂欄位。
+func actorContext() []interface{} {
+	c := []interface{}{}
+
+	// 這是必要的部分
+	c = append(c, "https://www.w3.org/ns/activitystreams")
+	c = append(c, "https://w3id.org/security/v1")
+
+	c = append(c, map[string]interface{}{
+		"manuallyApprovesFollowers": "as:manuallyApprovesFollowers",
+		"Hashtag":                   "as:Hashtag",
+		"schema":                    "http://schema.org#",
+		"PropertyValue":             "schema:PropertyValue",
+		"value":                     "schema:value",
+		"toot":                      "http://joinmastodon.org/ns#",
+		"discoverable":              "toot:discoverable",
+	})
+	return c
+}
+
+// newActorObject 會把本站的 actor 轉成要對外顯示的內容 (不包含 @context)，
+// RouteActor 和送出的 Update{Person} 都會使用。
+func newActorObject(a *actor.Actor) map[string]interface{} {
+	m := map[string]interface{}{}
+	baseURL := "https://" + config.GetDomain() + "/.activitypub/actor/" + a.GetUsername()
+
+	// All objects must have an id and type property
+	m["id"] = baseURL
+	m["type"] = "Person"
+
+	// 接下來是在 ActivityPub 中的必要 (MUST) 欄位
+	m["inbox"] = baseURL + "/inbox"
+	m["outbox"] = baseURL + "/outbox"
+
+	// 這邊是在 ActivityPub 中的應該 (SHOULD) 欄位
+	m["following"] = baseURL + "/following"
+	m["followers"] = baseURL + "/followers"
+
+	// 這邊是在 ActivityPub 中的也許 (MAY) 欄位
+	m["liked"] = baseURL + "/liked"
+	// m["streams"] = baseURL + "/streams"
+	// 在 misskey 2024.05 之前的版本，沒有 perferredUsername 會造成更新錯誤。
+	m["preferredUsername"] = a.GetUsername()
+
+	endpoints := map[string]string{}
+	// 有 sharedInbox 的話，可以講低同個 instance follow 同個外部使用者時的訊息量。
+	// 另外在 misskey 2024.05 之前的版本，沒有 sharedInbox 會造成更新錯誤。
+	endpoints["sharedInbox"] = "https://" + config.GetDomain() + "/.activitypub/inbox"
+	m["endpoints"] = endpoints
+
+	// 如果伺服器會有需要跟隨或是被跟隨的話，那就需要有 publicKey 項目
+	publicKey := map[string]string{}
+	publicKey["id"] = baseURL + "#main-key"
+	publicKey["owner"] = baseURL
+	publicKey["publicKeyPem"] = a.GetPublicKey()
+
+	m["publicKey"] = publicKey
+
+	// 使用者設定需要手動核准的話，追蹤請求會先放進待審核清單
+	m["manuallyApprovesFollowers"] = a.GetManuallyApprovesFollowers()
+
+	// 以下是使用者可以在 /1/profile 編輯的個人資料
+	m["url"] = baseURL
+	m["name"] = a.GetName()
+	if m["name"] == "" {
+		m["name"] = a.GetUsername()
+	}
+	summary, _ := a.GetSummary()
+	m["summary"] = summary
+	m["discoverable"] = a.GetDiscoverable()
+	if published := a.GetPublished(); published != "" {
+		m["published"] = published
+	}
+	if icon := a.GetIcon(); icon["url"] != "" {
+		m["icon"] = map[string]string{
+			"type":      "Image",
+			"mediaType": icon["mediaType"],
+			"url":       icon["url"],
+		}
+	}
+	if image := a.GetImage(); image["url"] != "" {
+		m["image"] = map[string]string{
+			"type":      "Image",
+			"mediaType": image["mediaType"],
+			"url":       image["url"],
+		}
+	}
+	attachment := []map[string]string{}
+	for _, f := range a.GetFields() {
+		attachment = append(attachment, map[string]string{
+			"type":  "PropertyValue",
+			"name":  f["name"],
+			"value": f["value"],
+		})
+	}
+	m["attachment"] = attachment
+	if tag := a.GetProfileTag(); len(tag) > 0 {
+		m["tag"] = tag
+	}
+	return m
+}
+
+// RenderProfile 會把使用者輸入的自我介紹和個人資料欄位 (純文字) 轉成 HTML，
+// 網址、提及和 hashtag 的處理和 note 相同，回傳轉換後的自我介紹、欄位以及提及和 hashtag 的 tag。
+// fields 的每一筆需要有 name 和 value，回傳的欄位中 value 是 HTML，source 是原本的 value。
+func RenderProfile(a *actor.Actor, summary string, fields []map[string]string) (string, []map[string]string, []map[string]string) {
+	// ApplyMentions 和 ApplyHashtags 會把 tag 加在 object 上，這邊借用一個不會被存起來的 object 收集
+	tmp := &object.Object{"attributedTo": a.GetFullID()}
+	// 自我介紹和所有欄位共用同一個解析結果，提及的上限也是一起計算
+	mentions := newMentionResolver()
+
+	renderedSummary := ""
+	if strings.TrimSpace(summary) != "" {
+		renderedSummary = renderContent(tmp, mentions, summary, MediaTypePlainText)
+	}
+
+	renderedFields := []map[string]string{}
+	for _, f := range fields {
+		renderedFields = append(renderedFields, map[string]string{
+			"name":   f["name"],
+			"value":  renderInline(tmp, mentions, f["value"], false),
+			"source": f["value"],
+		})
+	}
+	return renderedSummary, renderedFields, tmp.GetTag()
+}
+
+// SendProfileUpdate 會把 senderActor 最新的個人資料以 Update{Person} 送給所有 followers
+func SendProfileUpdate(senderActor *actor.Actor) {
+	slog.Info("SendProfileUpdate", "sender", senderActor.GetUsername())
+
+	updateActivity := map[string]interface{}{
+		"@context": actorContext(),
+		"id":       senderActor.GetFullID() + "#updates/" + object.GenerateUUIDv7(),
+		"type":     "Update",
+		"actor":    senderActor.GetFullID(),
+		"to":       []string{publicAddress},
+		"cc":       []string{senderActor.GetFullID() + "/followers"},
+		"object":   newActorObject(senderActor),
+	}
+
+	SendActivityToActors(senderActor.GetUsername(), senderActor.GetFollowerIDs(), updateActivity)
+}
@@ -0,0 +1,165 @@
+package activitypub
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/remoteactor"
+)
+
+const (
+	// 對方沒有給 Cache-Control 的話，actor 快取會保留的時間
+	remoteActorDefaultTTL = 24 * time.Hour
+	// Cache-Control 的 max-age 會被限制在這個範圍內，
+	// 避免太短造成每個請求都要重新取得，或是太長導致換了 key 之後一直驗證失敗。
+	remoteActorMinTTL = 5 * time.Minute
+	remoteActorMaxTTL = 7 * 24 * time.Hour
+)
+
+// 正在背景更新中的 actor，避免同一個 actor 同時被更新很多次
+var remoteActorRefreshing = &sync.Map{}
+
+// GetRemoteActor 會回傳其他伺服器上的 actor 資料，
+// 快取中沒有的話會馬上向對方取得；快取過期的話會先回傳舊的資料，並在背景更新。
+func GetRemoteActor(actorID string) (*remoteactor.RemoteActor, error) {
+	a, err := remoteactor.FindRemoteActorByID(actorID)
+	if err != nil {
+		return RefreshRemoteActor(actorID)
+	}
+
+	// Cache-Control: no-cache 的 actor 每次使用前都要重新取得，取得失敗的話才使用快取
+	if a.MustRevalidate() {
+		if fresh, err := RefreshRemoteActor(actorID); err == nil {
+			return fresh, nil
+		}
+		return a, nil
+	}
+
+	if a.IsExpired(time.Now()) {
+		if _, loaded := remoteActorRefreshing.LoadOrStore(actorID, true); !loaded {
+			go func() {
+				defer remoteActorRefreshing.Delete(actorID)
+				RefreshRemoteActor(actorID)
+			}()
+		}
+	}
+	return a, nil
+}
+
+// RefreshRemoteActor 會忽略快取，重新向對方伺服器取得 actor 並更新快取
+func RefreshRemoteActor(actorID string) (*remoteactor.RemoteActor, error) {
+	m, header, err := fetchObject(actorID, "instance.actor", false)
+	if err != nil {
+		slog.Warn("activitypub.RefreshRemoteActor", "error", err, "actor", actorID)
+		return nil, err
+	}
+
+	if id, _ := m["id"].(string); id != actorID {
+		slog.Warn("activitypub.RefreshRemoteActor", "error", "actor id not match", "actor", actorID, "id", id)
+		return nil, errors.New("actor id not match")
+	}
+
+	ttl, store, revalidate := parseCacheControl(header)
+	if !store {
+		// 對方不允許儲存 (no-store)，就只在這次使用，不存進快取
+		remoteactor.RemoveRemoteActor(actorID)
+		return remoteactor.NewRemoteActor(m, ttl, revalidate)
+	}
+
+	a, err := remoteactor.StoreRemoteActor(m, ttl, revalidate)
+	if err != nil {
+		slog.Warn("activitypub.RefreshRemoteActor", "error", err, "actor", actorID)
+		return nil, err
+	}
+
+	err = remoteactor.SaveRemoteActor("./remote_actor.json")
+	if err != nil {
+		slog.Warn("activitypub.RefreshRemoteActor", "error", err)
+	}
+	return a, nil
+}
+
+// InvalidateRemoteActor 會把 actor 從快取中移除，
+// 收到該 actor 的 Update 或是 Delete 時呼叫，下次使用時就會重新取得。
+func InvalidateRemoteActor(actorID string) {
+	slog.Info("activitypub.InvalidateRemoteActor", "actor", actorID)
+	remoteactor.RemoveRemoteActor(actorID)
+	err := remoteactor.SaveRemoteActor("./remote_actor.json")
+	if err != nil {
+		slog.Warn("activitypub.InvalidateRemoteActor", "error", err)
+	}
+}
+
+// invalidateRemoteActorByActivity 會檢查 activity 是否為 actor 對自己的 Update 或 Delete，
+// 是的話就讓快取中的 actor 失效。
+func invalidateRemoteActorByActivity(activity map[string]interface{}) {
+	activityType, _ := activity["type"].(string)
+	if activityType != "Update" && activityType != "Delete" {
+		return
+	}
+
+	actorID := getIDFromField(activity["actor"])
+	if actorID == "" || getIDFromField(activity["object"]) != actorID {
+		return
+	}
+
+	// Update 的 object 需要是 actor 才算，Delete 的 object 通常只有 ID 或是 Tombstone
+	if o, ok := activity["object"].(map[string]interface{}); ok && activityType == "Update" {
+		t, _ := o["type"].(string)
+		if !isActorType(t) {
+			return
+		}
+	}
+
+	InvalidateRemoteActor(actorID)
+}
+
+// parseCacheControl 會依照 Cache-Control 決定快取的時間，
+// 第二個回傳值為 false 時代表對方不允許儲存 (no-store)，
+// 第三個回傳值為 true 時代表可以儲存但每次使用前都要重新確認 (no-cache)。
+func parseCacheControl(header http.Header) (time.Duration, bool, bool) {
+	ttl := remoteActorDefaultTTL
+	if header == nil {
+		return ttl, true, false
+	}
+
+	revalidate := false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return 0, false, false
+		case directive == "no-cache":
+			revalidate = true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil {
+				continue
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+
+	if ttl < remoteActorMinTTL {
+		ttl = remoteActorMinTTL
+	}
+	if ttl > remoteActorMaxTTL {
+		ttl = remoteActorMaxTTL
+	}
+	return ttl, true, revalidate
+}
+
+// isActorType 會判斷 type 是否為 actor 的類型
+// https://www.w3.org/TR/activitystreams-vocabulary/#actor-types
+func isActorType(t string) bool {
+	switch t {
+	case "Application", "Group", "Organization", "Person", "Service":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package activitypub
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	type TestCase struct {
+		name       string
+		header     http.Header
+		ttl        time.Duration
+		store      bool
+		revalidate bool
+	}
+
+	cacheControl := func(v string) http.Header {
+		return http.Header{"Cache-Control": []string{v}}
+	}
+
+	testCases := []TestCase{
+		{
+			name:  "no header",
+			ttl:   remoteActorDefaultTTL,
+			store: true,
+		},
+		{
+			name:   "no cache control",
+			header: http.Header{},
+			ttl:    remoteActorDefaultTTL,
+			store:  true,
+		},
+		{
+			name:   "max-age",
+			header: cacheControl("public, max-age=3600"),
+			ttl:    time.Hour,
+			store:  true,
+		},
+		{
+			name:   "max-age below minimum",
+			header: cacheControl("max-age=10"),
+			ttl:    remoteActorMinTTL,
+			store:  true,
+		},
+		{
+			name:   "max-age zero",
+			header: cacheControl("max-age=0"),
+			ttl:    remoteActorMinTTL,
+			store:  true,
+		},
+		{
+			name:   "max-age above maximum",
+			header: cacheControl("max-age=31536000"),
+			ttl:    remoteActorMaxTTL,
+			store:  true,
+		},
+		{
+			name:   "invalid max-age",
+			header: cacheControl("max-age=abc"),
+			ttl:    remoteActorDefaultTTL,
+			store:  true,
+		},
+		{
+			name:   "mixed case and spaces",
+			header: cacheControl(" Max-Age=600 ,PUBLIC"),
+			ttl:    10 * time.Minute,
+			store:  true,
+		},
+		{
+			name:   "no-store",
+			header: cacheControl("max-age=3600, no-store"),
+			ttl:    0,
+			store:  false,
+		},
+		{
+			name:       "no-cache",
+			header:     cacheControl("no-cache"),
+			ttl:        remoteActorDefaultTTL,
+			store:      true,
+			revalidate: true,
+		},
+		{
+			name:       "no-cache with max-age",
+			header:     cacheControl("no-cache, max-age=60"),
+			ttl:        remoteActorMinTTL,
+			store:      true,
+			revalidate: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		ttl, store, revalidate := parseCacheControl(tc.header)
+		if ttl != tc.ttl || store != tc.store || revalidate != tc.revalidate {
+			t.Errorf("%s: parseCacheControl() = %v, %v, %v, expected %v, %v, %v", tc.name, ttl, store, revalidate, tc.ttl, tc.store, tc.revalidate)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package activitypub
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+// 使用者發文時輸入的是純文字或是 Markdown，送出去的 content 則必須是 HTML，
+// 這邊負責把原始內容轉成 HTML，原始內容會另外放在 object 的 source 中，讓之後編輯時可以使用。
+
+const (
+	MediaTypePlainText = "text/plain"
+	MediaTypeMarkdown  = "text/markdown"
+)
+
+// urlPattern 會找出 http 和 https 的網址
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// markdownLinkPattern 會找出 [文字](網址) 這樣的 Markdown 連結
+var markdownLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)]+)\)`)
+
+// markdownCodePattern 會找出 `code` 這樣的行內程式碼
+var markdownCodePattern = regexp.MustCompile("`([^`]+)`")
+
+var (
+	markdownStrongPattern = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownEmPattern     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	markdownDelPattern    = regexp.MustCompile(`~~([^~]+)~~`)
+	markdownListPattern   = regexp.MustCompile(`^\s*(?:[-*+]|\d+\.)\s+`)
+	markdownHeadPattern   = regexp.MustCompile(`^#{1,6}\s+`)
+)
+
+// IsSupportedMediaType 會回傳 RenderContent 是否支援 mediaType
+func IsSupportedMediaType(mediaType string) bool {
+	return mediaType == MediaTypePlainText || mediaType == MediaTypeMarkdown
+}
+
+// RenderContent 會依照 mediaType 把 source 轉成 HTML，不支援的 mediaType 會當成純文字處理，
+// 網址會自動加上連結，提及和 hashtag 則會透過 ApplyMentions 和 ApplyHashtags 加上 tag。
+func RenderContent(o *object.Object, source string, mediaType string) string {
+	return renderContent(o, newMentionResolver(), source, mediaType)
+}
+
+// renderContent 和 RenderContent 相同，但是使用傳入的 mentions 解析提及，
+// 同一份資料分成好幾段轉換時 (例如個人資料) 可以共用解析的結果和上限。
+func renderContent(o *object.Object, mentions *mentionResolver, source string, mediaType string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	if mediaType == MediaTypeMarkdown {
+		return renderMarkdown(o, mentions, source)
+	}
+	return renderPlainText(o, mentions, source)
+}
+
+// renderPlainText 會把空行分隔的段落轉成 <p>，段落中的換行轉成 <br>
+func renderPlainText(o *object.Object, mentions *mentionResolver, source string) string {
+	var b strings.Builder
+	for _, paragraph := range splitParagraphs(strings.Split(source, "\n")) {
+		lines := make([]string, 0, len(paragraph))
+		for _, line := range paragraph {
+			lines = append(lines, renderInline(o, mentions, line, false))
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+// renderMarkdown 會處理常用的 Markdown 語法: 段落、程式碼區塊、引言、清單、標題以及行內的強調和連結，
+// 標題會轉成粗體的段落，因為其他站通常不會顯示 <h1> 之類的標籤。
+func renderMarkdown(o *object.Object, mentions *mentionResolver, source string) string {
+	var b strings.Builder
+	lines := strings.Split(source, "\n")
+	paragraph := []string{}
+	flush := func() {
+		if len(paragraph) > 0 {
+			rendered := make([]string, 0, len(paragraph))
+			for _, line := range paragraph {
+				rendered = append(rendered, renderInline(o, mentions, line, true))
+			}
+			b.WriteString("<p>" + strings.Join(rendered, "<br>") + "</p>")
+			paragraph = []string{}
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			code := []string{}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			quoted := []string{}
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>" + renderMarkdown(o, mentions, strings.Join(quoted, "\n")) + "</blockquote>")
+
+		case markdownListPattern.MatchString(line):
+			flush()
+			tag := markdownListTag(line)
+			b.WriteString("<" + tag + ">")
+			for ; i < len(lines) && markdownListPattern.MatchString(lines[i]) && markdownListTag(lines[i]) == tag; i++ {
+				item := markdownListPattern.ReplaceAllString(lines[i], "")
+				b.WriteString("<li>" + renderInline(o, mentions, item, true) + "</li>")
+			}
+			i--
+			b.WriteString("</" + tag + ">")
+
+		case markdownHeadPattern.MatchString(trimmed):
+			flush()
+			b.WriteString("<p><strong>" + renderInline(o, mentions, markdownHeadPattern.ReplaceAllString(trimmed, ""), true) + "</strong></p>")
+
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// markdownListTag 會回傳清單項目所屬的清單標籤，數字開頭的是 ol，其他是 ul
+func markdownListTag(line string) string {
+	if first := strings.TrimSpace(line); first[0] >= '0' && first[0] <= '9' {
+		return "ol"
+	}
+	return "ul"
+}
+
+// splitParagraphs 會以空行把 lines 分成段落
+func splitParagraphs(lines []string) [][]string {
+	paragraphs := [][]string{}
+	current := []string{}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, current)
+				current = []string{}
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, current)
+	}
+	return paragraphs
+}
+
+// renderInline 會把一行文字轉成 HTML，markdown 為 true 的話另外處理行內程式碼、連結和強調
+func renderInline(o *object.Object, mentions *mentionResolver, text string, markdown bool) string {
+	if !markdown {
+		return renderText(o, mentions, text, false)
+	}
+
+	// 行內程式碼裡面的內容不做任何處理
+	return replaceSegments(text, markdownCodePattern, func(sub []string) string {
+		return "<code>" + html.EscapeString(sub[1]) + "</code>"
+	}, func(s string) string {
+		return replaceSegments(s, markdownLinkPattern, func(sub []string) string {
+			return renderLink(sub[2], renderEmphasis(html.EscapeString(sub[1])))
+		}, func(s string) string {
+			return renderText(o, mentions, s, true)
+		})
+	})
+}
+
+// renderText 會把網址換成連結，其他的文字跳脫之後再加上提及和 hashtag 的連結
+func renderText(o *object.Object, mentions *mentionResolver, text string, markdown bool) string {
+	return replaceSegments(text, urlPattern, func(sub []string) string {
+		return renderLink(sub[0], html.EscapeString(sub[0]))
+	}, func(s string) string {
+		s = html.EscapeString(s)
+		if markdown {
+			s = renderEmphasis(s)
+		}
+		return ApplyHashtags(o, ApplyMentions(o, mentions, s))
+	})
+}
+
+// renderEmphasis 會處理 **粗體**、*斜體* 和 ~~刪除線~~，s 必須是已經跳脫過的文字
+func renderEmphasis(s string) string {
+	s = markdownStrongPattern.ReplaceAllString(s, "<strong>$1</strong>")
+	s = markdownEmPattern.ReplaceAllString(s, "<em>$1</em>")
+	return markdownDelPattern.ReplaceAllString(s, "<del>$1</del>")
+}
+
+// renderLink 會產生連到 href 的 <a>，label 必須是已經跳脫過的 HTML
+func renderLink(href string, label string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">` + label + `</a>`
+}
+
+// replaceSegments 會把 s 中符合 pattern 的部分交給 match 處理，其他部分交給 other 處理，
+// 網址結尾的標點符號 (例如句號) 通常不是網址的一部分，會留給 other 處理。
+func replaceSegments(s string, pattern *regexp.Regexp, match func([]string) string, other func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringSubmatchIndex(s, -1) {
+		end := loc[1]
+		if pattern == urlPattern {
+			end = loc[0] + len(strings.TrimRight(s[loc[0]:loc[1]], ".,;:!?)'"))
+		}
+		sub := []string{}
+		for i := 0; i < len(loc); i += 2 {
+			if loc[i] < 0 {
+				sub = append(sub, "")
+				continue
+			}
+			sub = append(sub, s[loc[i]:min(loc[i+1], end)])
+		}
+		b.WriteString(other(s[last:loc[0]]))
+		b.WriteString(match(sub))
+		last = end
+	}
+	b.WriteString(other(s[last:]))
+	return b.String()
+}
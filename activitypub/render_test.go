@@ -0,0 +1,119 @@
+package activitypub
+
+import (
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+func TestRenderContent(t *testing.T) {
+	type TestCase struct {
+		name      string
+		source    string
+		mediaType string
+		expected  string
+	}
+
+	const linkAttrs = ` rel="nofollow noopener noreferrer" target="_blank"`
+
+	testCases := []TestCase{
+		{
+			name:      "plain paragraphs",
+			source:    "hello\r\nworld\n\n\nnext",
+			mediaType: MediaTypePlainText,
+			expected:  "<p>hello<br>world</p><p>next</p>",
+		},
+		{
+			name:      "plain text is escaped",
+			source:    "<b>x</b> & y",
+			mediaType: MediaTypePlainText,
+			expected:  "<p>&lt;b&gt;x&lt;/b&gt; &amp; y</p>",
+		},
+		{
+			name:      "plain text ignores markdown",
+			source:    "**bold** [link](https://example.org/)",
+			mediaType: MediaTypePlainText,
+			expected:  `<p>**bold** [link](<a href="https://example.org/"` + linkAttrs + `>https://example.org/</a>)</p>`,
+		},
+		{
+			name:      "url",
+			source:    "see https://example.org/a?b=1&c=2 now",
+			mediaType: MediaTypePlainText,
+			expected:  `<p>see <a href="https://example.org/a?b=1&amp;c=2"` + linkAttrs + `>https://example.org/a?b=1&amp;c=2</a> now</p>`,
+		},
+		{
+			name:      "unsupported media type is plain text",
+			source:    "**bold**",
+			mediaType: "text/html",
+			expected:  "<p>**bold**</p>",
+		},
+		{
+			name:      "emphasis",
+			source:    "**bold** *em* ~~del~~",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<p><strong>bold</strong> <em>em</em> <del>del</del></p>",
+		},
+		{
+			name:      "inline code is not processed",
+			source:    "`co*de* <b> #tag`",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<p><code>co*de* &lt;b&gt; #tag</code></p>",
+		},
+		{
+			name:      "link",
+			source:    "[**link**](https://example.org/)",
+			mediaType: MediaTypeMarkdown,
+			expected:  `<p><a href="https://example.org/"` + linkAttrs + `><strong>link</strong></a></p>`,
+		},
+		{
+			name:      "javascript link is not a link",
+			source:    "[bad](javascript:alert(1))",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<p>[bad](javascript:alert(1))</p>",
+		},
+		{
+			name:      "link label is escaped",
+			source:    `[<img src=x onerror=alert(1)>](https://example.org/)`,
+			mediaType: MediaTypeMarkdown,
+			expected:  `<p><a href="https://example.org/"` + linkAttrs + `>&lt;img src=x onerror=alert(1)&gt;</a></p>`,
+		},
+		{
+			name:      "heading",
+			source:    "# Title",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<p><strong>Title</strong></p>",
+		},
+		{
+			name:      "lists",
+			source:    "- a\n- *b*\n\n1. one\n2. two",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<ul><li>a</li><li><em>b</em></li></ul><ol><li>one</li><li>two</li></ol>",
+		},
+		{
+			name:      "blockquote",
+			source:    "> quoted\n> **text**\n\nafter",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<blockquote><p>quoted<br><strong>text</strong></p></blockquote><p>after</p>",
+		},
+		{
+			name:      "code block",
+			source:    "```\n<code> **x**\n\n#tag\n```\nafter",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<pre><code>&lt;code&gt; **x**\n\n#tag</code></pre><p>after</p>",
+		},
+		{
+			name:      "unterminated code block",
+			source:    "```\ncode",
+			mediaType: MediaTypeMarkdown,
+			expected:  "<pre><code>code</code></pre>",
+		},
+	}
+
+	for _, tc := range testCases {
+		o := &object.Object{"attributedTo": testActor("render-author").GetFullID()}
+		actual := RenderContent(o, tc.source, tc.mediaType)
+		if actual != tc.expected {
+			t.Errorf("%s: RenderContent(%q) = %q, expected %q", tc.name, tc.source, actual, tc.expected)
+		}
+	}
+}
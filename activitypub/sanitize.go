@@ -0,0 +1,308 @@
+package activitypub
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+)
+
+// 其他站送來的 content 和 summary 是 HTML，前端會直接顯示，
+// 所以在存進來之前要先把 HTML 清理過，只留下安全的標籤和屬性，避免 XSS。
+// 允許的範圍大致和 Mastodon 相同，可以參考:
+// https://docs.joinmastodon.org/spec/activitypub/#sanitization
+
+// sanitizeAllowedTags 是允許的標籤，其他的標籤會被拿掉，但裡面的文字會保留
+var sanitizeAllowedTags = map[string]bool{
+	"p": true, "br": true, "a": true, "span": true,
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "s": true, "del": true,
+	"code": true, "pre": true, "blockquote": true, "ul": true, "ol": true, "li": true,
+}
+
+// sanitizeDroppedTags 是連同內容都要拿掉的標籤
+var sanitizeDroppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"template": true, "noscript": true, "textarea": true, "title": true, "svg": true, "math": true,
+}
+
+// sanitizeAllowedClasses 是 a 和 span 允許的 class，用在提及 (mention) 和 hashtag 的 h-card 上
+var sanitizeAllowedClasses = map[string]bool{
+	"h-card": true, "u-url": true, "mention": true, "hashtag": true,
+	"invisible": true, "ellipsis": true,
+}
+
+// SanitizeHTML 會把 s 清理成只有允許的標籤和屬性的 HTML，
+// 連結只保留 http 和 https，並且一律加上 rel="nofollow noopener noreferrer"。
+func SanitizeHTML(s string) string {
+	var b strings.Builder
+	stack := []string{}
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(escapeText(s))
+			break
+		}
+		b.WriteString(escapeText(s[:i]))
+		s = s[i:]
+
+		// 註解、DOCTYPE 和 processing instruction 都直接拿掉
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s[4:], "-->")
+			if end < 0 {
+				break
+			}
+			s = s[4+end+3:]
+			continue
+		}
+		if strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?") {
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				break
+			}
+			s = s[end+1:]
+			continue
+		}
+
+		name, attrs, closing, rest, ok := parseTag(s)
+		if !ok {
+			// 不是標籤的 < 當作文字
+			b.WriteString("&lt;")
+			s = s[1:]
+			continue
+		}
+		s = rest
+
+		if sanitizeDroppedTags[name] {
+			if !closing {
+				s = skipElement(s, name)
+			}
+			continue
+		}
+		if !sanitizeAllowedTags[name] {
+			continue
+		}
+
+		if closing {
+			// 沒有對應開頭的結尾標籤直接忽略，中間沒關的標籤在這邊一起關掉
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j] != name {
+					continue
+				}
+				for k := len(stack) - 1; k >= j; k-- {
+					b.WriteString("</" + stack[k] + ">")
+				}
+				stack = stack[:j]
+				break
+			}
+			continue
+		}
+
+		b.WriteString("<" + name)
+		for _, attr := range sanitizeAttributes(name, attrs) {
+			b.WriteString(" " + attr[0] + `="` + html.EscapeString(attr[1]) + `"`)
+		}
+		b.WriteString(">")
+		if name != "br" {
+			stack = append(stack, name)
+		}
+	}
+
+	for j := len(stack) - 1; j >= 0; j-- {
+		b.WriteString("</" + stack[j] + ">")
+	}
+	return b.String()
+}
+
+// sanitizeAttributes 會回傳 name 標籤允許留下的屬性，依照輸出的順序排列
+func sanitizeAttributes(name string, attrs map[string]string) [][2]string {
+	list := [][2]string{}
+	if name != "a" && name != "span" {
+		return list
+	}
+
+	if name == "a" {
+		if href := sanitizeURL(attrs["href"]); href != "" {
+			list = append(list, [2]string{"href", href})
+		}
+	}
+
+	classes := []string{}
+	for _, c := range strings.Fields(attrs["class"]) {
+		if sanitizeAllowedClasses[c] {
+			classes = append(classes, c)
+		}
+	}
+	if len(classes) > 0 {
+		list = append(list, [2]string{"class", strings.Join(classes, " ")})
+	}
+
+	if name == "a" {
+		list = append(list, [2]string{"rel", "nofollow noopener noreferrer"})
+		list = append(list, [2]string{"target", "_blank"})
+	}
+	return list
+}
+
+// sanitizeURL 只允許 http 和 https 的絕對網址，其他的 (例如 javascript:) 回傳空字串
+func sanitizeURL(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return ""
+	}
+	u.Scheme = scheme
+	return u.String()
+}
+
+// escapeText 會把文字重新跳脫，先解開的目的是避免 &amp; 之類的字元被跳脫兩次
+func escapeText(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+// parseTag 會解析 s 開頭的標籤，回傳小寫的標籤名稱、屬性、是否為結尾標籤以及剩下的字串，
+// s 開頭不是合法的標籤時 ok 為 false。
+func parseTag(s string) (name string, attrs map[string]string, closing bool, rest string, ok bool) {
+	i := 1
+	if i < len(s) && s[i] == '/' {
+		closing = true
+		i++
+	}
+	start := i
+	for i < len(s) && isTagNameChar(s[i]) {
+		i++
+	}
+	if i == start || !isASCIILetter(s[start]) {
+		return "", nil, false, s, false
+	}
+	name = strings.ToLower(s[start:i])
+
+	attrs = map[string]string{}
+	for {
+		for i < len(s) && (isSpace(s[i]) || s[i] == '/') {
+			i++
+		}
+		if i >= len(s) {
+			return "", nil, false, s, false
+		}
+		if s[i] == '>' {
+			return name, attrs, closing, s[i+1:], true
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				end := strings.IndexByte(s[i+1:], quote)
+				if end < 0 {
+					return "", nil, false, s, false
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		if _, exists := attrs[key]; !exists && key != "" {
+			attrs[key] = html.UnescapeString(value)
+		}
+	}
+}
+
+// skipElement 會略過 name 標籤的內容，回傳結尾標籤之後的字串
+func skipElement(s string, name string) string {
+	lower := strings.ToLower(s)
+	end := strings.Index(lower, "</"+name)
+	if end < 0 {
+		return ""
+	}
+	gt := strings.IndexByte(s[end:], '>')
+	if gt < 0 {
+		return ""
+	}
+	return s[end+gt+1:]
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isTagNameChar(c byte) bool {
+	return isASCIILetter(c) || ('0' <= c && c <= '9') || c == '-'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// SanitizeObject 和 sanitizeObject 相同，給 fetcher 之類直接把其他站的資料交給前端的地方使用
+func SanitizeObject(o map[string]interface{}) {
+	sanitizeObject(o)
+}
+
+// sanitizeObject 會清理 object (或 actor) 中所有 HTML 欄位，直接修改 o，
+// 包括 content、summary、各語言的 contentMap 和 summaryMap，以及個人資料欄位 (PropertyValue) 的 value。
+func sanitizeObject(o map[string]interface{}) {
+	for _, field := range []string{"content", "summary"} {
+		if v, ok := o[field].(string); ok {
+			o[field] = SanitizeHTML(v)
+		}
+		if m, ok := o[field+"Map"].(map[string]interface{}); ok {
+			for lang, v := range m {
+				if s, ok := v.(string); ok {
+					m[lang] = SanitizeHTML(s)
+				}
+			}
+		}
+	}
+
+	// attachment 可能是陣列，也可能只有一個物件
+	var list []interface{}
+	switch v := o["attachment"].(type) {
+	case []interface{}:
+		list = v
+	case map[string]interface{}:
+		list = []interface{}{v}
+	}
+	for _, v := range list {
+		if a, ok := v.(map[string]interface{}); ok && a["type"] == "PropertyValue" {
+			if s, ok := a["value"].(string); ok {
+				a["value"] = SanitizeHTML(s)
+			}
+		}
+	}
+
+	// Announce 之類的 activity 可能會內嵌 object
+	if inner, ok := o["object"].(map[string]interface{}); ok {
+		sanitizeObject(inner)
+	}
+}
+
+// SanitizeRemoteObjects 會重新清理已經存下來的其他站 object，
+// 用在啟動時處理還沒有清理過的舊資料。
+func SanitizeRemoteObjects() {
+	remoteobject.RangeRemoteObjects(func(o *remoteobject.RemoteObject) bool {
+		sanitizeObject(*o)
+		return true
+	})
+}
@@ -0,0 +1,259 @@
+package activitypub
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// eventHandlerPattern 會找出 onclick= 之類的屬性
+var eventHandlerPattern = regexp.MustCompile(`\son[a-z]+\s*=`)
+
+func TestSanitizeHTML(t *testing.T) {
+	type TestCase struct {
+		name     string
+		input    string
+		expected string
+	}
+
+	const linkAttrs = ` rel="nofollow noopener noreferrer" target="_blank"`
+
+	testCases := []TestCase{
+		{
+			name:     "plain paragraph",
+			input:    `<p>hello <strong>world</strong></p>`,
+			expected: `<p>hello <strong>world</strong></p>`,
+		},
+		{
+			name:     "script",
+			input:    `<p>hi<script>alert(1)</script>there</p>`,
+			expected: `<p>hithere</p>`,
+		},
+		{
+			name:     "mixed case script",
+			input:    `<p>hi<ScRiPt>alert(1)</sCrIpT>there</p>`,
+			expected: `<p>hithere</p>`,
+		},
+		{
+			name:     "unclosed script",
+			input:    `<p>hi<script>alert(1)`,
+			expected: `<p>hi</p>`,
+		},
+		{
+			name:     "script with attributes and spaced end tag",
+			input:    `<script src=x>alert(1)</script >ok`,
+			expected: `ok`,
+		},
+		{
+			name:     "nested script name",
+			input:    `<scr<script>x</script>ipt>alert(1)`,
+			expected: `xipt&gt;alert(1)`,
+		},
+		{
+			name:     "javascript href",
+			input:    `<a href="javascript:alert(1)">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "mixed case javascript href with space",
+			input:    `<a href=" JaVaScRiPt:alert(1)">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "entity encoded javascript href",
+			input:    `<a href="&#106;avascript:alert(1)">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "entity encoded tab in javascript href",
+			input:    `<a href="java&#x09;script:alert(1)">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "data href",
+			input:    `<a href="data:text/html,<script>alert(1)</script>">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "protocol relative href",
+			input:    `<a href="//example.com/">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "unquoted attributes",
+			input:    `<a href=https://example.com/a?b=1&amp;c=2 class=mention>x</a>`,
+			expected: `<a href="https://example.com/a?b=1&amp;c=2" class="mention"` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "single quoted attributes and event handler",
+			input:    `<a href='https://example.com' onclick='alert(1)'>x</a>`,
+			expected: `<a href="https://example.com"` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "quote breaking out of href",
+			input:    `<a href="https://example.com onclick="alert(1)">x</a>`,
+			expected: `<a` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "entity encoded quote in href",
+			input:    `<a href="https://example.com/&quot;onmouseover=&quot;x">x</a>`,
+			expected: `<a href="https://example.com/%22onmouseover=%22x"` + linkAttrs + `>x</a>`,
+		},
+		{
+			name:     "unterminated quote",
+			input:    `<a href="https://example.com>x`,
+			expected: `&lt;a href=&#34;https://example.com&gt;x`,
+		},
+		{
+			name:     "unterminated tag",
+			input:    `<p>a<b`,
+			expected: `<p>a&lt;b</p>`,
+		},
+		{
+			name:     "svg onload",
+			input:    `<svg onload=alert(1)>x</svg>y`,
+			expected: `y`,
+		},
+		{
+			name:     "img onerror",
+			input:    `<p><img src=x onerror=alert(1)>z</p>`,
+			expected: `<p>z</p>`,
+		},
+		{
+			name:     "comment hiding script",
+			input:    `<p>a<!-- <script>alert(1)</script> -->b</p>`,
+			expected: `<p>ab</p>`,
+		},
+		{
+			name:     "unterminated comment",
+			input:    `<p>a<!-- <script>alert(1)</script>`,
+			expected: `<p>a</p>`,
+		},
+		{
+			name:     "doctype and processing instruction",
+			input:    `<!DOCTYPE html><?xml version="1.0"?><p>a</p>`,
+			expected: `<p>a</p>`,
+		},
+		{
+			name:     "stray end tags",
+			input:    `</a>text</p></script>`,
+			expected: `text`,
+		},
+		{
+			name:     "unclosed allowed tags",
+			input:    `<p><strong>bold<em>both</p>`,
+			expected: `<p><strong>bold<em>both</em></strong></p>`,
+		},
+		{
+			name:     "disallowed classes",
+			input:    `<span class="h-card evil">x</span><span class="evil">y</span>`,
+			expected: `<span class="h-card">x</span><span>y</span>`,
+		},
+		{
+			name:     "attributes on other tags",
+			input:    `<p style="color:red" onclick="alert(1)">x</p>`,
+			expected: `<p>x</p>`,
+		},
+		{
+			name:     "bare angle brackets",
+			input:    `a < b > c`,
+			expected: `a &lt; b &gt; c`,
+		},
+		{
+			name:     "escaped text is not escaped twice",
+			input:    `<p>1 &lt; 2 &amp; 3 &amp;amp; 4</p>`,
+			expected: `<p>1 &lt; 2 &amp; 3 &amp;amp; 4</p>`,
+		},
+		{
+			name:     "escaped script stays text",
+			input:    `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`,
+			expected: `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`,
+		},
+		{
+			name:     "mastodon mention",
+			input:    `<p><span class="h-card"><a href="https://example.com/@alice" class="u-url mention">@<span>alice</span></a></span></p>`,
+			expected: `<p><span class="h-card"><a href="https://example.com/@alice" class="u-url mention"` + linkAttrs + `>@<span>alice</span></a></span></p>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		actual := SanitizeHTML(tc.input)
+		if actual != tc.expected {
+			t.Errorf("%s: SanitizeHTML(%q) = %q, expected %q", tc.name, tc.input, actual, tc.expected)
+		}
+
+		// 清理過的結果再清理一次不應該有任何改變，不然存起來的內容每次都會被多跳脫一次
+		if again := SanitizeHTML(actual); again != actual {
+			t.Errorf("%s: SanitizeHTML is not idempotent: %q -> %q", tc.name, actual, again)
+		}
+
+		lower := strings.ToLower(actual)
+		for _, s := range []string{"<script", "<svg", "<img", "javascript:"} {
+			if strings.Contains(lower, s) {
+				t.Errorf("%s: SanitizeHTML(%q) = %q, contains %q", tc.name, tc.input, actual, s)
+			}
+		}
+		if eventHandlerPattern.MatchString(lower) {
+			t.Errorf("%s: SanitizeHTML(%q) = %q, contains an event handler", tc.name, tc.input, actual)
+		}
+	}
+}
+
+func TestSanitizeObject(t *testing.T) {
+	type TestCase struct {
+		name     string
+		input    map[string]interface{}
+		expected map[string]interface{}
+	}
+
+	const dirty = `<p>hi<script>alert(1)</script></p>`
+	const clean = `<p>hi</p>`
+
+	testCases := []TestCase{
+		{
+			name:     "content and summary",
+			input:    map[string]interface{}{"content": dirty, "summary": dirty},
+			expected: map[string]interface{}{"content": clean, "summary": clean},
+		},
+		{
+			name:     "content map",
+			input:    map[string]interface{}{"contentMap": map[string]interface{}{"en": dirty, "ja": dirty}},
+			expected: map[string]interface{}{"contentMap": map[string]interface{}{"en": clean, "ja": clean}},
+		},
+		{
+			name: "property values",
+			input: map[string]interface{}{"attachment": []interface{}{
+				map[string]interface{}{"type": "PropertyValue", "name": "site", "value": dirty},
+				map[string]interface{}{"type": "Document", "url": "https://example.com/a.png", "name": dirty},
+			}},
+			expected: map[string]interface{}{"attachment": []interface{}{
+				map[string]interface{}{"type": "PropertyValue", "name": "site", "value": clean},
+				map[string]interface{}{"type": "Document", "url": "https://example.com/a.png", "name": dirty},
+			}},
+		},
+		{
+			// 只有一個欄位的話 attachment 可能不是陣列
+			name:     "single property value",
+			input:    map[string]interface{}{"attachment": map[string]interface{}{"type": "PropertyValue", "name": "site", "value": dirty}},
+			expected: map[string]interface{}{"attachment": map[string]interface{}{"type": "PropertyValue", "name": "site", "value": clean}},
+		},
+		{
+			name:     "embedded object",
+			input:    map[string]interface{}{"type": "Announce", "object": map[string]interface{}{"content": dirty}},
+			expected: map[string]interface{}{"type": "Announce", "object": map[string]interface{}{"content": clean}},
+		},
+		{
+			name:     "non-string fields",
+			input:    map[string]interface{}{"content": 1, "attachment": "x"},
+			expected: map[string]interface{}{"content": 1, "attachment": "x"},
+		},
+	}
+
+	for _, tc := range testCases {
+		sanitizeObject(tc.input)
+		if !reflect.DeepEqual(tc.input, tc.expected) {
+			t.Errorf("%s: sanitizeObject() = %v, expected %v", tc.name, tc.input, tc.expected)
+		}
+	}
+}
@@ -8,96 +8,306 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pichuchen/hatsuaki/activitypub/signature"
 	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/delivery"
 )
 
-func SendActivity(senderUsername string, recevierActorID string, activity map[string]interface{}) {
-	// 這邊應該要把 activity 送到 recevierActorID 的 inbox
+const (
+	// 第一次失敗之後等待的時間，之後每次失敗都會加倍
+	deliveryRetryBaseInterval = 1 * time.Minute
+	// 重試的間隔最多不會超過這個時間
+	deliveryRetryMaxInterval = 12 * time.Hour
+	// worker 會每隔這段時間檢查一次有沒有需要送出的 Delivery
+	deliveryWorkerInterval = 30 * time.Second
+	// 同時送出的 Delivery 數量上限
+	deliveryConcurrency = 8
+)
 
-	// 首先要先取的對方的 inbox 位置
-	inbox, err := GetInboxByActorID(recevierActorID, false)
+// deliveryTrigger 用來在有新的 Delivery 時叫醒 worker，不用等到下一次 tick
+var deliveryTrigger = make(chan struct{}, 1)
+
+// SendActivity 會把 activity 放進送出佇列，實際的送出由 StartDeliveryWorker 啟動的 worker 負責，
+// 送出失敗的話會依照 exponential backoff 重試，並且在程式重新啟動後繼續。
+func SendActivity(senderUsername string, recevierActorID string, activity map[string]interface{}) {
+	d, err := delivery.NewDelivery(senderUsername, recevierActorID, "", activity)
 	if err != nil {
-		slog.Error("GetInboxByActorID failed", "error", err)
+		slog.Error("SendActivity", "error", err)
 		return
 	}
+	slog.Info("SendActivity", "delivery", d.GetID(), "receiver", recevierActorID)
 
-	// 然後送出 activity
-	activityByte, err := json.Marshal(activity)
+	err = delivery.SaveDelivery("./delivery.json")
 	if err != nil {
-		slog.Error("Marshal activity failed", "error", err)
-		return
+		slog.Error("SendActivity", "error", err)
 	}
+	triggerDelivery()
+}
 
-	slog.Info("SendActivity", "activity", string(activityByte), "receiver", recevierActorID)
-
-	req, err := http.NewRequest("POST", inbox, strings.NewReader(string(activityByte)))
+// SendActivityToActors 會把同一個 activity 送給多個 actor。
+// 這邊會先把整個請求存進佇列，再由 worker 把每個 actor 解析成 inbox，
+// 同一個伺服器上的 actor 如果有 sharedInbox 的話會被合併成同一個 inbox，所以每個 inbox 只會送出一次。
+// 解析 inbox 需要向對方伺服器查詢，所以不會在這邊等待。
+func SendActivityToActors(senderUsername string, receiverActorIDs []string, activity map[string]interface{}) {
+	d, err := delivery.NewFanoutDelivery(senderUsername, receiverActorIDs, activity)
 	if err != nil {
-		slog.Error("Create request failed", "error", err)
+		slog.Error("SendActivityToActors", "error", err)
 		return
 	}
+	slog.Info("SendActivityToActors", "delivery", d.GetID(), "receivers", len(receiverActorIDs))
 
-	req.Header.Set("Content-Type", "application/activity+json")
-	req.Header.Set("Accept", "application/activity+json, application/ld+json")
+	err = delivery.SaveDelivery("./delivery.json")
+	if err != nil {
+		slog.Error("SendActivityToActors", "error", err)
+	}
+	triggerDelivery()
+}
 
-	// Add Date
-	gmtTimeLoc := time.FixedZone("GMT", 0)
-	s := time.Now().In(gmtTimeLoc).Format(http.TimeFormat)
-	req.Header.Add("Date", s)
+// expandFanoutDelivery 會把 NewFanoutDelivery 建立的 Delivery 解析成每個 inbox 各自的 Delivery，
+// 暫時解析不到 inbox 的 actor 就個別放進佇列，之後再重試解析。
+// 新的 Delivery 都建立之後才會移除原本的，所以中途重新啟動的話頂多重複送出，不會遺失。
+func expandFanoutDelivery(d *delivery.Delivery) {
+	inboxes, unresolved := ResolveInboxes(d.GetReceivers())
+	for inbox, actorIDs := range inboxes {
+		nd, err := delivery.NewDelivery(d.GetSender(), "", inbox, d.GetActivity())
+		if err != nil {
+			slog.Error("expandFanoutDelivery", "error", err)
+			continue
+		}
+		slog.Info("expandFanoutDelivery", "delivery", nd.GetID(), "inbox", inbox, "receivers", actorIDs)
+	}
 
-	// Add Host
-	req.Header.Add("Host", req.URL.Host)
+	for _, actorID := range unresolved {
+		nd, err := delivery.NewDelivery(d.GetSender(), actorID, "", d.GetActivity())
+		if err != nil {
+			slog.Error("expandFanoutDelivery", "error", err)
+			continue
+		}
+		slog.Info("expandFanoutDelivery", "delivery", nd.GetID(), "receiver", actorID)
+	}
 
-	// Add Signature
-	senderActor, err := actor.FindActorByUsername(senderUsername)
-	if err != nil {
-		slog.Error("SendActivity", "error", err)
+	delivery.RemoveDelivery(d.GetID())
+}
+
+// ResolveInboxes 會把 actor 解析成 inbox，回傳以 inbox 為 key、送往該 inbox 的 actor 為值的 map，
+// 以及解析失敗的 actor。
+func ResolveInboxes(actorIDs []string) (map[string][]string, []string) {
+	inboxes := map[string][]string{}
+	unresolved := []string{}
+	lock := sync.Mutex{}
+
+	sem := make(chan struct{}, deliveryConcurrency)
+	wg := sync.WaitGroup{}
+	seen := map[string]bool{}
+	for _, actorID := range actorIDs {
+		if seen[actorID] {
+			continue
+		}
+		seen[actorID] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(actorID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			inbox, err := GetInboxByActorID(actorID)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				slog.Warn("ResolveInboxes", "error", err, "actor", actorID)
+				unresolved = append(unresolved, actorID)
+				return
+			}
+			inboxes[inbox] = append(inboxes[inbox], actorID)
+		}(actorID)
+	}
+	wg.Wait()
+	return inboxes, unresolved
+}
+
+func triggerDelivery() {
+	select {
+	case deliveryTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// StartDeliveryWorker 會啟動背景的 worker，負責送出佇列中的 Delivery，
+// 請在讀取完 delivery.json 之後呼叫。
+func StartDeliveryWorker() {
+	go func() {
+		ticker := time.NewTicker(deliveryWorkerInterval)
+		defer ticker.Stop()
+		for {
+			processDueDeliveries()
+			select {
+			case <-ticker.C:
+			case <-deliveryTrigger:
+			}
+		}
+	}()
+}
+
+func processDueDeliveries() {
+	now := time.Now()
+
+	// dead letter 保留 delivery_dead_letter_days 天之後就移除，避免 delivery.json 一直變大
+	deadLetterAfter := time.Duration(config.GetDeliveryDeadLetterDays()) * 24 * time.Hour
+	pruned := delivery.PruneDeadDeliveries(now.Add(-deadLetterAfter))
+	if pruned > 0 {
+		slog.Info("processDueDeliveries", "pruned", pruned)
+	}
+
+	due := delivery.GetDueDeliveries(now)
+	if len(due) == 0 {
+		if pruned > 0 {
+			err := delivery.SaveDelivery("./delivery.json")
+			if err != nil {
+				slog.Error("processDueDeliveries", "error", err)
+			}
+		}
 		return
 	}
-	keyID := fmt.Sprintf("%s#main-key", senderActor.GetFullID())
-	signature.Signature(senderActor.GetPrivateKey(), keyID, req)
 
-	slog.Info("SendActivity", "activity", string(activityByte))
+	// 先把要送給多個 actor 的 Delivery 解析成個別的 inbox，解析出來的 Delivery 這次就會一起送出
+	expanded := false
+	for _, d := range due {
+		if d.IsFanout() {
+			expandFanoutDelivery(d)
+			expanded = true
+		}
+	}
+	if expanded {
+		err := delivery.SaveDelivery("./delivery.json")
+		if err != nil {
+			slog.Error("processDueDeliveries", "error", err)
+		}
+		due = delivery.GetDueDeliveries(now)
+	}
 
-	req.Body = io.NopCloser(strings.NewReader(string(activityByte)))
+	sem := make(chan struct{}, deliveryConcurrency)
+	wg := sync.WaitGroup{}
+	for _, d := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d *delivery.Delivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			attemptDelivery(d)
+		}(d)
+	}
+	wg.Wait()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	err := delivery.SaveDelivery("./delivery.json")
 	if err != nil {
-		slog.Error("SendActivity failed", "error", err)
+		slog.Error("processDueDeliveries", "error", err)
+	}
+}
+
+func attemptDelivery(d *delivery.Delivery) {
+	now := time.Now()
+
+	// 首先要先取的對方的 inbox 位置
+	inbox := d.GetInbox()
+	if inbox == "" {
+		var err error
+		inbox, err = GetInboxByActorID(d.GetReceiver())
+		if err != nil {
+			slog.Warn("GetInboxByActorID failed", "error", err, "delivery", d.GetID())
+			retryOrDeadLetter(d, "", now, err.Error())
+			return
+		}
+		d.SetInbox(inbox)
+	}
+
+	statusCode, err := postActivity(d.GetSender(), inbox, d.GetActivity())
+	if err == nil {
+		slog.Info("SendActivity success", "delivery", d.GetID(), "inbox", inbox)
+		delivery.MarkInboxSuccess(inbox)
+		delivery.RemoveDelivery(d.GetID())
 		return
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Read response body failed", "Error", err)
+	slog.Warn("SendActivity failed", "error", err, "delivery", d.GetID(), "inbox", inbox, "attempts", d.GetAttempts())
+	if isPermanentDeliveryFailure(statusCode) {
+		d.MarkDead(err.Error())
 		return
 	}
+	retryOrDeadLetter(d, inbox, now, err.Error())
+}
 
-	slog.Info("SendActivity response", "body", string(respBody))
+// retryOrDeadLetter 會安排下一次重試，但如果這個 Delivery (或是它的 inbox)
+// 已經失敗超過設定的天數，就放棄並標記為 dead letter。
+func retryOrDeadLetter(d *delivery.Delivery, inbox string, now time.Time, reason string) {
+	deadLetterAfter := time.Duration(config.GetDeliveryDeadLetterDays()) * 24 * time.Hour
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Error("SendActivity failed", "status code", resp.StatusCode)
+	failingSince := d.GetCreatedAt()
+	if inbox != "" {
+		if t := delivery.MarkInboxFailure(inbox, now); t.Before(failingSince) {
+			failingSince = t
+		}
+	}
+	if now.Sub(failingSince) > deadLetterAfter {
+		slog.Warn("SendActivity dead letter", "delivery", d.GetID(), "inbox", inbox, "failingSince", failingSince)
+		d.MarkDead(reason)
 		return
 	}
 
-	slog.Info("SendActivity success", "activity", activity, "receiver", recevierActorID)
+	d.ScheduleRetry(now.Add(deliveryBackoff(d.GetAttempts())), reason)
+}
 
+// deliveryBackoff 會回傳第 attempts 次失敗之後需要等待的時間
+func deliveryBackoff(attempts int) time.Duration {
+	interval := deliveryRetryBaseInterval
+	for i := 0; i < attempts; i++ {
+		interval *= 2
+		if interval >= deliveryRetryMaxInterval {
+			return deliveryRetryMaxInterval
+		}
+	}
+	return interval
 }
 
-// GetInboxByActorID 會回傳 actor 的 inbox 位置，
-// 如果 sign 是 true 的話，則需要對回傳的位置進行簽章
-func GetInboxByActorID(actorID string, sign bool) (string, error) {
-	reqURL := actorID
-	req, err := http.NewRequest("GET", reqURL, nil)
+// isPermanentDeliveryFailure 會判斷這個 status code 是否代表重試也沒有用，
+// 4xx 通常代表對方不接受這個 activity，但 401 (對方可能暫時拿不到我們的 key)、
+// 408 以及 429 是可以之後再試的。
+func isPermanentDeliveryFailure(statusCode int) bool {
+	if statusCode < 400 || statusCode >= 500 {
+		return false
+	}
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// postActivity 會把 activity 簽章之後 POST 到 inbox，
+// 任何 2xx 的回應都視為成功，失敗時會回傳 status code (如果有的話) 以及錯誤。
+func postActivity(senderUsername string, inbox string, activity map[string]interface{}) (int, error) {
+	activityByte, err := json.Marshal(activity)
 	if err != nil {
-		return "", err
+		slog.Error("Marshal activity failed", "error", err)
+		return 0, err
+	}
+
+	slog.Info("SendActivity", "activity", string(activityByte), "inbox", inbox)
+
+	req, err := http.NewRequest("POST", inbox, strings.NewReader(string(activityByte)))
+	if err != nil {
+		slog.Error("Create request failed", "error", err)
+		return 0, err
 	}
 
+	req.Header.Set("Content-Type", "application/activity+json")
 	req.Header.Set("Accept", "application/activity+json, application/ld+json")
+
 	// Add Date
 	gmtTimeLoc := time.FixedZone("GMT", 0)
 	s := time.Now().In(gmtTimeLoc).Format(http.TimeFormat)
@@ -107,74 +317,58 @@ func GetInboxByActorID(actorID string, sign bool) (string, error) {
 	req.Header.Add("Host", req.URL.Host)
 
 	// Add Signature
-	if sign {
-		instanceActor, err := actor.FindActorByUsername("instance.actor")
-		if err != nil {
-			slog.Error("GetInboxByActorID", "error", err)
-			return "", err
-		}
-		keyID := fmt.Sprintf("%s#main-key", instanceActor.GetFullID())
-		signature.Signature(instanceActor.GetPrivateKey(), keyID, req)
+	senderActor, err := actor.FindActorByUsername(senderUsername)
+	if err != nil {
+		slog.Error("SendActivity", "error", err)
+		return 0, err
 	}
+	keyID := fmt.Sprintf("%s#main-key", senderActor.GetFullID())
+	signature.Signature(senderActor.GetPrivateKey(), keyID, req)
+
+	req.Body = io.NopCloser(strings.NewReader(string(activityByte)))
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		slog.Error("GetInboxByActorID", "error", err)
-		return "", err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("status code: %d", resp.StatusCode)
-	}
-
-	respByte, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		slog.Error("Read response body failed", "Error", err)
-		return "", err
+		return resp.StatusCode, err
 	}
 
-	respMap := map[string]interface{}{}
-	err = json.Unmarshal(respByte, &respMap)
-	if err != nil {
-		slog.Error("Unmarshal response body failed", "Error", err, "body", string(respByte))
-		return "", err
+	slog.Info("SendActivity response", "status code", resp.StatusCode, "body", string(respBody))
+
+	// 除了 200 以外，像是 Mastodon 會回傳 202 Accepted，所以只要是 2xx 都算成功
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("status code: %d", resp.StatusCode)
 	}
 
-	slog.Info("Get actor success", "actor", actorID, "Response", respMap)
+	return resp.StatusCode, nil
+}
 
-	errorStr, ok := respMap["error"]
-	if ok {
-		if strings.Contains(errorStr.(string), "Request not signed") {
-			slog.Info("request not signed, retry with signature")
-			return GetInboxByActorID(actorID, true)
-		}
-		slog.Error("Get actor failed", "actor", actorID, "Error", errorStr)
-		return "", errors.New("get actor failed")
+// GetInboxByActorID 會回傳 actor 的 inbox 位置，
+// 如果對方有 sharedInbox 的話會優先回傳 sharedInbox。
+func GetInboxByActorID(actorID string) (string, error) {
+	a, err := GetRemoteActor(actorID)
+	if err != nil {
+		slog.Error("GetInboxByActorID", "error", err)
+		return "", err
 	}
 
 	// 如果有 sharedInbox 的話，就優先回傳 sharedInbox
-	sharedInbox, ok := respMap["endpoints"].(map[string]interface{})["sharedInbox"]
-	if ok {
-		sharedInboxStr, ok := sharedInbox.(string)
-		if ok {
-			return sharedInboxStr, nil
-		}
+	if sharedInbox := a.GetSharedInbox(); sharedInbox != "" {
+		return sharedInbox, nil
 	}
 
-	inbox, ok := respMap["inbox"]
-	if !ok {
+	inbox := a.GetInbox()
+	if inbox == "" {
 		slog.Error("No inbox in actor", "actor", actorID)
 		return "", errors.New("no inbox in actor")
 	}
 
-	inboxStr, ok := inbox.(string)
-	if !ok {
-		slog.Error("Inbox is not string", "inbox", inbox)
-		return "", errors.New("inbox is not string")
-	}
-
-	return inboxStr, nil
-
+	return inbox, nil
 }
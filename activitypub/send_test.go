@@ -0,0 +1,138 @@
+package activitypub
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/delivery"
+)
+
+func TestDeliveryBackoff(t *testing.T) {
+	type TestCase struct {
+		attempts int
+		expected time.Duration
+	}
+
+	testCases := []TestCase{
+		{0, 1 * time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{5, 32 * time.Minute},
+		{9, 512 * time.Minute},
+		{10, deliveryRetryMaxInterval},
+		{1000, deliveryRetryMaxInterval},
+	}
+
+	for _, tc := range testCases {
+		actual := deliveryBackoff(tc.attempts)
+		if actual != tc.expected {
+			t.Errorf("deliveryBackoff(%d) = %v, expected %v", tc.attempts, actual, tc.expected)
+		}
+	}
+}
+
+func TestIsPermanentDeliveryFailure(t *testing.T) {
+	type TestCase struct {
+		statusCode int
+		expected   bool
+	}
+
+	testCases := []TestCase{
+		// 連線失敗時沒有 status code
+		{0, false},
+		{http.StatusBadRequest, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, true},
+		{http.StatusNotFound, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusGone, true},
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, tc := range testCases {
+		actual := isPermanentDeliveryFailure(tc.statusCode)
+		if actual != tc.expected {
+			t.Errorf("isPermanentDeliveryFailure(%d) = %v, expected %v", tc.statusCode, actual, tc.expected)
+		}
+	}
+}
+
+func TestRetryOrDeadLetter(t *testing.T) {
+	type TestCase struct {
+		name         string
+		inbox        string
+		failingSince time.Time
+		now          time.Time
+		dead         bool
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	deadLetterAfter := time.Duration(config.GetDeliveryDeadLetterDays()) * 24 * time.Hour
+
+	testCases := []TestCase{
+		{
+			name: "first failure without inbox",
+			now:  now,
+		},
+		{
+			name:  "first failure of an inbox",
+			inbox: "https://remote.example/inbox/first",
+			now:   now,
+		},
+		{
+			name: "delivery older than the dead letter days",
+			now:  now.Add(deadLetterAfter + time.Hour),
+			dead: true,
+		},
+		{
+			name:         "inbox failing for a while",
+			inbox:        "https://remote.example/inbox/recent",
+			failingSince: now.Add(-time.Hour),
+			now:          now,
+		},
+		{
+			// 新的 Delivery 送到一直失敗的 inbox 也會直接放棄
+			name:         "inbox failing longer than the dead letter days",
+			inbox:        "https://remote.example/inbox/gone",
+			failingSince: now.Add(-deadLetterAfter - time.Hour),
+			now:          now,
+			dead:         true,
+		},
+	}
+
+	for _, tc := range testCases {
+		if !tc.failingSince.IsZero() {
+			delivery.MarkInboxFailure(tc.inbox, tc.failingSince)
+		}
+		d, err := delivery.NewDelivery("alice", "https://remote.example/users/bob", tc.inbox, map[string]interface{}{"type": "Create"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		retryOrDeadLetter(d, tc.inbox, tc.now, "failed")
+		if d.IsDead() != tc.dead {
+			t.Errorf("%s: IsDead() = %v, expected %v", tc.name, d.IsDead(), tc.dead)
+		}
+		if d.GetAttempts() != 1 {
+			t.Errorf("%s: GetAttempts() = %d, expected 1", tc.name, d.GetAttempts())
+		}
+		if !tc.dead {
+			expected := tc.now.Add(deliveryRetryBaseInterval)
+			if !d.GetNextAttemptAt().Equal(expected) {
+				t.Errorf("%s: GetNextAttemptAt() = %v, expected %v", tc.name, d.GetNextAttemptAt(), expected)
+			}
+		}
+		if tc.inbox != "" {
+			if _, ok := delivery.GetInboxFailingSince(tc.inbox); !ok {
+				t.Errorf("%s: inbox failure not recorded", tc.name)
+			}
+		}
+		delivery.RemoveDelivery(d.GetID())
+	}
+}
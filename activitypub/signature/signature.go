@@ -3,16 +3,30 @@ package signature
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-fed/httpsig"
 )
 
+// 參考 Mastodon 的實作，簽章的 Date 最多可以是 12 小時以前，
+// 另外再容許前後 1 小時的時鐘誤差。
+const (
+	SignatureExpirationWindow = 12 * time.Hour
+	SignatureClockSkewMargin  = 1 * time.Hour
+)
+
+// RequiredSignedHeaders 是驗證請求時一定要包含在簽章中的 header
+var RequiredSignedHeaders = []string{httpsig.RequestTarget, "host", "date"}
+
 func VerifySignature(publicKeyPem string, r *http.Request) bool {
 	v, err := httpsig.NewVerifier(r)
 	if err != nil {
@@ -38,35 +52,24 @@ func VerifySignature(publicKeyPem string, r *http.Request) bool {
 		}
 	}
 
-	signature := r.Header.Get("Signature")
-	if signature == "" {
-		slog.Error("Signature header not found")
+	signatureMap, err := ParseSignatureHeader(r.Header.Get("Signature"))
+	if err != nil {
+		slog.Error("Invalid signature header", "Error", err)
 		return false
 	}
 
-	signatureSep := strings.Split(signature, ",")
-	if len(signatureSep) < 2 {
-		slog.Error("Invalid signature header", "Signature", signature)
-		return false
-	}
-	signatureMap := make(map[string]string)
-	for _, s := range signatureSep {
-		pos := strings.Index(s, "=")
-		if pos == -1 {
-			slog.Error("Invalid signature header", "s", s)
-			return false
-		}
-		key := s[:pos]
-		value := s[pos+2 : len(s)-1]
-		signatureMap[key] = value
-	}
-
 	if signatureMap["algorithm"] == "" {
 		slog.Error("Algorithm not found in signature header")
 		return false
 	}
 
-	err = v.Verify(publicKey, httpsig.Algorithm(signatureMap["algorithm"]))
+	// hs2019 的實際演算法由 key 決定，目前我們只支援 RSA 的 key
+	algorithm := signatureMap["algorithm"]
+	if algorithm == "hs2019" {
+		algorithm = string(httpsig.RSA_SHA256)
+	}
+
+	err = v.Verify(publicKey, httpsig.Algorithm(algorithm))
 	if err != nil {
 		slog.Error("Failed to verify signature", "Error", err)
 		return false
@@ -187,38 +190,153 @@ func GeneratePrivateKey() string {
 	}))
 }
 
-// func VerifyRequest(r *http.Request) error {
-// 	sig := r.Header.Get("Signature")
-// 	if sig == "" {
-// 		slog.Warn("Signature header not found")
-// 		return fmt.Errorf("Signature header not found")
-// 	}
-
-// 	// get keyid
-// 	keyId := ""
-// 	sigSep := strings.Split(sig, ",")
-// 	for _, s := range sigSep {
-// 		if strings.Contains(s, "keyId") {
-// 			keyId = strings.Split(s, "=")[1]
-// 			keyId = strings.Trim(keyId, "\"")
-// 			break
-// 		}
-// 	}
-// 	if keyId == "" {
-// 		slog.Warn("keyId not found in signature header")
-// 		return fmt.Errorf("keyId not found in signature header")
-// 	}
-
-// 	pem, err := GetKeyById(keyId)
-// 	if err != nil {
-// 		slog.Warn("Failed to get public key", "Error", err, "keyId", keyId)
-// 		return err
-// 	}
-
-// 	if !VerifySignature(pem, r) {
-// 		slog.Warn("Failed to verify signature")
-// 		return fmt.Errorf("failed to verify signature")
-// 	}
-// 	return nil
-
-// }
+// ParseSignatureHeader 會把 Signature header 拆成 key-value 的 map
+// 舉例來說 keyId="https://example.com/actor#main-key",algorithm="rsa-sha256"
+// 會變成 {"keyId": "https://example.com/actor#main-key", "algorithm": "rsa-sha256"}
+func ParseSignatureHeader(signature string) (map[string]string, error) {
+	if signature == "" {
+		return nil, fmt.Errorf("signature header not found")
+	}
+
+	signatureSep := strings.Split(signature, ",")
+	if len(signatureSep) < 2 {
+		return nil, fmt.Errorf("invalid signature header: %s", signature)
+	}
+	signatureMap := make(map[string]string)
+	for _, s := range signatureSep {
+		pos := strings.Index(s, "=")
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid signature header: %s", s)
+		}
+		key := strings.TrimSpace(s[:pos])
+		value := strings.Trim(strings.TrimSpace(s[pos+1:]), "\"")
+		signatureMap[key] = value
+	}
+	return signatureMap, nil
+}
+
+// VerifyDigest 會檢查 Digest header 是否和 body 的 SHA-256 相符
+func VerifyDigest(r *http.Request, body []byte) error {
+	digest := r.Header.Get("Digest")
+	if digest == "" {
+		return fmt.Errorf("digest header not found")
+	}
+
+	// Digest 可能會帶有多個演算法，例如 SHA-256=xxx,SHA-512=yyy
+	sum := sha256.Sum256(body)
+	expected := base64.StdEncoding.EncodeToString(sum[:])
+	for _, d := range strings.Split(digest, ",") {
+		pos := strings.Index(d, "=")
+		if pos == -1 {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(d[:pos]), "SHA-256") {
+			continue
+		}
+		if strings.TrimSpace(d[pos+1:]) != expected {
+			return fmt.Errorf("digest mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported digest algorithm: %s", digest)
+}
+
+// VerifyDate 會檢查 Date header 和 now 之間的差距是否在允許的範圍內，
+// 避免舊的請求被重新送出 (replay)。
+func VerifyDate(r *http.Request, now time.Time) error {
+	dateStr := r.Header.Get("Date")
+	if dateStr == "" {
+		return fmt.Errorf("date header not found")
+	}
+	date, err := http.ParseTime(dateStr)
+	if err != nil {
+		return fmt.Errorf("invalid date header: %w", err)
+	}
+	if date.After(now.Add(SignatureClockSkewMargin)) {
+		return fmt.Errorf("date is in the future: %s", dateStr)
+	}
+	if date.Before(now.Add(-SignatureExpirationWindow - SignatureClockSkewMargin)) {
+		return fmt.Errorf("date is too old: %s", dateStr)
+	}
+	return nil
+}
+
+// isHeaderSigned 會檢查 Signature 中的 headers 參數是否包含 header
+func isHeaderSigned(headers string, header string) bool {
+	for _, h := range strings.Fields(headers) {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyRequest 會完整驗證一個帶有 HTTP Signature 的請求，包含 Date、Digest 以及簽章本身，
+// 驗證成功的話會回傳簽署用的 keyId。
+// getKeyByID 負責由 keyId 取得 PEM 格式的 public key，
+// 當 refresh 為 true 時代表快取中的 key 驗證失敗 (對方可能換了 key)，需要重新取得，
+// 是否真的重新向對方取得 (例如快取剛更新過就不需要) 由 getKeyByID 決定。
+func VerifyRequest(r *http.Request, body []byte, getKeyByID func(keyID string, refresh bool) (string, error)) (string, error) {
+	signatureMap, err := ParseSignatureHeader(r.Header.Get("Signature"))
+	if err != nil {
+		slog.Warn("Invalid signature header", "Error", err)
+		return "", err
+	}
+
+	keyID := signatureMap["keyId"]
+	if keyID == "" {
+		slog.Warn("keyId not found in signature header")
+		return "", fmt.Errorf("keyId not found in signature header")
+	}
+
+	// (request-target)、host 和 date 一定要簽進去，
+	// 不然截取到的簽章可以換上新的 Date 或是送到其他的網址重複使用
+	for _, h := range RequiredSignedHeaders {
+		if !isHeaderSigned(signatureMap["headers"], h) {
+			slog.Warn("Required header is not signed", "keyId", keyID, "header", h, "headers", signatureMap["headers"])
+			return "", fmt.Errorf("%s is not signed", h)
+		}
+	}
+
+	err = VerifyDate(r, time.Now())
+	if err != nil {
+		slog.Warn("Failed to verify date", "Error", err, "keyId", keyID)
+		return "", err
+	}
+
+	// 有 body 的請求必須把 digest 也一起簽進去，不然 body 可以被任意替換
+	if len(body) > 0 {
+		if !isHeaderSigned(signatureMap["headers"], "digest") {
+			slog.Warn("Digest is not signed", "keyId", keyID, "headers", signatureMap["headers"])
+			return "", fmt.Errorf("digest is not signed")
+		}
+		err = VerifyDigest(r, body)
+		if err != nil {
+			slog.Warn("Failed to verify digest", "Error", err, "keyId", keyID)
+			return "", err
+		}
+	}
+
+	pem, err := getKeyByID(keyID, false)
+	if err != nil {
+		slog.Warn("Failed to get public key", "Error", err, "keyId", keyID)
+		return "", err
+	}
+
+	if VerifySignature(pem, r) {
+		return keyID, nil
+	}
+
+	// 快取的 key 可能已經過期，重新取得一次再驗證
+	pem, err = getKeyByID(keyID, true)
+	if err != nil {
+		slog.Warn("Failed to refresh public key", "Error", err, "keyId", keyID)
+		return "", err
+	}
+
+	if !VerifySignature(pem, r) {
+		slog.Warn("Failed to verify signature", "keyId", keyID)
+		return "", fmt.Errorf("failed to verify signature")
+	}
+	return keyID, nil
+}
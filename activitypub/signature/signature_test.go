@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestVerification(t *testing.T) {
@@ -160,3 +162,139 @@ HwIDAQAB
 		t.Errorf("Expected %s, got %s", expected, publicKeyPem)
 	}
 }
+
+func TestVerifyDigest(t *testing.T) {
+	type TestCase struct {
+		digest   string
+		body     string
+		expected bool
+	}
+
+	testCases := []TestCase{
+		{
+			digest:   "SHA-256=LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=",
+			body:     "foo",
+			expected: true,
+		},
+		{
+			digest:   "sha-256=LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=",
+			body:     "foo",
+			expected: true,
+		},
+		{
+			digest:   "SHA-256=LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=",
+			body:     "bar",
+			expected: false,
+		},
+		{
+			digest:   "",
+			body:     "foo",
+			expected: false,
+		},
+	}
+
+	for ti, tc := range testCases {
+		req := &http.Request{Header: map[string][]string{}}
+		if tc.digest != "" {
+			req.Header.Set("Digest", tc.digest)
+		}
+		actual := VerifyDigest(req, []byte(tc.body)) == nil
+		if actual != tc.expected {
+			t.Errorf("Test case %d failed: expected %v, got %v", ti, tc.expected, actual)
+		}
+	}
+}
+
+func TestVerifyDate(t *testing.T) {
+	now := time.Date(2024, 4, 6, 12, 0, 0, 0, time.UTC)
+
+	type TestCase struct {
+		date     time.Time
+		expected bool
+	}
+
+	testCases := []TestCase{
+		{date: now, expected: true},
+		{date: now.Add(-12 * time.Hour), expected: true},
+		{date: now.Add(30 * time.Minute), expected: true},
+		{date: now.Add(2 * time.Hour), expected: false},
+		{date: now.Add(-14 * time.Hour), expected: false},
+	}
+
+	for ti, tc := range testCases {
+		req := &http.Request{Header: map[string][]string{
+			"Date": {tc.date.Format(http.TimeFormat)},
+		}}
+		actual := VerifyDate(req, now) == nil
+		if actual != tc.expected {
+			t.Errorf("Test case %d failed: expected %v, got %v", ti, tc.expected, actual)
+		}
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	privateKeyPem := GeneratePrivateKey()
+	publicKeyPem := string(Pubout([]byte(privateKeyPem)))
+	body := `{"type":"Follow"}`
+
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest("POST", "https://pichuchen.tw/.activitypub/inbox", strings.NewReader(body))
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		req.Header.Set("Host", "pichuchen.tw")
+		return req
+	}
+	getKey := func(keyID string, refresh bool) (string, error) {
+		return publicKeyPem, nil
+	}
+
+	req := newRequest()
+	err := Signature(privateKeyPem, "https://example.com/actor#main-key", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := VerifyRequest(req, []byte(body), getKey)
+	if err != nil {
+		t.Errorf("expected signature to be valid, got %v", err)
+	}
+	if keyID != "https://example.com/actor#main-key" {
+		t.Errorf("expected keyId %q, got %q", "https://example.com/actor#main-key", keyID)
+	}
+
+	// body 被替換過的話 Digest 就不會相符
+	_, err = VerifyRequest(req, []byte(`{"type":"Create"}`), getKey)
+	if err == nil {
+		t.Errorf("expected tampered body to be rejected")
+	}
+
+	// 用別人的 key 簽的話也不能通過
+	otherKeyPem := string(Pubout([]byte(GeneratePrivateKey())))
+	_, err = VerifyRequest(req, []byte(body), func(keyID string, refresh bool) (string, error) {
+		return otherKeyPem, nil
+	})
+	if err == nil {
+		t.Errorf("expected signature with wrong key to be rejected")
+	}
+
+	// 沒有簽章的請求
+	_, err = VerifyRequest(newRequest(), []byte(body), getKey)
+	if err == nil {
+		t.Errorf("expected unsigned request to be rejected")
+	}
+
+	// 沒有把 date 或 host 簽進去的話，Date 可以被換掉重複使用
+	for _, header := range []string{"Date", "Host"} {
+		req := newRequest()
+		req.Header.Del(header)
+		err := Signature(privateKeyPem, "https://example.com/actor#main-key", req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header == "Date" {
+			req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		}
+		_, err = VerifyRequest(req, []byte(body), getKey)
+		if err == nil {
+			t.Errorf("expected signature without %s to be rejected", header)
+		}
+	}
+}
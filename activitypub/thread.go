@@ -0,0 +1,230 @@
+package activitypub
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+	"github.com/pichuchen/hatsuaki/datastore/reply"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitystreams-vocabulary/#dfn-replies
+
+const (
+	// 往上或往下最多走幾層回覆
+	threadMaxDepth = 40
+	// 往上尋找時最多向其他伺服器取得幾次，避免一串很長的討論讓請求一直卡住
+	threadMaxFetch = 10
+	// 往下最多回傳幾個回覆
+	threadMaxDescendants = 200
+)
+
+// RouteObjectReplies 會回傳回覆 object 的 object 清單
+// 舉例來說會像是 GET /.activitypub/object/{object}/replies
+func RouteObjectReplies(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("activitypub.RouteObjectReplies", "request", r.URL.String())
+
+	viewerID := requestViewer(r)
+	o, err := findVisibleObject(r.PathValue("object"), viewerID)
+	if err != nil {
+		writeObjectError(w, err)
+		return
+	}
+
+	// 看不到的回覆不會出現在清單中
+	replies := []string{}
+	for _, id := range o.GetReplies() {
+		if m, ok := lookupKnownObject(id); ok && !canViewObject(m, viewerID) {
+			continue
+		}
+		replies = append(replies, id)
+	}
+	writeIDCollection(w, r, o.GetFullID()+"/replies", replies, false)
+}
+
+// recordReply 會把 replyID 加進回覆的索引，parentID 是本站的 object 時也會記錄為它的回覆
+func recordReply(parentID string, replyID string) {
+	if parentID == "" {
+		return
+	}
+	indexReply(parentID, replyID)
+	parent, err := object.FindObjectByID(parentID)
+	if err != nil || parent.IsTombstone() {
+		return
+	}
+	parent.AddReply(replyID)
+}
+
+// removeReply 會把 replyID 從回覆的索引中移除，parentID 是本站的 object 時也會從它的回覆中移除
+func removeReply(parentID string, replyID string) {
+	if parentID == "" {
+		return
+	}
+	reply.RemoveReply(parentID, replyID)
+	saveReplyIndex()
+	parent, err := object.FindObjectByID(parentID)
+	if err != nil {
+		return
+	}
+	parent.RemoveReply(replyID)
+}
+
+// GetThread 會回傳 id 所在的討論串，ancestors 是由最上層開始往下排列的上層 object，
+// descendants 是已知的回覆 (包含回覆的回覆)，依照發布時間排列。
+// 上層的 object 如果不在本站的話會向其他伺服器取得，但最多只會取得 threadMaxFetch 次。
+func GetThread(id string, actorUsername string) (ancestors []map[string]interface{}, o map[string]interface{}, descendants []map[string]interface{}, err error) {
+	o, err = GetObject(id, actorUsername)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 討論串中只會出現使用者看得到的 object
+	viewerID := ""
+	if a, err := actor.FindActorByUsername(actorUsername); err == nil {
+		viewerID = a.GetFullID()
+	}
+	if !canViewObject(o, viewerID) {
+		return nil, nil, nil, errors.New("object not visible")
+	}
+
+	fetchBudget := threadMaxFetch
+	seen := map[string]bool{getIDFromField(o): true}
+	parentID, _ := o["inReplyTo"].(string)
+	for depth := 0; parentID != "" && depth < threadMaxDepth && !seen[parentID]; depth++ {
+		seen[parentID] = true
+		parent, ok := lookupThreadObject(parentID, actorUsername, &fetchBudget)
+		if !ok || !canViewObject(parent, viewerID) {
+			break
+		}
+		ancestors = append([]map[string]interface{}{parent}, ancestors...)
+		parentID, _ = parent["inReplyTo"].(string)
+	}
+
+	queue := []string{getIDFromField(o)}
+	for depth := 0; len(queue) > 0 && depth < threadMaxDepth; depth++ {
+		next := []string{}
+		for _, pid := range queue {
+			for _, cid := range reply.GetReplyIDs(pid) {
+				if seen[cid] || len(descendants) >= threadMaxDescendants {
+					continue
+				}
+				child, ok := lookupReplyObject(cid)
+				if !ok || !canViewObject(child, viewerID) {
+					continue
+				}
+				seen[cid] = true
+				descendants = append(descendants, child)
+				next = append(next, cid)
+			}
+		}
+		queue = next
+	}
+
+	sort.SliceStable(descendants, func(i, j int) bool {
+		pi, _ := descendants[i]["published"].(string)
+		pj, _ := descendants[j]["published"].(string)
+		return pi < pj
+	})
+	return ancestors, o, descendants, nil
+}
+
+// lookupThreadObject 會先從本站和已經收過的 object 中尋找，
+// 都找不到的話，在 fetchBudget 還有剩的情況下向其他伺服器取得。
+func lookupThreadObject(id string, actorUsername string, fetchBudget *int) (map[string]interface{}, bool) {
+	if o, err := object.FindObjectByID(id); err == nil {
+		if o.IsTombstone() {
+			return nil, false
+		}
+		return newNoteObject(o), true
+	}
+	if o, err := remoteobject.FindRemoteObjectByID(id); err == nil {
+		return o.ToMap(), true
+	}
+	if *fetchBudget <= 0 {
+		return nil, false
+	}
+	*fetchBudget--
+
+	o, err := GetObject(id, actorUsername)
+	if err != nil {
+		slog.Warn("activitypub.lookupThreadObject", "id", id, "error", err)
+		return nil, false
+	}
+	return o, true
+}
+
+// lookupKnownObject 會從本站和已經收過的 object 中尋找 id
+func lookupKnownObject(id string) (map[string]interface{}, bool) {
+	if o, err := object.FindObjectByID(id); err == nil {
+		return newNoteObject(o), true
+	}
+	if o, err := remoteobject.FindRemoteObjectByID(id); err == nil {
+		return o.ToMap(), true
+	}
+	return nil, false
+}
+
+// lookupReplyObject 會從本站和已經收過的 object 中尋找回覆，已經被刪除的不會回傳
+func lookupReplyObject(id string) (map[string]interface{}, bool) {
+	if o, err := object.FindObjectByID(id); err == nil {
+		if o.IsTombstone() || o.GetType() != "Note" {
+			return nil, false
+		}
+		return newNoteObject(o), true
+	}
+	if o, err := remoteobject.FindRemoteObjectByID(id); err == nil {
+		return o.ToMap(), true
+	}
+	return nil, false
+}
+
+// indexReply 會把 replyID 加進回覆的索引並儲存
+func indexReply(parentID string, replyID string) {
+	if parentID == "" {
+		return
+	}
+	reply.AddReply(parentID, replyID)
+	saveReplyIndex()
+}
+
+func saveReplyIndex() {
+	err := reply.SaveReply("./reply.json")
+	if err != nil {
+		slog.Warn("activitypub.saveReplyIndex", "error", "reply save error", "err", err)
+	}
+}
+
+// RebuildReplyIndex 會掃過本站和已經收過的 object，重新建立回覆的索引，
+// 只有在 reply.json 還不存在 (例如從舊版升級) 時需要使用。
+func RebuildReplyIndex() {
+	object.RangeObjects(func(o *object.Object) bool {
+		if o.IsTombstone() || o.GetType() != "Note" || o.GetInReplyTo() == "" {
+			return true
+		}
+		reply.AddReply(o.GetInReplyTo(), o.GetFullID())
+		return true
+	})
+	remoteobject.RangeRemoteObjects(func(o *remoteobject.RemoteObject) bool {
+		if o.GetInReplyTo() == "" {
+			return true
+		}
+		reply.AddReply(o.GetInReplyTo(), o.GetID())
+		return true
+	})
+	saveReplyIndex()
+}
+
+// SetReplyTarget 會把 o 設定為 parent 的回覆，並把 parent 的作者加進收件人，
+// 如果 parent 是本站的 object，也會記錄在 parent 的回覆中。
+func SetReplyTarget(o *object.Object, parent map[string]interface{}) {
+	parentID := getIDFromField(parent)
+	o.SetInReplyTo(parentID)
+	if authorID := getIDFromField(parent["attributedTo"]); authorID != "" && authorID != o.GetAttributedTo() {
+		o.AddCC(authorID)
+	}
+	recordReply(parentID, o.GetFullID())
+}
@@ -0,0 +1,87 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+func TestRouteObjectReplies(t *testing.T) {
+	type TestCase struct {
+		name       string
+		object     string
+		statusCode int
+		totalItems int
+	}
+
+	author := testActor("thread-author")
+	newNote := func(visibility string) *object.Object {
+		o := object.NewNote()
+		o.SetAttributedTo(author.GetFullID())
+		o.SetContent("hi")
+		if err := SetVisibility(o, author, visibility); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	public := newNote("public")
+	publicReply := newNote("public")
+	SetReplyTarget(publicReply, newNoteObject(public))
+	hiddenReply := newNote("followers")
+	SetReplyTarget(hiddenReply, newNoteObject(public))
+
+	followersOnly := newNote("followers")
+	deleted := newNote("public")
+	deleted.Tombstone()
+
+	testCases := []TestCase{
+		{
+			// 看不到的回覆不會被計算
+			name:       "public",
+			object:     public.GetID(),
+			statusCode: http.StatusOK,
+			totalItems: 1,
+		},
+		{
+			name:       "followers only",
+			object:     followersOnly.GetID(),
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "deleted",
+			object:     deleted.GetID(),
+			statusCode: http.StatusGone,
+		},
+		{
+			name:       "not found",
+			object:     "unknown",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest("GET", "/.activitypub/object/"+tc.object+"/replies", nil)
+		r.SetPathValue("object", tc.object)
+		w := httptest.NewRecorder()
+		RouteObjectReplies(w, r)
+		if w.Code != tc.statusCode {
+			t.Errorf("%s: status code = %d, expected %d", tc.name, w.Code, tc.statusCode)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		m := map[string]interface{}{}
+		if err := json.NewDecoder(w.Body).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		if m["totalItems"] != float64(tc.totalItems) {
+			t.Errorf("%s: totalItems = %v, expected %d", tc.name, m["totalItems"], tc.totalItems)
+		}
+	}
+}
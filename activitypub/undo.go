@@ -0,0 +1,103 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+)
+
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#undo-activity-inbox
+
+// PostInboxUndo 會處理送進 inbox 的 Undo activity，
+// localActor 是收到的 inbox 的擁有者，如果是 shared inbox 的話會是 nil。
+func PostInboxUndo(w http.ResponseWriter, r *http.Request, localActor *actor.Actor, requestMap map[string]interface{}) {
+	slog.Info("activitypub.PostInboxUndo", "info", "undo", "requestMap.object", requestMap["object"])
+
+	actorID := getIDFromField(requestMap["actor"])
+
+	// Undo 的 object 可能是整個被取消的 activity，也可能只有 ID
+	undoType := ""
+	if o, ok := requestMap["object"].(map[string]interface{}); ok {
+		undoType, _ = o["type"].(string)
+	}
+
+	var err error
+	switch undoType {
+	case "Follow":
+		err = undoFollow(localActor, actorID, requestMap["object"])
+	case "Like":
+		err = undoLike(actorID, requestMap["object"])
+	case "Announce":
+		err = undoAnnounce(actorID, requestMap["object"])
+	case "":
+		// 只有 ID 的話不知道被取消的是什麼，依序從記錄中尋找
+		err = undoFollow(localActor, actorID, requestMap["object"])
+		if err != nil {
+			err = undoLike(actorID, requestMap["object"])
+		}
+		if err != nil {
+			err = undoAnnounce(actorID, requestMap["object"])
+		}
+	default:
+		slog.Info("activitypub.PostInboxUndo", "info", "unsupported undo type", "type", undoType)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err != nil {
+		slog.Warn("activitypub.PostInboxUndo", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad request"})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// undoFollow 會把 followerID 從被追蹤的本站 actor 的 followers 中移除並儲存。
+// follow 可能是內嵌的 Follow activity，或是 Follow activity 的 ID。
+func undoFollow(localActor *actor.Actor, followerID string, follow interface{}) error {
+	var target *actor.Actor
+
+	switch f := follow.(type) {
+	case map[string]interface{}:
+		// 只能取消自己送出的 Follow
+		if getIDFromField(f["actor"]) != followerID {
+			return errors.New("follow actor does not match undo actor")
+		}
+		a, err := actor.FindActorByFullID(getIDFromField(f["object"]))
+		if err != nil {
+			return err
+		}
+		target = a
+	case string:
+		// 只有 ID 的話，要從當初記錄的 Follow activity 中找出是追蹤了誰
+		actor.RangeActors(func(a *actor.Actor) bool {
+			if localActor != nil && a != localActor {
+				return true
+			}
+			if id, ok := a.FindFollowerByFollowActivityID(f); ok && id == followerID {
+				target = a
+				return false
+			}
+			return true
+		})
+		if target == nil {
+			return errors.New("follow activity not found")
+		}
+	default:
+		return errors.New("object type error")
+	}
+
+	if localActor != nil && target != localActor {
+		return errors.New("follow object does not match inbox owner")
+	}
+
+	slog.Info("activitypub.undoFollow", "actor", target.GetUsername(), "follower", followerID)
+	target.RemoveFollowerID(followerID)
+	target.RemovePendingFollower(followerID)
+	return actor.SaveActor("./actor.json")
+}
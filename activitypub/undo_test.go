@@ -0,0 +1,123 @@
+package activitypub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUndoFollow(t *testing.T) {
+	type TestCase struct {
+		name       string
+		shared     bool
+		followerID string
+		follow     func(target string) interface{}
+		isErr      bool
+	}
+
+	const bob = "https://remote.example/users/bob"
+	const followID = "https://remote.example/follows/1"
+
+	testCases := []TestCase{
+		{
+			name:       "embedded follow",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return map[string]interface{}{"id": followID, "type": "Follow", "actor": bob, "object": target}
+			},
+		},
+		{
+			name:       "embedded follow with actor object",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return map[string]interface{}{"type": "Follow", "actor": map[string]interface{}{"id": bob}, "object": target}
+			},
+		},
+		{
+			// 不能取消其他人送出的 Follow
+			name:       "embedded follow of another actor",
+			followerID: "https://remote.example/users/carol",
+			follow: func(target string) interface{} {
+				return map[string]interface{}{"id": followID, "type": "Follow", "actor": bob, "object": target}
+			},
+			isErr: true,
+		},
+		{
+			name:       "embedded follow of another local actor",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return map[string]interface{}{"id": followID, "type": "Follow", "actor": bob, "object": testActor("undo-other").GetFullID()}
+			},
+			isErr: true,
+		},
+		{
+			name:       "embedded follow of a remote actor",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return map[string]interface{}{"id": followID, "type": "Follow", "actor": bob, "object": "https://other.example/users/dave"}
+			},
+			isErr: true,
+		},
+		{
+			name:       "follow id",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return followID
+			},
+		},
+		{
+			name:       "follow id through the shared inbox",
+			shared:     true,
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return followID
+			},
+		},
+		{
+			name:       "unknown follow id",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return "https://remote.example/follows/unknown"
+			},
+			isErr: true,
+		},
+		{
+			// ID 對應到的 Follow 是其他人送出的
+			name:       "follow id of another actor",
+			followerID: "https://remote.example/users/carol",
+			follow: func(target string) interface{} {
+				return followID
+			},
+			isErr: true,
+		},
+		{
+			name:       "invalid object",
+			followerID: bob,
+			follow: func(target string) interface{} {
+				return 1
+			},
+			isErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		a := testActor("undo" + string(rune('a'+i)))
+		a.AppendFollowerID(bob)
+		a.SetFollowActivityID(bob, followID)
+
+		localActor := a
+		if tc.shared {
+			localActor = nil
+		}
+		err := undoFollow(localActor, tc.followerID, tc.follow(a.GetFullID()))
+		if (err != nil) != tc.isErr {
+			t.Errorf("%s: undoFollow() error = %v, expected error %v", tc.name, err, tc.isErr)
+		}
+		following := slices.Contains(a.GetFollowerIDs(), bob)
+		if following != tc.isErr {
+			t.Errorf("%s: still following = %v, expected %v", tc.name, following, tc.isErr)
+		}
+
+		// RemoveFollowerID 也會移除 Follow activity 的紀錄，之後透過 shared inbox 的案例才不會找到這個 actor
+		a.RemoveFollowerID(bob)
+	}
+}
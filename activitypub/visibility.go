@@ -0,0 +1,230 @@
+package activitypub
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+// 在 ActivityPub 中並沒有「可見度」這個欄位，而是由 to 和 cc 的收件人決定，
+// 這邊使用和 Mastodon 相同的對應方式:
+//
+//   - public:    to 是 Public，cc 是 followers，會出現在公開的時間軸
+//   - unlisted:  to 是 followers，cc 是 Public，任何人都能看到，但不會出現在公開的時間軸
+//   - followers: to 是 followers，只有 followers 和提到的人能看到
+//   - direct:    只有提到的人能看到
+const (
+	VisibilityPublic    = "public"
+	VisibilityUnlisted  = "unlisted"
+	VisibilityFollowers = "followers"
+	VisibilityDirect    = "direct"
+)
+
+const publicAddress = "https://www.w3.org/ns/activitystreams#Public"
+
+// SetVisibility 會依照 visibility 設定 o 的 to 和 cc，visibility 為空字串的話視為 public
+func SetVisibility(o *object.Object, senderActor *actor.Actor, visibility string) error {
+	followers := senderActor.GetFullID() + "/followers"
+	switch visibility {
+	case VisibilityPublic, "":
+		o.AddTo(publicAddress)
+		o.AddCC(followers)
+	case VisibilityUnlisted:
+		o.AddTo(followers)
+		o.AddCC(publicAddress)
+	case VisibilityFollowers:
+		o.AddTo(followers)
+	case VisibilityDirect:
+		// 收件人只有之後加進來的、被提到的人
+	default:
+		return errors.New("unknown visibility: " + visibility)
+	}
+	return nil
+}
+
+// objectVisibility 會從 object 的收件人判斷可見度
+func objectVisibility(o map[string]interface{}) string {
+	if addressedIn(o, "to", publicAddress) {
+		return VisibilityPublic
+	}
+	if addressedIn(o, "cc", publicAddress) {
+		return VisibilityUnlisted
+	}
+
+	authorID := getIDFromField(o["attributedTo"])
+	for _, id := range addressedIDs(o, "to", "cc") {
+		if id == authorID+"/followers" || strings.HasSuffix(id, "/followers") {
+			return VisibilityFollowers
+		}
+	}
+	return VisibilityDirect
+}
+
+// canViewObject 會回傳 viewerID (沒有驗證身分的話是空字串) 是否可以看到 object，
+// 公開和不列出的任何人都能看，其他的只有作者、收件人以及 (followers 限定的話) followers 可以看。
+func canViewObject(o map[string]interface{}, viewerID string) bool {
+	visibility := objectVisibility(o)
+	if visibility == VisibilityPublic || visibility == VisibilityUnlisted {
+		return true
+	}
+	if viewerID == "" {
+		return false
+	}
+
+	authorID := getIDFromField(o["attributedTo"])
+	if viewerID == authorID {
+		return true
+	}
+	for _, id := range addressedIDs(o, "to", "cc", "bto", "bcc", "audience") {
+		if id == viewerID {
+			return true
+		}
+	}
+
+	if visibility == VisibilityFollowers {
+		if author, err := actor.FindActorByFullID(authorID); err == nil {
+			for _, id := range author.GetFollowerIDs() {
+				if id == viewerID {
+					return true
+				}
+			}
+		}
+		// 其他站的作者只能從本站使用者的追蹤清單判斷
+		if viewer, err := actor.FindActorByFullID(viewerID); err == nil && isFollowing(viewer, authorID) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanViewNote 會回傳 viewerID (沒有登入的話是空字串) 是否可以看到本站的 object o，規則和 canViewObject 相同
+func CanViewNote(o *object.Object, viewerID string) bool {
+	return canViewObject(newNoteObject(o), viewerID)
+}
+
+// CanViewObject 會回傳 viewerID 是否可以看到 GetObject 取得的 object m (本站或其他站的)，規則和 canViewObject 相同
+func CanViewObject(m map[string]interface{}, viewerID string) bool {
+	return canViewObject(m, viewerID)
+}
+
+// localUserVerifier 會驗證本站使用者的 API token 並回傳使用者名稱，
+// token 的格式是由 API 決定的，所以由 SetLocalUserVerifier 在啟動時設定，activitypub 不直接依賴 API。
+var localUserVerifier func(r *http.Request) (string, error)
+
+// SetLocalUserVerifier 會設定驗證本站使用者 token 的方式，例如 auth.VerifyRequest
+func SetLocalUserVerifier(f func(r *http.Request) (string, error)) {
+	localUserVerifier = f
+}
+
+// verifyLocalUser 會使用 SetLocalUserVerifier 設定的方式驗證本站使用者，回傳使用者名稱
+func verifyLocalUser(r *http.Request) (string, error) {
+	if localUserVerifier == nil {
+		return "", errors.New("local user verifier not set")
+	}
+	return localUserVerifier(r)
+}
+
+// requestViewer 會回傳發出請求的人的 actor ID，
+// 本站的使用者使用 API 的 token，其他站則是使用 HTTP Signature，都沒有的話回傳空字串。
+func requestViewer(r *http.Request) string {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		username, err := verifyLocalUser(r)
+		if err != nil {
+			return ""
+		}
+		a, err := actor.FindActorByUsername(username)
+		if err != nil {
+			return ""
+		}
+		return a.GetFullID()
+	}
+
+	if r.Header.Get("Signature") != "" {
+		actorID, err := VerifyFetchRequest(r)
+		if err != nil {
+			return ""
+		}
+		return actorID
+	}
+	return ""
+}
+
+// localRecipients 會回傳收到 activity 的本站使用者，
+// 包括直接被指定為收件人的使用者，以及 (公開或是送給 followers 的話) 追蹤作者的使用者。
+func localRecipients(activity map[string]interface{}, o map[string]interface{}) []*actor.Actor {
+	authorID := getIDFromField(o["attributedTo"])
+	followersID := authorID + "/followers"
+	if ra, err := GetRemoteActor(authorID); err == nil && ra.GetFollowers() != "" {
+		followersID = ra.GetFollowers()
+	}
+
+	recipients := map[*actor.Actor]bool{}
+	toFollowers := false
+	for _, m := range []map[string]interface{}{activity, o} {
+		for _, id := range addressedIDs(m, "to", "cc", "bto", "bcc", "audience") {
+			if id == publicAddress || id == "as:Public" || id == "Public" || id == followersID {
+				toFollowers = true
+				continue
+			}
+			if !isSameOrigin(id, "https://"+config.GetDomain()+"/") {
+				continue
+			}
+			if a, err := actor.FindActorByFullID(id); err == nil {
+				recipients[a] = true
+			}
+		}
+	}
+
+	if toFollowers {
+		actor.RangeActors(func(a *actor.Actor) bool {
+			if isFollowing(a, authorID) {
+				recipients[a] = true
+			}
+			return true
+		})
+	}
+
+	list := []*actor.Actor{}
+	for a := range recipients {
+		list = append(list, a)
+	}
+	return list
+}
+
+// addressedIDs 會取出 object 中 fields 欄位的所有收件人，欄位可能是字串或是陣列
+func addressedIDs(o map[string]interface{}, fields ...string) []string {
+	ids := []string{}
+	for _, field := range fields {
+		switch v := o[field].(type) {
+		case string:
+			ids = append(ids, v)
+		case []string:
+			ids = append(ids, v...)
+		case []interface{}:
+			for _, i := range v {
+				if id := getIDFromField(i); id != "" {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// addressedIn 會回傳 object 的 field 欄位中是否有 target，
+// Public 也可能使用 as:Public 或 Public 這樣的簡寫。
+func addressedIn(o map[string]interface{}, field string, target string) bool {
+	for _, id := range addressedIDs(o, field) {
+		if id == target {
+			return true
+		}
+		if target == publicAddress && (id == "as:Public" || id == "Public") {
+			return true
+		}
+	}
+	return false
+}
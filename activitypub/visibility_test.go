@@ -0,0 +1,93 @@
+package activitypub
+
+import (
+	"testing"
+)
+
+func TestCanViewObject(t *testing.T) {
+	type TestCase struct {
+		name     string
+		object   map[string]interface{}
+		viewerID string
+		expected bool
+	}
+
+	author := testActor("visibility-author")
+	follower := testActor("visibility-follower")
+	stranger := testActor("visibility-stranger")
+	author.AppendFollowerID(follower.GetFullID())
+
+	// 其他站的作者只能從本站使用者的追蹤清單判斷 followers
+	remoteAuthor := "https://remote.example/users/bob"
+	remoteFollower := testActor("visibility-remote-follower")
+	remoteFollower.AppendFollowingID(remoteAuthor)
+
+	followers := author.GetFullID() + "/followers"
+	public := map[string]interface{}{
+		"attributedTo": author.GetFullID(),
+		"to":           []interface{}{publicAddress},
+		"cc":           []interface{}{followers},
+	}
+	unlisted := map[string]interface{}{
+		"attributedTo": author.GetFullID(),
+		"to":           []interface{}{followers},
+		"cc":           []interface{}{"as:Public"},
+	}
+	followersOnly := map[string]interface{}{
+		"attributedTo": author.GetFullID(),
+		"to":           []interface{}{followers},
+	}
+	direct := map[string]interface{}{
+		"attributedTo": author.GetFullID(),
+		"to":           []interface{}{stranger.GetFullID()},
+	}
+	remoteFollowersOnly := map[string]interface{}{
+		"attributedTo": remoteAuthor,
+		"to":           remoteAuthor + "/followers",
+	}
+
+	testCases := []TestCase{
+		{name: "public anonymous", object: public, viewerID: "", expected: true},
+		{name: "unlisted anonymous", object: unlisted, viewerID: "", expected: true},
+		{name: "followers anonymous", object: followersOnly, viewerID: "", expected: false},
+		{name: "followers author", object: followersOnly, viewerID: author.GetFullID(), expected: true},
+		{name: "followers follower", object: followersOnly, viewerID: follower.GetFullID(), expected: true},
+		{name: "followers stranger", object: followersOnly, viewerID: stranger.GetFullID(), expected: false},
+		{name: "followers remote follower", object: remoteFollowersOnly, viewerID: remoteFollower.GetFullID(), expected: true},
+		{name: "followers remote stranger", object: remoteFollowersOnly, viewerID: stranger.GetFullID(), expected: false},
+		{name: "direct anonymous", object: direct, viewerID: "", expected: false},
+		{name: "direct recipient", object: direct, viewerID: stranger.GetFullID(), expected: true},
+		{name: "direct follower", object: direct, viewerID: follower.GetFullID(), expected: false},
+		{name: "direct author", object: direct, viewerID: author.GetFullID(), expected: true},
+	}
+
+	for _, tc := range testCases {
+		actual := canViewObject(tc.object, tc.viewerID)
+		if actual != tc.expected {
+			t.Errorf("%s: canViewObject() = %v, expected %v", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+func TestObjectVisibility(t *testing.T) {
+	type TestCase struct {
+		object   map[string]interface{}
+		expected string
+	}
+
+	testCases := []TestCase{
+		{object: map[string]interface{}{"to": publicAddress}, expected: VisibilityPublic},
+		{object: map[string]interface{}{"to": []interface{}{"Public"}}, expected: VisibilityPublic},
+		{object: map[string]interface{}{"cc": []string{publicAddress}}, expected: VisibilityUnlisted},
+		{object: map[string]interface{}{"attributedTo": "https://remote.example/users/bob", "to": "https://remote.example/users/bob/followers"}, expected: VisibilityFollowers},
+		{object: map[string]interface{}{"to": "https://remote.example/users/carol"}, expected: VisibilityDirect},
+		{object: map[string]interface{}{}, expected: VisibilityDirect},
+	}
+
+	for _, tc := range testCases {
+		actual := objectVisibility(tc.object)
+		if actual != tc.expected {
+			t.Errorf("objectVisibility(%v) = %q, expected %q", tc.object, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+)
+
+// PostAnnounce 會讓使用者轉推參數 object (object 的 ID)
+func PostAnnounce(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostAnnounce", "info", "announce")
+	a, objectID, ok := resolveLikeTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := activitypub.SendAnnounce(a, objectID)
+	if err != nil {
+		slog.Warn("api.PostAnnounce", "warn", "send announce failed", "object", objectID, "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"object":  objectID,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// PostUnannounce 會取消使用者對參數 object 的轉推
+func PostUnannounce(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostUnannounce", "info", "unannounce")
+	a, objectID, ok := resolveLikeTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := activitypub.SendUndoAnnounce(a, objectID)
+	if err != nil {
+		slog.Warn("api.PostUnannounce", "warn", "send undo announce failed", "object", objectID, "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"object":  objectID,
+	}
+	json.NewEncoder(w).Encode(m)
+}
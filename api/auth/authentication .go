@@ -2,6 +2,8 @@ package auth
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pichuchen/hatsuaki/datastore/config"
@@ -63,3 +65,14 @@ func VerifyJWT(tokenString string) (string, error) {
 
 	return username, nil
 }
+
+// VerifyRequest 會從 Authorization header 中取出 Bearer token 並驗證，
+// 驗證成功的話回傳 token 所屬的使用者名稱。
+func VerifyRequest(r *http.Request) (string, error) {
+	authHdr := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHdr, "Bearer ") {
+		return "", fmt.Errorf("authorization header not found")
+	}
+
+	return VerifyJWT(authHdr[len("Bearer "):])
+}
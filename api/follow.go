@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/webfinger"
+)
+
+// PostFollow 會讓使用者追蹤其他人，參數 handle 可以是 @bob@example.social 這樣的帳號或是 actor 的網址。
+// 送出 Follow 之後會先是等待中的狀態，要等對方送回 Accept 之後才會真正變成追蹤中。
+func PostFollow(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostFollow", "info", "follow")
+	a, targetID, ok := resolveFollowTarget(w, r)
+	if !ok {
+		return
+	}
+
+	activitypub.SendFollow(a, targetID)
+
+	err := actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 本站的 actor 不需要等待 Accept，不需要手動核准的話會馬上變成已追蹤
+	state := "pending"
+	for _, id := range a.GetFollowingIDs() {
+		if id == targetID {
+			state = "accepted"
+			break
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	m := map[string]interface{}{
+		"success": true,
+		"actor":   targetID,
+		"state":   state,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// PostUnfollow 會讓使用者取消追蹤 (或是取消還在等待中的追蹤請求)，參數和 PostFollow 相同。
+func PostUnfollow(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostUnfollow", "info", "unfollow")
+	a, targetID, ok := resolveFollowTarget(w, r)
+	if !ok {
+		return
+	}
+
+	activitypub.SendUndoFollow(a, targetID)
+
+	err := actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"actor":   targetID,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// resolveFollowTarget 會驗證使用者，並把參數 handle 解析成 actor 的 ID，
+// 失敗的話會直接寫入錯誤回應，並且第三個回傳值為 false。
+func resolveFollowTarget(w http.ResponseWriter, r *http.Request) (*actor.Actor, string, bool) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, "", false
+	}
+
+	r.ParseForm()
+	handle := r.FormValue("handle")
+	if handle == "" {
+		slog.Warn("api.resolveFollowTarget", "warn", "handle is empty")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, "", false
+	}
+
+	targetID, err := webfinger.Resolve(handle)
+	if err != nil {
+		slog.Warn("api.resolveFollowTarget", "warn", "resolve handle failed", "handle", handle, "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, "", false
+	}
+
+	if targetID == a.GetFullID() {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, "", false
+	}
+	return a, targetID, true
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+)
+
+// 這個部分是處理還沒被核准的追蹤請求，
+// 使用者的 manuallyApprovesFollowers 為 true 的時候 (由 /1/settings 設定)，
+// 收到的 Follow 會先放在待審核清單中，由使用者決定要接受或是拒絕。
+// 使用者沒有設定過的話，依照 config 中的 enable_auto_accept_follow 決定 (false 代表需要審核)。
+//
+// GET  /1/follow_requests         取得待審核的追蹤請求
+// POST /1/follow_requests/accept  接受追蹤請求，參數為 actor
+// POST /1/follow_requests/reject  拒絕追蹤請求，參數為 actor
+func RouteFollowRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && r.URL.Path == "/1/follow_requests" {
+		GetFollowRequests(w, r)
+		return
+	}
+	if r.Method == "POST" && r.URL.Path == "/1/follow_requests/accept" {
+		PostFollowRequestAccept(w, r)
+		return
+	}
+	if r.Method == "POST" && r.URL.Path == "/1/follow_requests/reject" {
+		PostFollowRequestReject(w, r)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func GetFollowRequests(w http.ResponseWriter, r *http.Request) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	m := map[string]interface{}{
+		"success":         true,
+		"follow_requests": a.GetPendingFollowers(),
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+func PostFollowRequestAccept(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostFollowRequestAccept", "info", "accept")
+	a, followRequest, ok := popFollowRequest(w, r)
+	if !ok {
+		return
+	}
+
+	followerID := followRequest["actor"]
+	activitypub.SendAccept(a, followerID, followRequest["id"])
+	a.AppendFollowerID(followerID)
+
+	err := actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+func PostFollowRequestReject(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostFollowRequestReject", "info", "reject")
+	a, followRequest, ok := popFollowRequest(w, r)
+	if !ok {
+		return
+	}
+
+	followerID := followRequest["actor"]
+	activitypub.SendReject(a, followerID, followRequest["id"])
+	// 順便清掉當初記錄的 Follow activity
+	a.RemoveFollowerID(followerID)
+
+	err := actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// popFollowRequest 會驗證使用者，並把參數 actor 所指定的追蹤請求從待審核清單中取出，
+// 失敗的話會直接寫入錯誤回應，並且第三個回傳值為 false。
+func popFollowRequest(w http.ResponseWriter, r *http.Request) (*actor.Actor, map[string]string, bool) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	r.ParseForm()
+	followerID := r.FormValue("actor")
+	if followerID == "" {
+		slog.Warn("api.popFollowRequest", "warn", "actor is empty")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	followRequest, ok := a.RemovePendingFollower(followerID)
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return a, followRequest, true
+}
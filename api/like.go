@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+)
+
+// PostLike 會讓使用者對參數 object (object 的 ID) 按讚
+func PostLike(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostLike", "info", "like")
+	a, objectID, ok := resolveLikeTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := activitypub.SendLike(a, objectID)
+	if err != nil {
+		slog.Warn("api.PostLike", "warn", "send like failed", "object", objectID, "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"object":  objectID,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// PostUnlike 會取消使用者對參數 object 的按讚
+func PostUnlike(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostUnlike", "info", "unlike")
+	a, objectID, ok := resolveLikeTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := activitypub.SendUndoLike(a, objectID)
+	if err != nil {
+		slog.Warn("api.PostUnlike", "warn", "send undo like failed", "object", objectID, "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"object":  objectID,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// resolveLikeTarget 會驗證使用者並取出參數 object (按讚和轉推共用)，
+// 失敗的話會直接寫入錯誤回應，並且第三個回傳值為 false。
+func resolveLikeTarget(w http.ResponseWriter, r *http.Request) (*actor.Actor, string, bool) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, "", false
+	}
+
+	r.ParseForm()
+	objectID := r.FormValue("object")
+	if objectID == "" {
+		slog.Warn("api.resolveLikeTarget", "warn", "object is empty")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, "", false
+	}
+	return a, objectID, true
+}
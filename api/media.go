@@ -0,0 +1,260 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/media"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/imageproc"
+)
+
+// 上傳的檔案最大的大小
+const mediaMaxUploadSize = 40 << 20
+
+// 一則 note 最多可以附加幾個檔案，和 Mastodon 相同
+const noteMaxAttachments = 4
+
+// mediaExtensions 是允許上傳的檔案類型以及存檔時使用的副檔名，
+// 類型是依照檔案內容判斷的，不相信上傳時宣稱的 Content-Type，
+// 這邊不允許 HTML 或 SVG 之類的類型，避免從本站的網址執行其他人上傳的 script。
+var mediaExtensions = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"audio/mpeg":      ".mp3",
+	"audio/ogg":       ".ogg",
+	"audio/wave":      ".wav",
+	"application/pdf": ".pdf",
+}
+
+// PostMedia 會接收 multipart/form-data 的 file 欄位，存到 media_dir 之後回傳 media 的 ID，
+// description 欄位會成為替代文字 (alt text)，發文時用 media_ids 把 ID 帶上就會加進 attachment。
+func PostMedia(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostMedia", "info", "upload")
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, mediaMaxUploadSize+1<<20)
+	err = r.ParseMultipartForm(1 << 20)
+	if err != nil {
+		slog.Warn("api.PostMedia", "warn", "parse form failed", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		slog.Warn("api.PostMedia", "warn", "file is empty", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if header.Size > mediaMaxUploadSize {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	mediaType := strings.Split(http.DetectContentType(head[:n]), ";")[0]
+	ext, ok := mediaExtensions[mediaType]
+	if !ok {
+		slog.Warn("api.PostMedia", "warn", "unsupported media type", "media_type", mediaType)
+		http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// JPEG、PNG、GIF 和 WebP 會重新編碼 (移除 EXIF) 並產生縮圖和 blurhash，
+	// WebP 會轉成 PNG 或 JPEG，所以存檔的副檔名和類型要以處理後的結果為準。
+	// 動畫的 WebP 沒辦法重新編碼，只會移除 EXIF 和 XMP，其他的類型 (例如影片) 會直接存原檔。
+	var processed *imageproc.Result
+	if mediaType == "image/webp" && imageproc.IsAnimatedWebP(data) {
+		data, err = imageproc.StripWebPMetadata(data)
+		if err != nil {
+			slog.Warn("api.PostMedia", "warn", "webp metadata strip failed", "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	} else if imageproc.IsSupported(mediaType) {
+		processed, err = imageproc.Process(data, mediaType, config.GetMediaMaxDimension())
+		if err != nil {
+			slog.Warn("api.PostMedia", "warn", "image process failed", "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		data = processed.Data
+		mediaType = processed.MediaType
+		ext = mediaExtensions[mediaType]
+	}
+
+	id := object.GenerateUUIDv7()
+	filename := id + ext
+	err = saveMediaFile(bytes.NewReader(data), filename)
+	if err != nil {
+		slog.Warn("api.PostMedia", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m := media.NewMedia(id, username, filename, attachmentType(mediaType), mediaType)
+	m.SetName(r.FormValue("description"))
+	if processed != nil {
+		m.SetSize(processed.Width, processed.Height)
+		m.SetBlurhash(processed.Blurhash)
+
+		thumbnail := id + "_thumb" + mediaExtensions[processed.ThumbnailMediaType]
+		err = saveMediaFile(bytes.NewReader(processed.Thumbnail), thumbnail)
+		if err != nil {
+			slog.Warn("api.PostMedia", "error", "thumbnail save error", "err", err)
+		} else {
+			m.SetThumbnail(thumbnail, processed.ThumbnailMediaType)
+		}
+	} else if strings.HasPrefix(mediaType, "image/") {
+		if c, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			m.SetSize(c.Width, c.Height)
+		}
+	}
+
+	err = media.SaveMedia("./media.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	resp := m.ToAttachment()
+	resp["success"] = true
+	resp["id"] = m.GetID()
+	resp["preview_url"] = m.GetThumbnailURL()
+	json.NewEncoder(w).Encode(resp)
+}
+
+// saveMediaFile 會把上傳的檔案寫到 media_dir 中，寫到一半失敗的話會把檔案刪掉
+func saveMediaFile(src io.Reader, filename string) error {
+	dir := config.GetMediaDir()
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, filename)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// attachmentType 會依照 mediaType 回傳 attachment 的類型
+func attachmentType(mediaType string) string {
+	if strings.HasPrefix(mediaType, "image/") {
+		return "Image"
+	}
+	if strings.HasPrefix(mediaType, "video/") {
+		return "Video"
+	}
+	return "Document"
+}
+
+// RouteMediaFile 會回傳 /media/{file} 的檔案，Content-Type 使用上傳時判斷的類型
+func RouteMediaFile(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	m, err := media.FindMediaByFile(file)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	mediaType := m.GetMediaType()
+	if file == m.GetThumbnailFile() {
+		mediaType = m.GetThumbnailMediaType()
+	}
+
+	f, err := os.Open(filepath.Join(config.GetMediaDir(), file))
+	if err != nil {
+		slog.Warn("api.RouteMediaFile", "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// 檔名是 UUID，內容不會改變
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if m.GetType() == "Document" {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	http.ServeContent(w, r, file, info.ModTime(), f)
+}
+
+// resolveAttachments 會把發文時帶上的 media_ids 轉成 attachment，
+// media_ids 可以是多個同名的欄位，或是以逗號分隔，只能使用自己上傳的檔案。
+func resolveAttachments(r *http.Request, username string) ([]map[string]interface{}, error) {
+	ids := []string{}
+	for _, v := range r.Form["media_ids"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) > noteMaxAttachments {
+		return nil, errors.New("too many attachments")
+	}
+
+	attachments := []map[string]interface{}{}
+	for _, id := range ids {
+		m, err := media.FindMediaByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if m.GetOwner() != username {
+			return nil, errors.New("media not owned by user")
+		}
+		attachments = append(attachments, m.ToAttachment())
+	}
+	return attachments, nil
+}
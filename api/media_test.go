@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pichuchen/hatsuaki/datastore/media"
+)
+
+func TestResolveAttachments(t *testing.T) {
+	type TestCase struct {
+		name     string
+		username string
+		mediaIDs []string
+		expected []string
+		isErr    bool
+	}
+
+	media.NewMedia("resolve-alice-1", "alice", "resolve-alice-1.png", "Image", "image/png")
+	media.NewMedia("resolve-alice-2", "alice", "resolve-alice-2.png", "Image", "image/png")
+	media.NewMedia("resolve-bob-1", "bob", "resolve-bob-1.png", "Image", "image/png")
+
+	testCases := []TestCase{
+		{
+			name:     "no media",
+			username: "alice",
+			expected: []string{},
+		},
+		{
+			name:     "own media",
+			username: "alice",
+			mediaIDs: []string{"resolve-alice-1"},
+			expected: []string{"resolve-alice-1.png"},
+		},
+		{
+			name:     "comma separated and repeated fields",
+			username: "alice",
+			mediaIDs: []string{"resolve-alice-2, resolve-alice-1", ""},
+			expected: []string{"resolve-alice-2.png", "resolve-alice-1.png"},
+		},
+		{
+			// 不能使用其他人上傳的檔案
+			name:     "media of another user",
+			username: "alice",
+			mediaIDs: []string{"resolve-alice-1", "resolve-bob-1"},
+			isErr:    true,
+		},
+		{
+			name:     "unknown media",
+			username: "alice",
+			mediaIDs: []string{"resolve-unknown"},
+			isErr:    true,
+		},
+		{
+			name:     "too many attachments",
+			username: "alice",
+			mediaIDs: []string{strings.Repeat("resolve-alice-1,", noteMaxAttachments+1)},
+			isErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		form := url.Values{"media_ids": tc.mediaIDs}
+		r := httptest.NewRequest("POST", "/1/note", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ParseForm()
+
+		attachments, err := resolveAttachments(r, tc.username)
+		if (err != nil) != tc.isErr {
+			t.Errorf("%s: resolveAttachments() error = %v, expected error %v", tc.name, err, tc.isErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		files := []string{}
+		for _, a := range attachments {
+			u, _ := a["url"].(string)
+			files = append(files, u[strings.LastIndex(u, "/")+1:])
+		}
+		if !reflect.DeepEqual(files, tc.expected) {
+			t.Errorf("%s: resolveAttachments() = %v, expected %v", tc.name, files, tc.expected)
+		}
+	}
+}
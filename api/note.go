@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/object"
+)
+
+// 這邊會接收所有 /1/note/{id} 的請求，id 是 object 的 UUID
+//
+// PATCH  /1/note/{id}          編輯 note 的內容
+// DELETE /1/note/{id}          刪除 note
+// GET    /1/note/{id}/history  取得 note 的編輯紀錄
+func RouteNote(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/history") {
+		GetNoteHistory(w, r)
+		return
+	}
+	if r.Method == "PATCH" {
+		PatchNote(w, r)
+		return
+	}
+	if r.Method == "DELETE" {
+		DeleteNote(w, r)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+// PatchNote 會把使用者自己的 note 換成參數 content 的內容，
+// 舊的內容會保留在編輯紀錄中，並以 Update 通知收到過這個 note 的人
+func PatchNote(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PatchNote", "info", "edit")
+	a, o, ok := resolveOwnNote(w, r)
+	if !ok {
+		return
+	}
+
+	r.ParseForm()
+	content := r.FormValue("content")
+	if content == "" {
+		slog.Warn("api.PatchNote", "warn", "content is empty")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// 沒有指定 media_type 的話沿用原本的格式
+	mediaType := r.FormValue("media_type")
+	if mediaType == "" {
+		_, mediaType = o.GetSource()
+	}
+	if mediaType == "" {
+		mediaType = activitypub.MediaTypePlainText
+	}
+	if !activitypub.IsSupportedMediaType(mediaType) {
+		slog.Warn("api.PatchNote", "warn", "unsupported media type", "media_type", mediaType)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// 新的內容中的提及和 hashtag 也需要處理，都以新的內容為準
+	o.RemoveHashtags()
+	activitypub.RemoveMentions(o)
+	o.Edit(activitypub.RenderContent(o, content, mediaType))
+	o.SetSource(content, mediaType)
+	activitypub.IndexHashtags(o.GetFullID(), o.GetTag())
+
+	err := activitypub.SendUpdate(a, o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = object.SaveObject("./object.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"id":      o.GetFullID(),
+		"updated": o.GetUpdated(),
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// GetNoteHistory 會回傳 note 目前的內容以及之前的版本，由新到舊排列，
+// 不需要登入，但是 followers 限定或是私訊的 note 只有看得到的人可以取得。
+func GetNoteHistory(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/1/note/"), "/history")
+	o, err := object.FindObjectByID(id)
+	if err != nil || o.IsTombstone() || o.GetType() != "Note" {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	viewerID := ""
+	if username, err := auth.VerifyRequest(r); err == nil {
+		if a, err := actor.FindActorByUsername(username); err == nil {
+			viewerID = a.GetFullID()
+		}
+	}
+	// 看不到的 note 當作不存在
+	if !activitypub.CanViewNote(o, viewerID) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	updated := o.GetUpdated()
+	if updated == "" {
+		updated = o.GetPublished()
+	}
+	current := map[string]string{"content": o.GetContent(), "updated": updated}
+	if source, mediaType := o.GetSource(); mediaType != "" {
+		current["source"] = source
+		current["mediaType"] = mediaType
+	}
+	history := []map[string]string{current}
+	previous := o.GetEditHistory()
+	for i := len(previous) - 1; i >= 0; i-- {
+		history = append(history, previous[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	m := map[string]interface{}{
+		"success": true,
+		"id":      o.GetFullID(),
+		"history": history,
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// DeleteNote 會把使用者自己的 note 換成 Tombstone，並通知收到過這個 note 的人
+func DeleteNote(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.DeleteNote", "info", "delete")
+	a, o, ok := resolveOwnNote(w, r)
+	if !ok {
+		return
+	}
+
+	err := activitypub.SendDelete(a, o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	m := map[string]interface{}{
+		"success": true,
+		"id":      o.GetFullID(),
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// resolveOwnNote 會驗證使用者，並找出網址中指定的、屬於該使用者的 note，
+// 失敗的話會直接寫入錯誤回應，並且第三個回傳值為 false。
+func resolveOwnNote(w http.ResponseWriter, r *http.Request) (*actor.Actor, *object.Object, bool) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/1/note/")
+	o, err := object.FindObjectByID(id)
+	if err != nil || o.IsTombstone() || o.GetType() != "Note" {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	if o.GetAttributedTo() != a.GetFullID() {
+		slog.Warn("api.resolveOwnNote", "warn", "note not owned by user", "note", o.GetFullID(), "username", username)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return a, o, true
+}
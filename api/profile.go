@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/media"
+)
+
+// 個人資料的長度限制，和 Mastodon 相同
+const (
+	profileMaxNameLength    = 30
+	profileMaxSummaryLength = 500
+	profileMaxFields        = 4
+	profileMaxFieldLength   = 255
+)
+
+// 這個部分是使用者自己的個人資料，會顯示在 actor 上
+//
+// GET  /1/profile  取得目前的個人資料
+// POST /1/profile  更新個人資料，只會更新有傳入的參數，有變更的話會送出 Update{Person} 給 followers
+//
+// 目前支援的參數:
+//   - name: 顯示名稱
+//   - summary: 自我介紹 (純文字)
+//   - icon: 大頭貼，使用 /1/media 上傳的圖片 ID，空字串的話移除
+//   - image: 封面圖片，格式和 icon 相同
+//   - field_name、field_value: 個人資料欄位，依照順序一一對應，最多 4 組，有傳入的話會整個取代
+//   - discoverable: true 的話願意出現在推薦或搜尋之類的功能中
+func RouteProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		GetProfile(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		PostProfile(w, r)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	writeProfile(w, a)
+}
+
+func PostProfile(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostProfile", "info", "profile")
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+
+	// 先檢查所有的參數，全部正確之後才會修改，避免只更新到一半
+	if r.Form.Has("name") && utf8.RuneCountInString(r.FormValue("name")) > profileMaxNameLength {
+		slog.Warn("api.PostProfile", "warn", "name too long")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Has("summary") && utf8.RuneCountInString(r.FormValue("summary")) > profileMaxSummaryLength {
+		slog.Warn("api.PostProfile", "warn", "summary too long")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	var icon, image *media.Media
+	if r.Form.Has("icon") {
+		icon, err = resolveProfileImage(r.FormValue("icon"), username)
+		if err != nil {
+			slog.Warn("api.PostProfile", "warn", "icon invalid", "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+	if r.Form.Has("image") {
+		image, err = resolveProfileImage(r.FormValue("image"), username)
+		if err != nil {
+			slog.Warn("api.PostProfile", "warn", "image invalid", "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+	updateFields := r.Form.Has("field_name") || r.Form.Has("field_value")
+	fields, err := parseProfileFields(r)
+	if err != nil {
+		slog.Warn("api.PostProfile", "warn", "fields invalid", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Has("name") {
+		a.SetName(r.FormValue("name"))
+	}
+	if r.Form.Has("icon") {
+		if icon == nil {
+			a.SetIcon("", "")
+		} else {
+			a.SetIcon(icon.GetURL(), icon.GetMediaType())
+		}
+	}
+	if r.Form.Has("image") {
+		if image == nil {
+			a.SetImage("", "")
+		} else {
+			a.SetImage(image.GetURL(), image.GetMediaType())
+		}
+	}
+	if r.Form.Has("discoverable") {
+		a.SetDiscoverable(r.FormValue("discoverable") == "true")
+	}
+
+	// 自我介紹和欄位中的提及和 hashtag 是一起計算的，所以只改其中一個也需要重新轉換另一個
+	if r.Form.Has("summary") || updateFields {
+		_, summary := a.GetSummary()
+		if r.Form.Has("summary") {
+			summary = r.FormValue("summary")
+		}
+		if !updateFields {
+			fields = []map[string]string{}
+			for _, f := range a.GetFields() {
+				fields = append(fields, map[string]string{"name": f["name"], "value": f["source"]})
+			}
+		}
+
+		renderedSummary, renderedFields, tag := activitypub.RenderProfile(a, summary, fields)
+		a.SetSummary(renderedSummary, summary)
+		a.SetFields(renderedFields)
+		a.SetProfileTag(tag)
+	}
+
+	changed := r.Form.Has("name") || r.Form.Has("summary") || r.Form.Has("icon") ||
+		r.Form.Has("image") || r.Form.Has("discoverable") || updateFields
+	if changed {
+		err = actor.SaveActor("./actor.json")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		activitypub.SendProfileUpdate(a)
+	}
+
+	writeProfile(w, a)
+}
+
+// resolveProfileImage 會找出大頭貼或封面使用的圖片，id 為空字串的話回傳 nil 表示移除
+func resolveProfileImage(id string, username string) (*media.Media, error) {
+	if id == "" {
+		return nil, nil
+	}
+	m, err := media.FindMediaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.GetOwner() != username {
+		return nil, errors.New("media not owned by user")
+	}
+	if m.GetType() != "Image" {
+		return nil, errors.New("media is not an image")
+	}
+	return m, nil
+}
+
+// parseProfileFields 會把 field_name 和 field_value 依照順序組成個人資料欄位，
+// 名稱和內容都是空的會被忽略，所以只傳一組空的 field_name 可以清除所有欄位。
+func parseProfileFields(r *http.Request) ([]map[string]string, error) {
+	names := r.Form["field_name"]
+	values := r.Form["field_value"]
+	if len(names) != len(values) && len(values) > 0 {
+		return nil, errors.New("field_name and field_value count mismatch")
+	}
+
+	fields := []map[string]string{}
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		if name == "" && value == "" {
+			continue
+		}
+		if name == "" {
+			return nil, errors.New("field name is empty")
+		}
+		if utf8.RuneCountInString(name) > profileMaxFieldLength || utf8.RuneCountInString(value) > profileMaxFieldLength {
+			return nil, errors.New("field too long")
+		}
+		fields = append(fields, map[string]string{"name": name, "value": value})
+	}
+	if len(fields) > profileMaxFields {
+		return nil, errors.New("too many fields")
+	}
+	return fields, nil
+}
+
+func writeProfile(w http.ResponseWriter, a *actor.Actor) {
+	w.Header().Set("Content-Type", "application/json")
+	summary, source := a.GetSummary()
+	m := map[string]interface{}{
+		"success":        true,
+		"name":           a.GetName(),
+		"summary":        summary,
+		"summary_source": source,
+		"icon":           a.GetIcon()["url"],
+		"image":          a.GetImage()["url"],
+		"fields":         a.GetFields(),
+		"discoverable":   a.GetDiscoverable(),
+	}
+	json.NewEncoder(w).Encode(m)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -23,6 +24,26 @@ func Route(w http.ResponseWriter, r *http.Request) {
 		timeline.RouteTimeline(w, r)
 		return
 	}
+	if strings.HasPrefix(r.URL.Path, "/1/follow_requests") {
+		RouteFollowRequest(w, r)
+		return
+	}
+	if r.URL.Path == "/1/settings" {
+		RouteSettings(w, r)
+		return
+	}
+	if r.URL.Path == "/1/profile" {
+		RouteProfile(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/1/note/") {
+		RouteNote(w, r)
+		return
+	}
+	if r.URL.Path == "/1/thread" {
+		RouteThread(w, r)
+		return
+	}
 
 	if r.Method == "GET" {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -45,6 +66,27 @@ func RoutePost(w http.ResponseWriter, r *http.Request) {
 	} else if r.URL.Path == "/1/note" {
 		PostNote(w, r)
 		return
+	} else if r.URL.Path == "/1/media" {
+		PostMedia(w, r)
+		return
+	} else if r.URL.Path == "/1/follow" {
+		PostFollow(w, r)
+		return
+	} else if r.URL.Path == "/1/unfollow" {
+		PostUnfollow(w, r)
+		return
+	} else if r.URL.Path == "/1/like" {
+		PostLike(w, r)
+		return
+	} else if r.URL.Path == "/1/unlike" {
+		PostUnlike(w, r)
+		return
+	} else if r.URL.Path == "/1/announce" {
+		PostAnnounce(w, r)
+		return
+	} else if r.URL.Path == "/1/unannounce" {
+		PostUnannounce(w, r)
+		return
 	}
 	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
@@ -150,22 +192,71 @@ func PostNote(w http.ResponseWriter, r *http.Request) {
 
 	r.ParseForm()
 	content := r.FormValue("content")
-	if content == "" {
+	// 有附加檔案的話 content 可以是空的
+	attachments, err := resolveAttachments(r, username)
+	if err != nil {
+		slog.Warn("api.PostPost", "warn", "media_ids invalid", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if content == "" && len(attachments) == 0 {
 		slog.Warn("api.PostPost", "warn", "content is empty")
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	// media_type 是 content 的格式，可以是 text/plain (預設) 或 text/markdown
+	mediaType := r.FormValue("media_type")
+	if mediaType == "" {
+		mediaType = activitypub.MediaTypePlainText
+	}
+	if !activitypub.IsSupportedMediaType(mediaType) {
+		slog.Warn("api.PostPost", "warn", "unsupported media type", "media_type", mediaType)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
 
 	a, err := actor.FindActorByUsername(username)
 	if err != nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+
+	// 有 in_reply_to 的話是回覆，需要先確定被回覆的 object 存在，並且通知它的作者，
+	// 發文的人看不到的 object 當作不存在
+	var parent map[string]interface{}
+	inReplyTo := r.FormValue("in_reply_to")
+	if inReplyTo != "" {
+		parent, err = activitypub.GetObject(inReplyTo, username)
+		if err == nil && !activitypub.CanViewObject(parent, a.GetFullID()) {
+			err = errors.New("in_reply_to not visible")
+		}
+		if err != nil {
+			slog.Warn("api.PostPost", "warn", "in_reply_to not found", "in_reply_to", inReplyTo, "error", err)
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	}
+
 	o := object.NewNote()
-	o.SetContent(content)
 	o.SetAttributedTo(a.GetFullID())
-	o.AddCC(a.GetFullID() + "/followers")
-	o.AddTo("https://www.w3.org/ns/activitystreams#Public")
+	// visibility 可以是 public (預設)、unlisted、followers 或 direct
+	err = activitypub.SetVisibility(o, a, r.FormValue("visibility"))
+	if err != nil {
+		slog.Warn("api.PostPost", "warn", err)
+		object.RemoveObject(o.GetFullID())
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if parent != nil {
+		activitypub.SetReplyTarget(o, parent)
+	}
+	// 提到的人會加上 Mention tag 並且一起收到這則 note，hashtag 則會加上 Hashtag tag
+	o.SetContent(activitypub.RenderContent(o, content, mediaType))
+	o.SetSource(content, mediaType)
+	for _, attachment := range attachments {
+		o.AddAttachment(attachment)
+	}
+	activitypub.IndexHashtags(o.GetFullID(), o.GetTag())
 	a.AppendOutboxObject(o.GetFullID())
 
 	activitypub.SendCreate(a, o)
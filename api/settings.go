@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+)
+
+// 這個部分是使用者自己的偏好設定
+//
+// GET  /1/settings  取得目前的設定
+// POST /1/settings  更新設定，只會更新有傳入的參數
+//
+// 目前支援的設定:
+//   - hide_followers: true 的話其他站只能看到 followers 的數量
+//   - hide_following: true 的話其他站只能看到 following 的數量
+//   - manually_approves_followers: true 的話追蹤請求需要透過 /1/follow_requests 手動核准
+func RouteSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		GetSettings(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		PostSettings(w, r)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func GetSettings(w http.ResponseWriter, r *http.Request) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	writeSettings(w, a)
+}
+
+func PostSettings(w http.ResponseWriter, r *http.Request) {
+	slog.Info("api.PostSettings", "info", "settings")
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a, err := actor.FindActorByUsername(username)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+	if r.Form.Has("hide_followers") {
+		a.SetHideFollowers(r.FormValue("hide_followers") == "true")
+	}
+	if r.Form.Has("hide_following") {
+		a.SetHideFollowing(r.FormValue("hide_following") == "true")
+	}
+	manual := a.GetManuallyApprovesFollowers()
+	if r.Form.Has("manually_approves_followers") {
+		a.SetManuallyApprovesFollowers(r.FormValue("manually_approves_followers") == "true")
+	}
+
+	err = actor.SaveActor("./actor.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// manuallyApprovesFollowers 會顯示在 actor 上，所以需要通知 followers
+	if manual != a.GetManuallyApprovesFollowers() {
+		activitypub.SendProfileUpdate(a)
+	}
+
+	writeSettings(w, a)
+}
+
+func writeSettings(w http.ResponseWriter, a *actor.Actor) {
+	w.Header().Set("Content-Type", "application/json")
+	m := map[string]interface{}{
+		"success":                     true,
+		"hide_followers":              a.GetHideFollowers(),
+		"hide_following":              a.GetHideFollowing(),
+		"manually_approves_followers": a.GetManuallyApprovesFollowers(),
+	}
+	json.NewEncoder(w).Encode(m)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
+	"github.com/pichuchen/hatsuaki/mediaproxy"
+)
+
+// 這邊會接收 /1/thread 的請求
+//
+// GET /1/thread?id={object ID}  取得 object 所在的討論串
+func RouteThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		GetThread(w, r)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+// GetThread 會回傳 object 往上的每一層 (ancestors) 以及已知的所有回覆 (descendants)
+func GetThread(w http.ResponseWriter, r *http.Request) {
+	username, err := auth.VerifyRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		slog.Warn("api.GetThread", "warn", "id is empty")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	ancestors, o, descendants, err := activitypub.GetThread(id, username)
+	if err != nil {
+		slog.Warn("api.GetThread", "warn", "object not found", "id", id, "error", err)
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	// 其他站的圖片改成透過本站的 media proxy 取得
+	for i := range ancestors {
+		ancestors[i] = mediaproxy.RewriteObject(ancestors[i])
+	}
+	for i := range descendants {
+		descendants[i] = mediaproxy.RewriteObject(descendants[i])
+	}
+	o = mediaproxy.RewriteObject(o)
+	if ancestors == nil {
+		ancestors = []map[string]interface{}{}
+	}
+	if descendants == nil {
+		descendants = []map[string]interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	m := map[string]interface{}{
+		"success":     true,
+		"ancestors":   ancestors,
+		"object":      o,
+		"descendants": descendants,
+	}
+	json.NewEncoder(w).Encode(m)
+}
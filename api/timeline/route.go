@@ -11,6 +11,7 @@ import (
 	"github.com/pichuchen/hatsuaki/activitypub"
 	"github.com/pichuchen/hatsuaki/api/auth"
 	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/mediaproxy"
 )
 
 func RouteTimeline(w http.ResponseWriter, r *http.Request) {
@@ -78,12 +79,23 @@ func GetTimeline(w http.ResponseWriter, r *http.Request) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			o, err := activitypub.FetchObject(iid, username, false)
+			o, err := activitypub.GetObject(iid, username)
 			if err != nil {
-				slog.Warn("api.GetTimeline.FetchObject", "id", id, "error", err.Error())
+				slog.Warn("api.GetTimeline.GetObject", "id", id, "error", err.Error())
 				return
 			}
-			list[ii] = o
+			// 自己的轉推只有被轉推的 object ID，需要再取得一次內容
+			if t, _ := o["type"].(string); t == "Announce" {
+				oid, _ := o["object"].(string)
+				inner, err := activitypub.GetObject(oid, username)
+				if err != nil {
+					slog.Warn("api.GetTimeline.GetObject", "id", oid, "error", err.Error())
+					return
+				}
+				o["object"] = inner
+			}
+			// 其他站的圖片改成透過本站的 media proxy 取得，避免洩漏使用者的 IP
+			list[ii] = mediaproxy.RewriteObject(o)
 		}()
 	}
 	wg.Done()
@@ -100,6 +112,10 @@ func GetTimeline(w http.ResponseWriter, r *http.Request) {
 	createActivityList := []interface{}{}
 	for _, v := range list {
 		srcObj := v.(map[string]interface{})
+		if t, _ := srcObj["type"].(string); t == "Announce" {
+			createActivityList = append(createActivityList, srcObj)
+			continue
+		}
 		o := map[string]interface{}{}
 		o["type"] = "Create"
 		o["actor"] = a.GetFullID()
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pichuchen/hatsuaki/activitypub/signature"
 	"github.com/pichuchen/hatsuaki/datastore/config"
@@ -102,6 +103,13 @@ func FindActorByFullID(fullID string) (actor *Actor, err error) {
 	return FindActorByUsername(username)
 }
 
+// RangeActors 會對每一個本站的 actor 呼叫 f，f 回傳 false 時就停止
+func RangeActors(f func(a *Actor) bool) {
+	datastore.Range(func(k, v interface{}) bool {
+		return f(v.(*Actor))
+	})
+}
+
 func (a *Actor) GetUsername() string {
 	return (*a)["username"].(string)
 }
@@ -132,6 +140,7 @@ func NewActor(username string) *Actor {
 	a := &Actor{
 		"username":   username,
 		"privateKey": signature.GeneratePrivateKey(),
+		"published":  time.Now().UTC().Format(time.RFC3339),
 	}
 	datastore.Store(username, a)
 	return a
@@ -171,12 +180,138 @@ func VerifyPassword(username, password string) error {
 	return nil
 }
 
+// GetManuallyApprovesFollowers 會回傳使用者是否需要手動核准追蹤請求，
+// 使用者沒有設定過的話，依照站台的 enable_auto_accept_follow 決定
+func (a *Actor) GetManuallyApprovesFollowers() bool {
+	b, ok := (*a)["manuallyApprovesFollowers"].(bool)
+	if !ok {
+		return !config.GetEnableAutoAcceptFollow()
+	}
+	return b
+}
+
+func (a *Actor) SetManuallyApprovesFollowers(manual bool) {
+	(*a)["manuallyApprovesFollowers"] = manual
+}
+
+// GetHideFollowers 會回傳使用者是否選擇不公開 followers 清單，
+// 不公開的話其他人只能看到 followers 的數量
+func (a *Actor) GetHideFollowers() bool {
+	b, _ := (*a)["hideFollowers"].(bool)
+	return b
+}
+
+func (a *Actor) SetHideFollowers(hide bool) {
+	(*a)["hideFollowers"] = hide
+}
+
+// GetHideFollowing 會回傳使用者是否選擇不公開 following 清單，
+// 不公開的話其他人只能看到 following 的數量
+func (a *Actor) GetHideFollowing() bool {
+	b, _ := (*a)["hideFollowing"].(bool)
+	return b
+}
+
+func (a *Actor) SetHideFollowing(hide bool) {
+	(*a)["hideFollowing"] = hide
+}
+
+// AppendFollowerID 會把 followerID 加進 followers，已經存在的話就不會重複加入
 func (a *Actor) AppendFollowerID(followerID string) {
 	ids := a.GetFollowerIDs()
+	for _, id := range ids {
+		if id == followerID {
+			return
+		}
+	}
 	ids = append(ids, followerID)
 	(*a)["followers"] = ids
 }
 
+// RemoveFollowerID 會把 followerID 從 followers 中移除，
+// 同時也會移除該 follower 的 Follow activity 紀錄
+func (a *Actor) RemoveFollowerID(followerID string) {
+	ids := a.GetFollowerIDs()
+	newIDs := []string{}
+	for _, id := range ids {
+		if id == followerID {
+			continue
+		}
+		newIDs = append(newIDs, id)
+	}
+	(*a)["followers"] = newIDs
+
+	activities := a.getFollowActivities()
+	for activityID, id := range activities {
+		if id == followerID {
+			delete(activities, activityID)
+		}
+	}
+}
+
+// AppendPendingFollower 會把尚未核准的追蹤請求加入待審核清單，
+// 同一個 follower 重複送出的話只會保留最新的 Follow activity ID
+func (a *Actor) AppendPendingFollower(followerID string, followActivityID string) {
+	list := a.GetPendingFollowers()
+	newList := []map[string]string{}
+	for _, p := range list {
+		if p["actor"] == followerID {
+			continue
+		}
+		newList = append(newList, p)
+	}
+	newList = append(newList, map[string]string{
+		"actor":     followerID,
+		"id":        followActivityID,
+		"published": time.Now().UTC().Format(time.RFC3339),
+	})
+	(*a)["pendingFollowers"] = newList
+	a.SetFollowActivityID(followerID, followActivityID)
+}
+
+// GetPendingFollowers 會回傳所有尚未核准的追蹤請求，
+// 每一筆會有 actor (提出請求的 actor ID)、id (Follow activity 的 ID) 以及 published
+func (a *Actor) GetPendingFollowers() []map[string]string {
+	return toStringMapList((*a)["pendingFollowers"])
+}
+
+// RemovePendingFollower 會把 follower 的追蹤請求從待審核清單中移除，
+// 並回傳被移除的請求，如果不存在的話第二個回傳值會是 false
+func (a *Actor) RemovePendingFollower(followerID string) (map[string]string, bool) {
+	list := a.GetPendingFollowers()
+	newList := []map[string]string{}
+	var removed map[string]string
+	for _, p := range list {
+		if p["actor"] == followerID {
+			removed = p
+			continue
+		}
+		newList = append(newList, p)
+	}
+	(*a)["pendingFollowers"] = newList
+	return removed, removed != nil
+}
+
+// SetFollowActivityID 會記錄 follower 當初送來的 Follow activity 的 ID，
+// 之後收到只帶有 ID 的 Undo 時，才能知道是誰要取消追蹤。
+func (a *Actor) SetFollowActivityID(followerID string, followActivityID string) {
+	activities := a.getFollowActivities()
+	activities[followActivityID] = followerID
+}
+
+// FindFollowerByFollowActivityID 會回傳送出該 Follow activity 的 follower
+func (a *Actor) FindFollowerByFollowActivityID(followActivityID string) (string, bool) {
+	id, ok := a.getFollowActivities()[followActivityID]
+	return id, ok
+}
+
+// getFollowActivities 會回傳以 Follow activity ID 為 key，follower ID 為值的 map
+func (a *Actor) getFollowActivities() map[string]string {
+	m := toStringMap((*a)["followActivities"])
+	(*a)["followActivities"] = m
+	return m
+}
+
 func (a *Actor) GetFollowerIDs() []string {
 	n, ok := (*a)["followers"]
 	if !ok {
@@ -195,12 +330,94 @@ func (a *Actor) GetFollowerIDs() []string {
 	return []string{}
 }
 
+// AppendFollowingID 會把 followingID 加進 following，已經存在的話就不會重複加入
 func (a *Actor) AppendFollowingID(followingID string) {
 	ids := a.GetFollowingIDs()
+	for _, id := range ids {
+		if id == followingID {
+			return
+		}
+	}
 	ids = append(ids, followingID)
 	(*a)["following"] = ids
 }
 
+// RemoveFollowingID 會把 followingID 從 following 中移除
+func (a *Actor) RemoveFollowingID(followingID string) {
+	ids := a.GetFollowingIDs()
+	newIDs := []string{}
+	for _, id := range ids {
+		if id == followingID {
+			continue
+		}
+		newIDs = append(newIDs, id)
+	}
+	(*a)["following"] = newIDs
+}
+
+// AppendPendingFollowing 會記錄我們送出、但對方還沒有 Accept 的 Follow，
+// 同一個對象重複送出的話只會保留最新的 Follow activity ID
+func (a *Actor) AppendPendingFollowing(followingID string, followActivityID string) {
+	list := a.GetPendingFollowing()
+	newList := []map[string]string{}
+	for _, p := range list {
+		if p["actor"] == followingID {
+			continue
+		}
+		newList = append(newList, p)
+	}
+	newList = append(newList, map[string]string{
+		"actor":     followingID,
+		"id":        followActivityID,
+		"published": time.Now().UTC().Format(time.RFC3339),
+	})
+	(*a)["pendingFollowing"] = newList
+}
+
+// GetPendingFollowing 會回傳所有還沒被對方接受的 Follow，
+// 每一筆會有 actor (被追蹤的 actor ID)、id (Follow activity 的 ID) 以及 published
+func (a *Actor) GetPendingFollowing() []map[string]string {
+	return toStringMapList((*a)["pendingFollowing"])
+}
+
+// RemovePendingFollowing 會把送往 followingID 的 Follow 從等待清單中移除，
+// 並回傳被移除的紀錄，如果不存在的話第二個回傳值會是 false
+func (a *Actor) RemovePendingFollowing(followingID string) (map[string]string, bool) {
+	list := a.GetPendingFollowing()
+	newList := []map[string]string{}
+	var removed map[string]string
+	for _, p := range list {
+		if p["actor"] == followingID {
+			removed = p
+			continue
+		}
+		newList = append(newList, p)
+	}
+	(*a)["pendingFollowing"] = newList
+	return removed, removed != nil
+}
+
+// SetFollowingActivityID 會記錄我們追蹤 followingID 時送出的 Follow activity ID，
+// 之後取消追蹤時送出的 Undo 需要帶上同一個 Follow。
+func (a *Actor) SetFollowingActivityID(followingID string, followActivityID string) {
+	m := toStringMap((*a)["followingActivities"])
+	m[followingID] = followActivityID
+	(*a)["followingActivities"] = m
+}
+
+// GetFollowingActivityID 會回傳我們追蹤 followingID 時送出的 Follow activity ID
+func (a *Actor) GetFollowingActivityID(followingID string) (string, bool) {
+	id, ok := toStringMap((*a)["followingActivities"])[followingID]
+	return id, ok
+}
+
+// RemoveFollowingActivityID 會移除追蹤 followingID 時的 Follow activity 紀錄
+func (a *Actor) RemoveFollowingActivityID(followingID string) {
+	m := toStringMap((*a)["followingActivities"])
+	delete(m, followingID)
+	(*a)["followingActivities"] = m
+}
+
 func (a *Actor) GetFollowingIDs() []string {
 	n, ok := (*a)["following"]
 	if !ok {
@@ -219,3 +436,65 @@ func (a *Actor) GetFollowingIDs() []string {
 	return []string{}
 
 }
+
+// toStringMap 會把 map[string]string 或是從 JSON 讀進來的 map[string]interface{}
+// 轉換成 map[string]string
+func toStringMap(v interface{}) map[string]string {
+	switch m := v.(type) {
+	case map[string]string:
+		return m
+	case map[string]interface{}:
+		r := map[string]string{}
+		for k, val := range m {
+			r[k], _ = val.(string)
+		}
+		return r
+	}
+	return map[string]string{}
+}
+
+// toInt64 會把 int64 或是從 JSON 讀進來的 float64 轉換成 int64
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// toInt64Map 會把 map[string]int64 或是從 JSON 讀進來的 map[string]interface{}
+// 轉換成 map[string]int64
+func toInt64Map(v interface{}) map[string]int64 {
+	switch m := v.(type) {
+	case map[string]int64:
+		return m
+	case map[string]interface{}:
+		r := map[string]int64{}
+		for k, val := range m {
+			r[k] = toInt64(val)
+		}
+		return r
+	}
+	return map[string]int64{}
+}
+
+// toStringMapList 會把 []map[string]string 或是從 JSON 讀進來的 []interface{}
+// 轉換成 []map[string]string
+func toStringMapList(v interface{}) []map[string]string {
+	switch l := v.(type) {
+	case []map[string]string:
+		return l
+	case []interface{}:
+		list := []map[string]string{}
+		for _, i := range l {
+			if _, ok := i.(map[string]interface{}); !ok {
+				continue
+			}
+			list = append(list, toStringMap(i))
+		}
+		return list
+	}
+	return []map[string]string{}
+}
@@ -37,23 +37,67 @@ func (a *Actor) AppendOutboxObject(objectID string) {
 	(*a)["outbox"] = objects
 }
 
+// RemoveOutboxObject 會從 outbox 中移除 objectID
+func (a *Actor) RemoveOutboxObject(objectID string) {
+	objects, _ := a.GetOutboxObjects()
+	list := []string{}
+	for _, id := range objects {
+		if id != objectID {
+			list = append(list, id)
+		}
+	}
+	(*a)["outbox"] = list
+}
+
 func (a *Actor) AppendInboxObject(objectID string) {
 	objects, err := a.GetInboxObjects()
 	if err != nil {
 		objects = []string{}
 	}
 
+	a.ensureInboxSeq()
+	seqs := toInt64Map((*a)["inboxSeq"])
+	next := toInt64((*a)["inboxNextSeq"])
+	seqs[objectID] = next
+	(*a)["inboxSeq"] = seqs
+	(*a)["inboxNextSeq"] = next + 1
+
 	objects = append(objects, objectID)
 	(*a)["inbox"] = objects
 }
 
+// GetInboxObjectSeq 會回傳 objectID 加入 inbox 時的序號，序號只會遞增，
+// 所以可以當作分頁的游標，即使游標指向的 object 之後從 inbox 中被移除了也還能判斷先後。
+func (a *Actor) GetInboxObjectSeq(objectID string) int64 {
+	a.ensureInboxSeq()
+	return toInt64Map((*a)["inboxSeq"])[objectID]
+}
+
+// ensureInboxSeq 會幫還沒有序號的舊資料依照 inbox 目前的順序補上序號
+func (a *Actor) ensureInboxSeq() {
+	if _, ok := (*a)["inboxNextSeq"]; ok {
+		return
+	}
+	objects, _ := a.GetInboxObjects()
+	seqs := map[string]int64{}
+	for i, id := range objects {
+		seqs[id] = int64(i + 1)
+	}
+	(*a)["inboxSeq"] = seqs
+	(*a)["inboxNextSeq"] = int64(len(objects) + 1)
+}
+
 func (a *Actor) GetInboxObjects() ([]string, error) {
 	n, ok := (*a)["inbox"]
 	if !ok {
 		return []string{}, nil
 	}
 
-	is := n.([]interface{})
+	if s, ok := n.([]string); ok {
+		return s, nil
+	}
+
+	is, _ := n.([]interface{})
 	objects := make([]string, len(is))
 	for i, v := range is {
 		objects[i] = v.(string)
@@ -61,6 +105,76 @@ func (a *Actor) GetInboxObjects() ([]string, error) {
 	return objects, nil
 }
 
+// HasInboxObject 會回傳 objectID 是否已經在 inbox 中
+func (a *Actor) HasInboxObject(objectID string) bool {
+	objects, _ := a.GetInboxObjects()
+	for _, id := range objects {
+		if id == objectID {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveInboxObject 會從 inbox 中移除 objectID
+func (a *Actor) RemoveInboxObject(objectID string) {
+	objects, _ := a.GetInboxObjects()
+	list := []string{}
+	for _, id := range objects {
+		if id != objectID {
+			list = append(list, id)
+		}
+	}
+	(*a)["inbox"] = list
+
+	authors := toStringMap((*a)["inboxAuthors"])
+	delete(authors, objectID)
+	(*a)["inboxAuthors"] = authors
+
+	seqs := toInt64Map((*a)["inboxSeq"])
+	delete(seqs, objectID)
+	(*a)["inboxSeq"] = seqs
+
+	announces := toStringMap((*a)["inboxAnnounces"])
+	for k, v := range announces {
+		if v == objectID {
+			delete(announces, k)
+		}
+	}
+	(*a)["inboxAnnounces"] = announces
+}
+
+// SetInboxObjectAuthor 會記錄 inbox 中 objectID 的作者，
+// 之後收到作者帳號被刪除的 Delete 時可以一起從 inbox 中移除
+func (a *Actor) SetInboxObjectAuthor(objectID string, authorID string) {
+	m := toStringMap((*a)["inboxAuthors"])
+	m[objectID] = authorID
+	(*a)["inboxAuthors"] = m
+}
+
+// GetInboxObjectAuthor 會回傳 inbox 中 objectID 的作者，沒有記錄的話回傳 false
+func (a *Actor) GetInboxObjectAuthor(objectID string) (string, bool) {
+	id, ok := toStringMap((*a)["inboxAuthors"])[objectID]
+	return id, ok
+}
+
+// SetInboxAnnounce 會記錄 inbox 中的 objectID 是因為 announceActivityID 這個轉推而加入的，
+// 收到 Undo{Announce} 時可以再從 inbox 中移除
+func (a *Actor) SetInboxAnnounce(announceActivityID string, objectID string) {
+	m := toStringMap((*a)["inboxAnnounces"])
+	m[announceActivityID] = objectID
+	(*a)["inboxAnnounces"] = m
+}
+
+// RemoveInboxAnnounce 會移除 announceActivityID 的紀錄，並回傳當初加入 inbox 的 object ID
+func (a *Actor) RemoveInboxAnnounce(announceActivityID string) (string, bool) {
+	m := toStringMap((*a)["inboxAnnounces"])
+	objectID, ok := m[announceActivityID]
+	delete(m, announceActivityID)
+	(*a)["inboxAnnounces"] = m
+	return objectID, ok
+}
+
 func (a *Actor) GetInboxObjectsCount() int {
 	objects, err := a.GetInboxObjects()
 	if err != nil {
@@ -69,3 +183,78 @@ func (a *Actor) GetInboxObjectsCount() int {
 
 	return len(objects)
 }
+
+// GetLikedObjectIDs 會回傳使用者按過讚的 object ID，依照按讚的順序排列
+func (a *Actor) GetLikedObjectIDs() []string {
+	n, ok := (*a)["liked"]
+	if !ok {
+		return []string{}
+	}
+	switch v := n.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		ids := make([]string, len(v))
+		for i, id := range v {
+			ids[i], _ = id.(string)
+		}
+		return ids
+	}
+	return []string{}
+}
+
+// AppendLikedObject 會記錄使用者對 objectID 按讚，以及當時送出的 Like activity ID
+func (a *Actor) AppendLikedObject(objectID string, likeActivityID string) {
+	ids := a.GetLikedObjectIDs()
+	exist := false
+	for _, id := range ids {
+		if id == objectID {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		(*a)["liked"] = append(ids, objectID)
+	}
+
+	m := toStringMap((*a)["likedActivities"])
+	m[objectID] = likeActivityID
+	(*a)["likedActivities"] = m
+}
+
+// RemoveLikedObject 會移除對 objectID 的按讚，並回傳當初送出的 Like activity ID
+func (a *Actor) RemoveLikedObject(objectID string) (string, bool) {
+	ids := []string{}
+	for _, id := range a.GetLikedObjectIDs() {
+		if id != objectID {
+			ids = append(ids, id)
+		}
+	}
+	(*a)["liked"] = ids
+
+	m := toStringMap((*a)["likedActivities"])
+	likeActivityID, ok := m[objectID]
+	delete(m, objectID)
+	(*a)["likedActivities"] = m
+	return likeActivityID, ok
+}
+
+// SetAnnounceActivityID 會記錄使用者轉推 objectID 時建立的 Announce activity ID
+func (a *Actor) SetAnnounceActivityID(objectID string, announceActivityID string) {
+	m := toStringMap((*a)["announcedActivities"])
+	m[objectID] = announceActivityID
+	(*a)["announcedActivities"] = m
+}
+
+// GetAnnounceActivityID 會回傳使用者轉推 objectID 時建立的 Announce activity ID
+func (a *Actor) GetAnnounceActivityID(objectID string) (string, bool) {
+	id, ok := toStringMap((*a)["announcedActivities"])[objectID]
+	return id, ok
+}
+
+// RemoveAnnounceActivityID 會移除轉推 objectID 的紀錄
+func (a *Actor) RemoveAnnounceActivityID(objectID string) {
+	m := toStringMap((*a)["announcedActivities"])
+	delete(m, objectID)
+	(*a)["announcedActivities"] = m
+}
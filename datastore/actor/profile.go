@@ -0,0 +1,91 @@
+package actor
+
+// 這邊是使用者可以自己編輯的個人資料，會顯示在 actor 上，
+// 包括顯示名稱、自我介紹、大頭貼、封面圖片以及 Mastodon 的個人資料欄位 (PropertyValue)。
+
+// GetName 會回傳顯示名稱，沒有設定的話回傳空字串
+func (a *Actor) GetName() string {
+	s, _ := (*a)["name"].(string)
+	return s
+}
+
+func (a *Actor) SetName(name string) {
+	(*a)["name"] = name
+}
+
+// GetSummary 會回傳自我介紹，summary 是轉換過的 HTML，source 是使用者輸入的原始內容
+func (a *Actor) GetSummary() (summary string, source string) {
+	summary, _ = (*a)["summary"].(string)
+	source, _ = (*a)["summarySource"].(string)
+	return summary, source
+}
+
+func (a *Actor) SetSummary(summary string, source string) {
+	(*a)["summary"] = summary
+	(*a)["summarySource"] = source
+}
+
+// GetIcon 會回傳大頭貼，有 url 和 mediaType 兩個欄位，沒有設定的話回傳空的 map
+func (a *Actor) GetIcon() map[string]string {
+	return toStringMap((*a)["icon"])
+}
+
+// SetIcon 會設定大頭貼，url 為空字串的話會移除
+func (a *Actor) SetIcon(url string, mediaType string) {
+	setImage(a, "icon", url, mediaType)
+}
+
+// GetImage 會回傳封面圖片，格式和 GetIcon 相同
+func (a *Actor) GetImage() map[string]string {
+	return toStringMap((*a)["image"])
+}
+
+// SetImage 會設定封面圖片，url 為空字串的話會移除
+func (a *Actor) SetImage(url string, mediaType string) {
+	setImage(a, "image", url, mediaType)
+}
+
+func setImage(a *Actor, field string, url string, mediaType string) {
+	if url == "" {
+		delete(*a, field)
+		return
+	}
+	(*a)[field] = map[string]string{
+		"url":       url,
+		"mediaType": mediaType,
+	}
+}
+
+// GetFields 會回傳個人資料欄位，每一筆有 name、value (轉換過的 HTML) 以及 source (原始內容)
+func (a *Actor) GetFields() []map[string]string {
+	return toStringMapList((*a)["fields"])
+}
+
+func (a *Actor) SetFields(fields []map[string]string) {
+	(*a)["fields"] = fields
+}
+
+// GetProfileTag 會回傳自我介紹和個人資料欄位中的提及和 hashtag
+func (a *Actor) GetProfileTag() []map[string]string {
+	return toStringMapList((*a)["tag"])
+}
+
+func (a *Actor) SetProfileTag(tag []map[string]string) {
+	(*a)["tag"] = tag
+}
+
+// GetDiscoverable 會回傳使用者是否願意出現在推薦或搜尋之類的功能中
+func (a *Actor) GetDiscoverable() bool {
+	b, _ := (*a)["discoverable"].(bool)
+	return b
+}
+
+func (a *Actor) SetDiscoverable(discoverable bool) {
+	(*a)["discoverable"] = discoverable
+}
+
+// GetPublished 會回傳帳號建立的時間，舊的帳號沒有記錄的話回傳空字串
+func (a *Actor) GetPublished() string {
+	s, _ := (*a)["published"].(string)
+	return s
+}
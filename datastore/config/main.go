@@ -14,6 +14,20 @@ type Config struct {
 	EnableAutoAcceptFollow bool `json:"enable_auto_accept_follow"`
 	// Invite Code 如果有被設定的話，則需要透過這個 Invite Code 才能註冊
 	InviteCode string `json:"invite_code"`
+	// 送往同一個 inbox 連續失敗超過這個天數之後就放棄重送，0 的話使用預設值 7 天
+	DeliveryDeadLetterDays int `json:"delivery_dead_letter_days"`
+	// outbox 和 inbox 每一頁最多回傳的數量，0 的話使用預設值 20
+	CollectionPageSize int `json:"collection_page_size"`
+	// 使用者上傳的檔案存放的資料夾，空字串的話使用預設值 ./media
+	MediaDir string `json:"media_dir"`
+	// 上傳的圖片長邊超過這個大小的話會被縮小，0 的話使用預設值 1920
+	MediaMaxDimension int `json:"media_max_dimension"`
+	// 其他站的圖片和影片會透過 /media_proxy 取得並快取在這個資料夾，空字串的話使用預設值 ./media_cache
+	MediaCacheDir string `json:"media_cache_dir"`
+	// 快取最多使用的空間 (bytes)，超過的話會從最久沒有使用的開始刪除，0 的話使用預設值 1 GiB
+	MediaCacheMaxBytes int64 `json:"media_cache_max_bytes"`
+	// /media_proxy 單一檔案的大小上限 (bytes)，0 的話使用預設值 20 MiB
+	MediaProxyMaxBytes int64 `json:"media_proxy_max_bytes"`
 }
 
 var runningConfig Config
@@ -54,6 +68,83 @@ func SetInviteCode(code string) {
 	runningConfig.InviteCode = code
 }
 
+func GetDeliveryDeadLetterDays() int {
+	if runningConfig.DeliveryDeadLetterDays <= 0 {
+		return 7
+	}
+	return runningConfig.DeliveryDeadLetterDays
+}
+
+func SetDeliveryDeadLetterDays(days int) {
+	runningConfig.DeliveryDeadLetterDays = days
+}
+
+func GetCollectionPageSize() int {
+	if runningConfig.CollectionPageSize <= 0 {
+		return 20
+	}
+	return runningConfig.CollectionPageSize
+}
+
+func SetCollectionPageSize(size int) {
+	runningConfig.CollectionPageSize = size
+}
+
+func GetMediaDir() string {
+	if runningConfig.MediaDir == "" {
+		return "./media"
+	}
+	return runningConfig.MediaDir
+}
+
+func SetMediaDir(dir string) {
+	runningConfig.MediaDir = dir
+}
+
+func GetMediaMaxDimension() int {
+	if runningConfig.MediaMaxDimension <= 0 {
+		return 1920
+	}
+	return runningConfig.MediaMaxDimension
+}
+
+func SetMediaMaxDimension(dimension int) {
+	runningConfig.MediaMaxDimension = dimension
+}
+
+func GetMediaCacheDir() string {
+	if runningConfig.MediaCacheDir == "" {
+		return "./media_cache"
+	}
+	return runningConfig.MediaCacheDir
+}
+
+func SetMediaCacheDir(dir string) {
+	runningConfig.MediaCacheDir = dir
+}
+
+func GetMediaCacheMaxBytes() int64 {
+	if runningConfig.MediaCacheMaxBytes <= 0 {
+		return 1 << 30
+	}
+	return runningConfig.MediaCacheMaxBytes
+}
+
+func SetMediaCacheMaxBytes(size int64) {
+	runningConfig.MediaCacheMaxBytes = size
+}
+
+func GetMediaProxyMaxBytes() int64 {
+	if runningConfig.MediaProxyMaxBytes <= 0 {
+		return 20 << 20
+	}
+	return runningConfig.MediaProxyMaxBytes
+}
+
+func SetMediaProxyMaxBytes(size int64) {
+	runningConfig.MediaProxyMaxBytes = size
+}
+
 func LoadConfig(filepath string) error {
 	f, err := os.ReadFile(filepath)
 	if err != nil {
@@ -0,0 +1,365 @@
+package delivery
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// delivery 存放的是等待送到對方 inbox 的 activity，
+// 因為對方伺服器隨時可能會暫時無法連線，所以需要存下來之後重試，
+// 並且在程式重新啟動之後還能夠繼續送出。
+
+type Delivery map[string]interface{}
+
+// 以 Delivery ID 為 key 存放所有尚未完成 (以及已經放棄) 的 Delivery
+var datastore = &sync.Map{}
+
+// 以 inbox 的網址為 key 存放每個 inbox 的狀態，例如從什麼時候開始連續失敗
+var inboxDatastore = &sync.Map{}
+
+// worker 會在不同的 goroutine 中修改 Delivery 以及寫檔，
+// 所以讀取、修改 Delivery 內容以及寫檔時都需要鎖起來
+var lock = sync.RWMutex{}
+
+func LoadDelivery(filepath string) error {
+	slog.Debug("delivery.Load", "info", "load deliveries")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmpMap := map[string]map[string]interface{}{}
+	tmpDatastore := sync.Map{}
+	tmpInboxDatastore := sync.Map{}
+
+	err = json.Unmarshal(f, &tmpMap)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range tmpMap["deliveries"] {
+		m := v.(map[string]interface{})
+		d := Delivery(m)
+		tmpDatastore.Store(k, &d)
+	}
+	for k, v := range tmpMap["inboxes"] {
+		tmpInboxDatastore.Store(k, v.(map[string]interface{}))
+	}
+
+	// old datastore should be garbage collected
+	datastore = &tmpDatastore
+	inboxDatastore = &tmpInboxDatastore
+	slog.Info("delivery.Load", "info", "deliveries loaded")
+	return nil
+}
+
+func SaveDelivery(filepath string) error {
+	slog.Debug("delivery.Save", "info", "save deliveries", "filepath", filepath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	deliveries := map[string]interface{}{}
+	datastore.Range(func(k, v interface{}) bool {
+		deliveries[k.(string)] = v
+		return true
+	})
+	inboxes := map[string]interface{}{}
+	inboxDatastore.Range(func(k, v interface{}) bool {
+		inboxes[k.(string)] = v
+		return true
+	})
+
+	f, err := json.MarshalIndent(map[string]interface{}{
+		"deliveries": deliveries,
+		"inboxes":    inboxes,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("delivery.Save", "info", "deliveries saved")
+	return nil
+}
+
+// NewDelivery 會建立一個新的 Delivery 並放進佇列中，
+// receiverActorID 和 inbox 至少要給一個，如果還不知道 inbox 的話，會在送出時由 receiverActorID 解析。
+// activity 會先複製一份，避免呼叫端之後修改到佇列中的內容。
+func NewDelivery(senderUsername string, receiverActorID string, inbox string, activity map[string]interface{}) (*Delivery, error) {
+	d, err := newDelivery(senderUsername, receiverActorID, inbox, nil, activity)
+	if err != nil {
+		return nil, err
+	}
+	datastore.Store(d.GetID(), d)
+	return d, nil
+}
+
+// NewFanoutDelivery 會建立一個要送給多個 actor 的 Delivery，
+// 解析 inbox 需要向對方伺服器查詢，所以先把整個請求存下來，
+// 之後由 worker 解析成每個 inbox 各自的 Delivery，這樣解析途中重新啟動也不會遺失。
+func NewFanoutDelivery(senderUsername string, receiverActorIDs []string, activity map[string]interface{}) (*Delivery, error) {
+	d, err := newDelivery(senderUsername, "", "", append([]string{}, receiverActorIDs...), activity)
+	if err != nil {
+		return nil, err
+	}
+	datastore.Store(d.GetID(), d)
+	return d, nil
+}
+
+// newDelivery 會建立完整的 Delivery 但不放進佇列中，
+// 放進佇列之後 worker 隨時可能讀取或存檔，所以所有欄位都要在這之前設定好。
+// receivers 不是 nil 的話會是一個 fanout 的 Delivery。
+func newDelivery(senderUsername string, receiverActorID string, inbox string, receivers []string, activity map[string]interface{}) (*Delivery, error) {
+	b, err := json.Marshal(activity)
+	if err != nil {
+		return nil, err
+	}
+	activityCopy := map[string]interface{}{}
+	err = json.Unmarshal(b, &activityCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	d := Delivery{
+		"id":            generateID(),
+		"sender":        senderUsername,
+		"receiver":      receiverActorID,
+		"activity":      activityCopy,
+		"attempts":      0,
+		"createdAt":     now,
+		"nextAttemptAt": now,
+	}
+	if inbox != "" {
+		d["inbox"] = inbox
+	}
+	if receivers != nil {
+		d["receivers"] = receivers
+	}
+	return &d, nil
+}
+
+func FindDeliveryByID(id string) (*Delivery, error) {
+	if v, ok := datastore.Load(id); ok {
+		return v.(*Delivery), nil
+	}
+	return nil, fmt.Errorf("delivery not found")
+}
+
+func RemoveDelivery(id string) {
+	datastore.Delete(id)
+}
+
+// PruneDeadDeliveries 會移除在 before 之前就已經放棄的 Delivery，回傳移除的數量
+func PruneDeadDeliveries(before time.Time) int {
+	count := 0
+	datastore.Range(func(k, v interface{}) bool {
+		d := v.(*Delivery)
+		if d.IsDead() && d.GetDeadAt().Before(before) {
+			datastore.Delete(k)
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// GetDueDeliveries 會回傳所有在 now 時間點應該要嘗試送出的 Delivery，
+// 已經放棄 (dead) 的不會被包含在內。
+func GetDueDeliveries(now time.Time) []*Delivery {
+	list := []*Delivery{}
+	datastore.Range(func(k, v interface{}) bool {
+		d := v.(*Delivery)
+		if d.IsDead() {
+			return true
+		}
+		if d.GetNextAttemptAt().After(now) {
+			return true
+		}
+		list = append(list, d)
+		return true
+	})
+	return list
+}
+
+func (d *Delivery) GetID() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	return (*d)["id"].(string)
+}
+
+func (d *Delivery) GetSender() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	return (*d)["sender"].(string)
+}
+
+func (d *Delivery) GetReceiver() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	s, _ := (*d)["receiver"].(string)
+	return s
+}
+
+// GetReceivers 會回傳 NewFanoutDelivery 建立時的所有 actor，一般的 Delivery 會是空的
+func (d *Delivery) GetReceivers() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	switch l := (*d)["receivers"].(type) {
+	case []string:
+		return l
+	case []interface{}:
+		list := make([]string, 0, len(l))
+		for _, v := range l {
+			if s, ok := v.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return []string{}
+}
+
+// IsFanout 會回傳這個 Delivery 是否是 NewFanoutDelivery 建立的，還沒有解析成個別的 inbox
+func (d *Delivery) IsFanout() bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	_, ok := (*d)["receivers"]
+	return ok
+}
+
+// GetInbox 會回傳這個 Delivery 要送到的 inbox，尚未解析過的話會是空字串
+func (d *Delivery) GetInbox() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	s, _ := (*d)["inbox"].(string)
+	return s
+}
+
+func (d *Delivery) SetInbox(inbox string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	(*d)["inbox"] = inbox
+}
+
+// GetActivity 會回傳要送出的 activity，activity 在建立之後不會再被修改
+func (d *Delivery) GetActivity() map[string]interface{} {
+	lock.RLock()
+	defer lock.RUnlock()
+	m, _ := (*d)["activity"].(map[string]interface{})
+	return m
+}
+
+func (d *Delivery) GetAttempts() int {
+	lock.RLock()
+	defer lock.RUnlock()
+	return d.attempts()
+}
+
+// attempts 和 GetAttempts 相同，但是需要在已經鎖住的情況下呼叫
+func (d *Delivery) attempts() int {
+	// 從 JSON 讀進來的數字會是 float64
+	switch v := (*d)["attempts"].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func (d *Delivery) GetCreatedAt() time.Time {
+	lock.RLock()
+	defer lock.RUnlock()
+	return parseTime((*d)["createdAt"])
+}
+
+func (d *Delivery) GetNextAttemptAt() time.Time {
+	lock.RLock()
+	defer lock.RUnlock()
+	return parseTime((*d)["nextAttemptAt"])
+}
+
+// GetDeadAt 會回傳放棄的時間，還沒有放棄的話會是 zero time
+func (d *Delivery) GetDeadAt() time.Time {
+	lock.RLock()
+	defer lock.RUnlock()
+	return parseTime((*d)["deadAt"])
+}
+
+// ScheduleRetry 會記錄這次失敗的原因，並且把下一次嘗試的時間設定在 next
+func (d *Delivery) ScheduleRetry(next time.Time, reason string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	(*d)["attempts"] = d.attempts() + 1
+	(*d)["nextAttemptAt"] = next.UTC().Format(time.RFC3339)
+	(*d)["lastError"] = reason
+}
+
+// MarkDead 會把這個 Delivery 標記為放棄 (dead letter)，之後不會再嘗試送出，
+// 但是會在檔案中保留 delivery_dead_letter_days 天方便管理者查看，之後由 PruneDeadDeliveries 移除。
+func (d *Delivery) MarkDead(reason string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	(*d)["attempts"] = d.attempts() + 1
+	(*d)["deadAt"] = time.Now().UTC().Format(time.RFC3339)
+	(*d)["lastError"] = reason
+}
+
+func (d *Delivery) IsDead() bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	_, ok := (*d)["deadAt"]
+	return ok
+}
+
+// MarkInboxFailure 會記錄 inbox 送出失敗，並回傳這個 inbox 從什麼時候開始連續失敗
+func MarkInboxFailure(inbox string, now time.Time) time.Time {
+	v, _ := inboxDatastore.LoadOrStore(inbox, map[string]interface{}{
+		"failingSince": now.UTC().Format(time.RFC3339),
+	})
+	return parseTime(v.(map[string]interface{})["failingSince"])
+}
+
+// MarkInboxSuccess 會清除 inbox 的失敗紀錄
+func MarkInboxSuccess(inbox string) {
+	inboxDatastore.Delete(inbox)
+}
+
+// GetInboxFailingSince 會回傳 inbox 從什麼時候開始連續失敗，
+// 如果目前沒有失敗紀錄的話第二個回傳值會是 false。
+func GetInboxFailingSince(inbox string) (time.Time, bool) {
+	v, ok := inboxDatastore.Load(inbox)
+	if !ok {
+		return time.Time{}, false
+	}
+	return parseTime(v.(map[string]interface{})["failingSince"]), true
+}
+
+func parseTime(v interface{}) time.Time {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func generateID() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return fmt.Sprintf("%x", buf)
+}
@@ -0,0 +1,87 @@
+package delivery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewFanoutDelivery(t *testing.T) {
+	receivers := []string{"https://remote.example/users/bob", "https://other.example/users/carol"}
+	activity := map[string]interface{}{"type": "Create"}
+	d, err := NewFanoutDelivery("alice", receivers, activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDelivery(d.GetID())
+
+	// 放進佇列的時候就必須已經是完整的 fanout Delivery
+	stored, err := FindDeliveryByID(d.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsFanout() {
+		t.Errorf("IsFanout() = false, expected true")
+	}
+	if !reflect.DeepEqual(stored.GetReceivers(), receivers) {
+		t.Errorf("GetReceivers() = %v, expected %v", stored.GetReceivers(), receivers)
+	}
+
+	// 呼叫端之後修改傳入的內容不會影響到佇列中的 Delivery
+	receivers[0] = "https://evil.example/users/mallory"
+	activity["type"] = "Delete"
+	if stored.GetReceivers()[0] != "https://remote.example/users/bob" {
+		t.Errorf("GetReceivers() changed with the caller's slice: %v", stored.GetReceivers())
+	}
+	if stored.GetActivity()["type"] != "Create" {
+		t.Errorf("GetActivity() changed with the caller's map: %v", stored.GetActivity())
+	}
+}
+
+func TestPruneDeadDeliveries(t *testing.T) {
+	type TestCase struct {
+		name   string
+		deadAt string
+		pruned bool
+	}
+
+	now := time.Now().UTC()
+	testCases := []TestCase{
+		{
+			name: "pending",
+		},
+		{
+			name:   "dead recently",
+			deadAt: now.Add(-time.Hour).Format(time.RFC3339),
+		},
+		{
+			name:   "dead long ago",
+			deadAt: now.Add(-30 * 24 * time.Hour).Format(time.RFC3339),
+			pruned: true,
+		},
+	}
+
+	ids := map[string]string{}
+	for _, tc := range testCases {
+		d, err := NewDelivery("alice", "https://remote.example/users/bob", "", map[string]interface{}{"type": "Create"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.deadAt != "" {
+			(*d)["deadAt"] = tc.deadAt
+		}
+		ids[tc.name] = d.GetID()
+	}
+
+	count := PruneDeadDeliveries(now.Add(-7 * 24 * time.Hour))
+	if count != 1 {
+		t.Errorf("PruneDeadDeliveries() = %d, expected 1", count)
+	}
+	for _, tc := range testCases {
+		_, err := FindDeliveryByID(ids[tc.name])
+		if (err != nil) != tc.pruned {
+			t.Errorf("%s: pruned = %v, expected %v", tc.name, err != nil, tc.pruned)
+		}
+		RemoveDelivery(ids[tc.name])
+	}
+}
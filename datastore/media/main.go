@@ -0,0 +1,236 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+)
+
+// media 存放的是使用者上傳的檔案的資訊，檔案本身放在 config 的 media_dir 中，
+// 發文時可以用 ID 把上傳過的檔案加進 note 的 attachment。
+
+type Media map[string]interface{}
+
+// 以 media 的 ID 為 key 存放
+var datastore = &sync.Map{}
+
+// 上傳可能同時發生，所以寫檔時需要鎖起來
+var saveLock = sync.Mutex{}
+
+func LoadMedia(filepath string) error {
+	slog.Debug("media.Load", "info", "load media")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmpMap := map[string]interface{}{}
+	tmpDatastore := sync.Map{}
+
+	err = json.Unmarshal(f, &tmpMap)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range tmpMap {
+		m := v.(map[string]interface{})
+		o := Media(m)
+		tmpDatastore.Store(k, &o)
+	}
+
+	// old datastore should be garbage collected
+	datastore = &tmpDatastore
+	slog.Info("media.Load", "info", "media loaded")
+	return nil
+}
+
+func SaveMedia(filepath string) error {
+	slog.Debug("media.Save", "info", "save media", "filepath", filepath)
+	saveLock.Lock()
+	defer saveLock.Unlock()
+
+	tmpMap := map[string]interface{}{}
+	datastore.Range(func(k, v interface{}) bool {
+		tmpMap[k.(string)] = v
+		return true
+	})
+
+	f, err := json.MarshalIndent(tmpMap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("media.Save", "info", "media saved")
+	return nil
+}
+
+// NewMedia 會建立一筆新的 media，file 是放在 media_dir 中的檔名，
+// attachmentType 是 ActivityStreams 的類型 (Image、Video 或 Document)。
+func NewMedia(id string, owner string, file string, attachmentType string, mediaType string) *Media {
+	m := Media{
+		"id":        id,
+		"owner":     owner,
+		"file":      file,
+		"type":      attachmentType,
+		"mediaType": mediaType,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+	}
+	datastore.Store(id, &m)
+	return &m
+}
+
+func FindMediaByID(id string) (*Media, error) {
+	if v, ok := datastore.Load(id); ok {
+		return v.(*Media), nil
+	}
+	return nil, fmt.Errorf("media not found")
+}
+
+// FindMediaByFile 會用 media_dir 中的檔名 (原檔或是縮圖) 找出 media，
+// 檔名是 ID 加上副檔名 (縮圖則是 ID_thumb 加上副檔名)，所以直接從檔名取出 ID 查詢，
+// 最後還會確認檔名和記錄的相同。
+func FindMediaByFile(file string) (*Media, error) {
+	id := strings.TrimSuffix(file, path.Ext(file))
+	id = strings.TrimSuffix(id, "_thumb")
+	m, err := FindMediaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.GetFile() != file && m.GetThumbnailFile() != file {
+		return nil, fmt.Errorf("media not found")
+	}
+	return m, nil
+}
+
+func RemoveMedia(id string) {
+	datastore.Delete(id)
+}
+
+func (m *Media) GetID() string {
+	s, _ := (*m)["id"].(string)
+	return s
+}
+
+// GetOwner 會回傳上傳的使用者名稱
+func (m *Media) GetOwner() string {
+	s, _ := (*m)["owner"].(string)
+	return s
+}
+
+func (m *Media) GetFile() string {
+	s, _ := (*m)["file"].(string)
+	return s
+}
+
+// GetURL 會回傳檔案對外的網址
+func (m *Media) GetURL() string {
+	return "https://" + config.GetDomain() + "/media/" + m.GetFile()
+}
+
+func (m *Media) GetType() string {
+	s, _ := (*m)["type"].(string)
+	return s
+}
+
+func (m *Media) GetMediaType() string {
+	s, _ := (*m)["mediaType"].(string)
+	return s
+}
+
+// GetThumbnailFile 會回傳縮圖的檔名，沒有縮圖的話回傳空字串
+func (m *Media) GetThumbnailFile() string {
+	s, _ := (*m)["thumbnail"].(string)
+	return s
+}
+
+func (m *Media) GetThumbnailMediaType() string {
+	s, _ := (*m)["thumbnailMediaType"].(string)
+	return s
+}
+
+func (m *Media) SetThumbnail(file string, mediaType string) {
+	(*m)["thumbnail"] = file
+	(*m)["thumbnailMediaType"] = mediaType
+}
+
+// GetThumbnailURL 會回傳縮圖的網址，沒有縮圖的話回傳原檔的網址
+func (m *Media) GetThumbnailURL() string {
+	if m.GetThumbnailFile() == "" {
+		return m.GetURL()
+	}
+	return "https://" + config.GetDomain() + "/media/" + m.GetThumbnailFile()
+}
+
+// GetSize 會回傳圖片或影片的寬和高，不知道的話回傳 0
+func (m *Media) GetSize() (width int, height int) {
+	return toInt((*m)["width"]), toInt((*m)["height"])
+}
+
+func (m *Media) SetSize(width int, height int) {
+	(*m)["width"] = width
+	(*m)["height"] = height
+}
+
+// GetName 會回傳替代文字 (alt text)
+func (m *Media) GetName() string {
+	s, _ := (*m)["name"].(string)
+	return s
+}
+
+func (m *Media) SetName(name string) {
+	(*m)["name"] = name
+}
+
+func (m *Media) GetBlurhash() string {
+	s, _ := (*m)["blurhash"].(string)
+	return s
+}
+
+func (m *Media) SetBlurhash(blurhash string) {
+	(*m)["blurhash"] = blurhash
+}
+
+// ToAttachment 會把 media 轉成 note 的 attachment 中的一個項目
+// 相關文件請參閱: https://www.w3.org/TR/activitystreams-vocabulary/#dfn-attachment
+func (m *Media) ToAttachment() map[string]interface{} {
+	a := map[string]interface{}{
+		"type":      m.GetType(),
+		"mediaType": m.GetMediaType(),
+		"url":       m.GetURL(),
+	}
+	if name := m.GetName(); name != "" {
+		a["name"] = name
+	}
+	if width, height := m.GetSize(); width > 0 && height > 0 {
+		a["width"] = width
+		a["height"] = height
+	}
+	if blurhash := m.GetBlurhash(); blurhash != "" {
+		a["blurhash"] = blurhash
+	}
+	return a
+}
+
+// toInt 會把 int 或是從 JSON 讀進來的 float64 轉成 int
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package media
+
+import (
+	"testing"
+)
+
+func TestFindMediaByFile(t *testing.T) {
+	type TestCase struct {
+		name  string
+		file  string
+		id    string
+		isErr bool
+	}
+
+	withThumb := NewMedia("0190f1e2-aaaa-7000-8000-000000000001", "alice", "0190f1e2-aaaa-7000-8000-000000000001.png", "Image", "image/png")
+	withThumb.SetThumbnail("0190f1e2-aaaa-7000-8000-000000000001_thumb.jpg", "image/jpeg")
+	NewMedia("0190f1e2-aaaa-7000-8000-000000000002", "alice", "0190f1e2-aaaa-7000-8000-000000000002.mp4", "Video", "video/mp4")
+	// 沒有副檔名的檔案
+	NewMedia("0190f1e2-aaaa-7000-8000-000000000003", "alice", "0190f1e2-aaaa-7000-8000-000000000003", "Document", "application/octet-stream")
+
+	testCases := []TestCase{
+		{
+			name: "original",
+			file: "0190f1e2-aaaa-7000-8000-000000000001.png",
+			id:   "0190f1e2-aaaa-7000-8000-000000000001",
+		},
+		{
+			name: "thumbnail",
+			file: "0190f1e2-aaaa-7000-8000-000000000001_thumb.jpg",
+			id:   "0190f1e2-aaaa-7000-8000-000000000001",
+		},
+		{
+			name: "video without thumbnail",
+			file: "0190f1e2-aaaa-7000-8000-000000000002.mp4",
+			id:   "0190f1e2-aaaa-7000-8000-000000000002",
+		},
+		{
+			name: "no extension",
+			file: "0190f1e2-aaaa-7000-8000-000000000003",
+			id:   "0190f1e2-aaaa-7000-8000-000000000003",
+		},
+		{
+			// ID 相同但副檔名和記錄的不同
+			name:  "wrong extension",
+			file:  "0190f1e2-aaaa-7000-8000-000000000001.jpg",
+			isErr: true,
+		},
+		{
+			name:  "thumbnail that does not exist",
+			file:  "0190f1e2-aaaa-7000-8000-000000000002_thumb.jpg",
+			isErr: true,
+		},
+		{
+			name:  "unknown id",
+			file:  "0190f1e2-aaaa-7000-8000-000000000009.png",
+			isErr: true,
+		},
+		{
+			name:  "empty",
+			file:  "",
+			isErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		m, err := FindMediaByFile(tc.file)
+		if (err != nil) != tc.isErr {
+			t.Errorf("%s: FindMediaByFile(%q) error = %v, expected error %v", tc.name, tc.file, err, tc.isErr)
+			continue
+		}
+		if err == nil && m.GetID() != tc.id {
+			t.Errorf("%s: FindMediaByFile(%q) = %q, expected %q", tc.name, tc.file, m.GetID(), tc.id)
+		}
+	}
+}
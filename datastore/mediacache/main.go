@@ -0,0 +1,129 @@
+package mediacache
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// mediacache 記錄 /media_proxy 快取在硬碟上的檔案，以原始網址為 key，
+// 檔案本身放在 config 的 media_cache_dir 中，這邊只記錄檔名、類型、大小以及最後使用的時間，
+// 超過空間上限時會從最久沒有使用的開始刪除 (LRU)。
+
+type Entry struct {
+	URL         string    `json:"url"`
+	File        string    `json:"file"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	LastAccess  time.Time `json:"lastAccess"`
+}
+
+var datastore = map[string]*Entry{}
+
+// 快取會在多個請求中同時被讀寫，所以都需要鎖起來
+var lock = sync.Mutex{}
+
+func LoadMediaCache(filepath string) error {
+	slog.Debug("mediacache.Load", "info", "load media cache")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmpMap := map[string]*Entry{}
+	err = json.Unmarshal(f, &tmpMap)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	datastore = tmpMap
+	lock.Unlock()
+	slog.Info("mediacache.Load", "info", "media cache loaded")
+	return nil
+}
+
+func SaveMediaCache(filepath string) error {
+	slog.Debug("mediacache.Save", "info", "save media cache", "filepath", filepath)
+	lock.Lock()
+	f, err := json.MarshalIndent(datastore, "", "  ")
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("mediacache.Save", "info", "media cache saved")
+	return nil
+}
+
+// Get 會回傳 url 的快取並更新最後使用的時間
+func Get(url string) (Entry, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	e, ok := datastore[url]
+	if !ok {
+		return Entry{}, false
+	}
+	e.LastAccess = time.Now().UTC()
+	return *e, true
+}
+
+// Put 會記錄一筆新的快取，已經存在的話會替換掉
+func Put(e Entry) {
+	lock.Lock()
+	defer lock.Unlock()
+	e.LastAccess = time.Now().UTC()
+	datastore[e.URL] = &e
+}
+
+// Remove 會移除 url 的快取紀錄
+func Remove(url string) {
+	lock.Lock()
+	defer lock.Unlock()
+	delete(datastore, url)
+}
+
+// Evict 會從最久沒有使用的開始移除紀錄，直到總大小不超過 budget，
+// 回傳被移除的紀錄，檔案需要由呼叫的人刪除。
+// keep 是剛剛放進來、還要回傳給使用者的網址，不會被移除。
+func Evict(budget int64, keep string) []Entry {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var total int64
+	entries := make([]*Entry, 0, len(datastore))
+	for _, e := range datastore {
+		total += e.Size
+		entries = append(entries, e)
+	}
+	if total <= budget {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccess.Before(entries[j].LastAccess)
+	})
+
+	evicted := []Entry{}
+	for _, e := range entries {
+		if total <= budget {
+			break
+		}
+		if e.URL == keep {
+			continue
+		}
+		total -= e.Size
+		delete(datastore, e.URL)
+		evicted = append(evicted, *e)
+	}
+	return evicted
+}
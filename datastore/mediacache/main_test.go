@@ -0,0 +1,112 @@
+package mediacache
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEvict(t *testing.T) {
+	type TestCase struct {
+		name    string
+		budget  int64
+		keep    string
+		evicted []string
+	}
+
+	// 數字越小代表越久沒有使用
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{URL: "https://remote.example/1.png", Size: 100, LastAccess: base.Add(1 * time.Minute)},
+		{URL: "https://remote.example/2.png", Size: 200, LastAccess: base.Add(2 * time.Minute)},
+		{URL: "https://remote.example/3.png", Size: 300, LastAccess: base.Add(3 * time.Minute)},
+		{URL: "https://remote.example/4.png", Size: 400, LastAccess: base.Add(4 * time.Minute)},
+	}
+
+	testCases := []TestCase{
+		{
+			name:    "within budget",
+			budget:  1000,
+			evicted: []string{},
+		},
+		{
+			name:    "least recently used first",
+			budget:  900,
+			evicted: []string{"https://remote.example/1.png"},
+		},
+		{
+			name:    "until within budget",
+			budget:  500,
+			evicted: []string{"https://remote.example/1.png", "https://remote.example/2.png", "https://remote.example/3.png"},
+		},
+		{
+			// keep 即使是最久沒有使用的也不會被移除
+			name:    "keep the new entry",
+			budget:  900,
+			keep:    "https://remote.example/1.png",
+			evicted: []string{"https://remote.example/2.png"},
+		},
+		{
+			name:    "keep larger than budget",
+			budget:  100,
+			keep:    "https://remote.example/4.png",
+			evicted: []string{"https://remote.example/1.png", "https://remote.example/2.png", "https://remote.example/3.png"},
+		},
+		{
+			name:    "zero budget",
+			budget:  0,
+			evicted: []string{"https://remote.example/1.png", "https://remote.example/2.png", "https://remote.example/3.png", "https://remote.example/4.png"},
+		},
+	}
+
+	for _, tc := range testCases {
+		datastore = map[string]*Entry{}
+		for _, e := range entries {
+			e := e
+			datastore[e.URL] = &e
+		}
+
+		evicted := []string{}
+		for _, e := range Evict(tc.budget, tc.keep) {
+			evicted = append(evicted, e.URL)
+		}
+		if !reflect.DeepEqual(evicted, tc.evicted) {
+			t.Errorf("%s: Evict() = %v, expected %v", tc.name, evicted, tc.evicted)
+		}
+
+		// 被移除的紀錄也要從快取中拿掉，其他的則要留著
+		remaining := []string{}
+		for url := range datastore {
+			remaining = append(remaining, url)
+		}
+		sort.Strings(remaining)
+		expected := []string{}
+		for _, e := range entries {
+			if !slices.Contains(tc.evicted, e.URL) {
+				expected = append(expected, e.URL)
+			}
+		}
+		if !reflect.DeepEqual(remaining, expected) {
+			t.Errorf("%s: remaining = %v, expected %v", tc.name, remaining, expected)
+		}
+	}
+}
+
+func TestGetUpdatesLastAccess(t *testing.T) {
+	datastore = map[string]*Entry{}
+	Put(Entry{URL: "https://remote.example/old.png", Size: 100})
+	Put(Entry{URL: "https://remote.example/new.png", Size: 100})
+	datastore["https://remote.example/old.png"].LastAccess = time.Now().Add(-2 * time.Hour)
+	datastore["https://remote.example/new.png"].LastAccess = time.Now().Add(-1 * time.Hour)
+
+	// 使用過之後就變成最近使用的，改成移除另一個
+	if _, ok := Get("https://remote.example/old.png"); !ok {
+		t.Fatal("Get() = false, expected true")
+	}
+	evicted := Evict(100, "")
+	if len(evicted) != 1 || evicted[0].URL != "https://remote.example/new.png" {
+		t.Errorf("Evict() = %v, expected https://remote.example/new.png", evicted)
+	}
+}
@@ -0,0 +1,42 @@
+package object
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+)
+
+// https://www.w3.org/TR/activitystreams-vocabulary/#dfn-announce
+// 本站送出的 Announce 也會存成 object，這樣 outbox 和 RouteObject 都可以取得。
+func NewAnnounce(actorID string, objectID string) *Object {
+	id := GenerateUUIDv7()
+	announce := Object{
+		"id":        "https://" + config.GetDomain() + "/.activitypub/object/" + id,
+		"type":      "Announce",
+		"actor":     actorID,
+		"object":    objectID,
+		"published": time.Now().Format(time.RFC3339),
+	}
+	datastore.Store(id, &announce)
+	return &announce
+}
+
+// GetActor 會回傳 activity 的 actor，不是 activity 的話回傳空字串
+func (o *Object) GetActor() string {
+	s, _ := (*o)["actor"].(string)
+	return s
+}
+
+// GetObject 會回傳 activity 的 object ID，不是 activity 的話回傳空字串
+func (o *Object) GetObject() string {
+	s, _ := (*o)["object"].(string)
+	return s
+}
+
+// RemoveObject 會從 datastore 中移除 object
+func RemoveObject(id string) {
+	domainPrefix := "https://" + config.GetDomain() + "/.activitypub/object/"
+	id = strings.TrimPrefix(id, domainPrefix)
+	datastore.Delete(id)
+}
@@ -80,6 +80,13 @@ func FindObjectByID(id string) (*Object, error) {
 	return nil, fmt.Errorf("object not found")
 }
 
+// RangeObjects 會依序把每個本站的 object 傳給 f，f 回傳 false 時停止
+func RangeObjects(f func(o *Object) bool) {
+	datastore.Range(func(k, v interface{}) bool {
+		return f(v.(*Object))
+	})
+}
+
 func GenerateUUIDv7() string {
 	// UUIDv7
 	var buf [16]byte
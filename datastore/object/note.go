@@ -47,6 +47,22 @@ func (o *Object) SetContent(content string) {
 	(*o)["content"] = content
 }
 
+// GetSource 會回傳使用者發文時輸入的原始內容以及它的格式 (mediaType)，
+// 沒有原始內容的話 (例如舊的資料) 回傳空字串
+func (o *Object) GetSource() (content string, mediaType string) {
+	m := toStringMap((*o)["source"])
+	return m["content"], m["mediaType"]
+}
+
+// SetSource 會設定原始內容，content 則是由原始內容轉換出來的 HTML
+// 相關文件請參閱: https://www.w3.org/TR/activitypub/#source-property
+func (o *Object) SetSource(content string, mediaType string) {
+	(*o)["source"] = map[string]string{
+		"content":   content,
+		"mediaType": mediaType,
+	}
+}
+
 func (o *Object) GetAttributedTo() string {
 	return (*o)["attributedTo"].(string)
 }
@@ -64,18 +80,11 @@ func (o *Object) GetInReplyTo() string {
 }
 
 func (o *Object) GetTag() []map[string]string {
-	l, ok := (*o)["tag"].([]map[string]string)
-	if !ok {
-		return []map[string]string{}
-	}
-	return l
+	return toStringMapList((*o)["tag"])
 }
 
 func (o *Object) AddTag(name, url string) {
-	list, ok := (*o)["tag"].([]map[string]string)
-	if !ok {
-		list = []map[string]string{}
-	}
+	list := o.GetTag()
 	for _, t := range list {
 		if t["name"] == name {
 			return
@@ -84,23 +93,73 @@ func (o *Object) AddTag(name, url string) {
 	(*o)["tag"] = append(list, map[string]string{"name": name, "href": url, "type": "Mention"})
 }
 
+// AddHashtag 會加上 Hashtag 類型的 tag，name 需要包含 #
+func (o *Object) AddHashtag(name, url string) {
+	list := o.GetTag()
+	for _, t := range list {
+		if t["type"] == "Hashtag" && strings.EqualFold(t["name"], name) {
+			return
+		}
+	}
+	(*o)["tag"] = append(list, map[string]string{"name": name, "href": url, "type": "Hashtag"})
+}
+
+// RemoveHashtags 會移除所有 Hashtag 類型的 tag，編輯內容時會重新產生
+func (o *Object) RemoveHashtags() {
+	list := []map[string]string{}
+	for _, t := range o.GetTag() {
+		if t["type"] != "Hashtag" {
+			list = append(list, t)
+		}
+	}
+	(*o)["tag"] = list
+}
+
+// RemoveMentions 會移除所有 Mention 類型的 tag，以及因為提及而加進 cc 的 actor，編輯內容時會重新產生。
+// keep 是不因為提及也要留在 cc 中的 actor (例如回覆對象的作者)。
+func (o *Object) RemoveMentions(keep string) {
+	mentioned := map[string]bool{}
+	list := []map[string]string{}
+	for _, t := range o.GetTag() {
+		if t["type"] == "Mention" {
+			mentioned[t["href"]] = true
+			continue
+		}
+		list = append(list, t)
+	}
+	(*o)["tag"] = list
+
+	cc := []string{}
+	for _, c := range o.GetCC() {
+		if mentioned[c] && c != keep {
+			continue
+		}
+		cc = append(cc, c)
+	}
+	(*o)["cc"] = cc
+}
+
+// GetHashtags 會回傳所有 hashtag 的名稱 (包含 #)
+func (o *Object) GetHashtags() []string {
+	names := []string{}
+	for _, t := range o.GetTag() {
+		if t["type"] == "Hashtag" {
+			names = append(names, t["name"])
+		}
+	}
+	return names
+}
+
 func (o *Object) SetInReplyTo(inReplyTo string) {
 	(*o)["inReplyTo"] = inReplyTo
 }
 
 func (o *Object) GetTo() []string {
-	l, ok := (*o)["to"].([]string)
-	if !ok {
-		return []string{}
-	}
-	return l
+	return toStringList((*o)["to"])
 }
 
 func (o *Object) AddTo(to string) {
-	list, ok := (*o)["to"].([]string)
-	if !ok {
-		list = []string{}
-	}
+	list := toStringList((*o)["to"])
 	for _, t := range list {
 		if t == to {
 			return
@@ -110,18 +169,11 @@ func (o *Object) AddTo(to string) {
 }
 
 func (o *Object) GetBto() []string {
-	l, ok := (*o)["bto"].([]string)
-	if !ok {
-		return []string{}
-	}
-	return l
+	return toStringList((*o)["bto"])
 }
 
 func (o *Object) AddBto(bto string) {
-	list, ok := (*o)["bto"].([]string)
-	if !ok {
-		list = []string{}
-	}
+	list := toStringList((*o)["bto"])
 	for _, b := range list {
 		if b == bto {
 			return
@@ -131,18 +183,11 @@ func (o *Object) AddBto(bto string) {
 }
 
 func (o *Object) GetCC() []string {
-	l, ok := (*o)["cc"].([]string)
-	if !ok {
-		return []string{}
-	}
-	return l
+	return toStringList((*o)["cc"])
 }
 
 func (o *Object) AddCC(cc string) {
-	list, ok := (*o)["cc"].([]string)
-	if !ok {
-		list = []string{}
-	}
+	list := toStringList((*o)["cc"])
 	for _, c := range list {
 		if c == cc {
 			return
@@ -152,18 +197,11 @@ func (o *Object) AddCC(cc string) {
 }
 
 func (o *Object) GetBCC() []string {
-	l, ok := (*o)["bcc"].([]string)
-	if !ok {
-		return []string{}
-	}
-	return l
+	return toStringList((*o)["bcc"])
 }
 
 func (o *Object) AddBCC(bcc string) {
-	list, ok := (*o)["bcc"].([]string)
-	if !ok {
-		list = []string{}
-	}
+	list := toStringList((*o)["bcc"])
 	for _, b := range list {
 		if b == bcc {
 			return
@@ -173,18 +211,11 @@ func (o *Object) AddBCC(bcc string) {
 }
 
 func (o *Object) GetAudience() []string {
-	l, ok := (*o)["audience"].([]string)
-	if !ok {
-		return []string{}
-	}
-	return l
+	return toStringList((*o)["audience"])
 }
 
 func (o *Object) AddAudience(audience string) {
-	list, ok := (*o)["audience"].([]string)
-	if !ok {
-		list = []string{}
-	}
+	list := toStringList((*o)["audience"])
 	for _, a := range list {
 		if a == audience {
 			return
@@ -192,3 +223,85 @@ func (o *Object) AddAudience(audience string) {
 	}
 	(*o)["audience"] = append(list, audience)
 }
+
+// GetAttachment 會回傳附加的檔案，每個項目有 type、mediaType、url 以及 name、width、height、blurhash 等欄位
+func (o *Object) GetAttachment() []map[string]interface{} {
+	switch l := (*o)["attachment"].(type) {
+	case []map[string]interface{}:
+		return l
+	case []interface{}:
+		r := []map[string]interface{}{}
+		for _, v := range l {
+			if m, ok := v.(map[string]interface{}); ok {
+				r = append(r, m)
+			}
+		}
+		return r
+	}
+	return []map[string]interface{}{}
+}
+
+func (o *Object) AddAttachment(attachment map[string]interface{}) {
+	(*o)["attachment"] = append(o.GetAttachment(), attachment)
+}
+
+// GetUpdated 會回傳 object 最後一次編輯的時間，沒有編輯過的話回傳空字串
+func (o *Object) GetUpdated() string {
+	s, _ := (*o)["updated"].(string)
+	return s
+}
+
+// Edit 會把 content 換成新的內容，並把舊的內容 (以及原始內容) 連同當時的時間放進編輯紀錄中，
+// 新的原始內容需要另外用 SetSource 設定
+func (o *Object) Edit(content string) {
+	at := o.GetUpdated()
+	if at == "" {
+		at = o.GetPublished()
+	}
+	entry := map[string]string{
+		"content": o.GetContent(),
+		"updated": at,
+	}
+	if source, mediaType := o.GetSource(); mediaType != "" {
+		entry["source"] = source
+		entry["mediaType"] = mediaType
+	}
+	history := o.GetEditHistory()
+	history = append(history, entry)
+	(*o)["editHistory"] = history
+	(*o)["content"] = content
+	(*o)["updated"] = time.Now().Format(time.RFC3339)
+}
+
+// GetEditHistory 會回傳之前的版本，由舊到新排列，每個版本有 content 和 updated 兩個欄位，
+// 有原始內容的話還會有 source 和 mediaType
+func (o *Object) GetEditHistory() []map[string]string {
+	return toStringMapList((*o)["editHistory"])
+}
+
+// GetReplies 會回傳回覆這個 object 的 object ID，依照收到的順序排列
+func (o *Object) GetReplies() []string {
+	return toStringList((*o)["replies"])
+}
+
+// AddReply 會記錄 replyID 是這個 object 的回覆
+func (o *Object) AddReply(replyID string) {
+	list := o.GetReplies()
+	for _, id := range list {
+		if id == replyID {
+			return
+		}
+	}
+	(*o)["replies"] = append(list, replyID)
+}
+
+// RemoveReply 會移除 replyID 這個回覆 (例如回覆被刪除了)
+func (o *Object) RemoveReply(replyID string) {
+	list := []string{}
+	for _, id := range o.GetReplies() {
+		if id != replyID {
+			list = append(list, id)
+		}
+	}
+	(*o)["replies"] = list
+}
@@ -0,0 +1,137 @@
+package object
+
+// 這邊記錄的是其他人對 object 的反應，包括按讚 (Like) 和轉推 (Announce)。
+// 除了做出反應的 actor 清單之外，也會記錄 activity ID 對應到的 actor，
+// 之後收到只有 ID 的 Undo 時會用來找出是誰取消。
+
+// GetLikes 會回傳對這個 object 按讚的 actor ID，依照按讚的順序排列
+func (o *Object) GetLikes() []string {
+	return toStringList((*o)["likes"])
+}
+
+// AddLike 會記錄 actorID 對這個 object 按讚，likeActivityID 是 Like activity 的 ID
+func (o *Object) AddLike(actorID string, likeActivityID string) {
+	o.addReaction("likes", "likeActivities", actorID, likeActivityID)
+}
+
+// RemoveLike 會移除 actorID 對這個 object 的按讚
+func (o *Object) RemoveLike(actorID string) {
+	o.removeReaction("likes", "likeActivities", actorID)
+}
+
+// FindLikeByActivityID 會回傳送出 likeActivityID 這個 Like 的 actor ID
+func (o *Object) FindLikeByActivityID(likeActivityID string) (string, bool) {
+	actorID, ok := toStringMap((*o)["likeActivities"])[likeActivityID]
+	return actorID, ok
+}
+
+// GetShares 會回傳轉推這個 object 的 actor ID，依照轉推的順序排列
+func (o *Object) GetShares() []string {
+	return toStringList((*o)["shares"])
+}
+
+// AddShare 會記錄 actorID 轉推了這個 object，announceActivityID 是 Announce activity 的 ID
+func (o *Object) AddShare(actorID string, announceActivityID string) {
+	o.addReaction("shares", "shareActivities", actorID, announceActivityID)
+}
+
+// RemoveShare 會移除 actorID 對這個 object 的轉推
+func (o *Object) RemoveShare(actorID string) {
+	o.removeReaction("shares", "shareActivities", actorID)
+}
+
+// FindShareByActivityID 會回傳送出 announceActivityID 這個 Announce 的 actor ID
+func (o *Object) FindShareByActivityID(announceActivityID string) (string, bool) {
+	actorID, ok := toStringMap((*o)["shareActivities"])[announceActivityID]
+	return actorID, ok
+}
+
+func (o *Object) addReaction(listKey, activityKey, actorID, activityID string) {
+	list := toStringList((*o)[listKey])
+	exist := false
+	for _, id := range list {
+		if id == actorID {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		(*o)[listKey] = append(list, actorID)
+	}
+
+	if activityID != "" {
+		m := toStringMap((*o)[activityKey])
+		m[activityID] = actorID
+		(*o)[activityKey] = m
+	}
+}
+
+func (o *Object) removeReaction(listKey, activityKey, actorID string) {
+	list := []string{}
+	for _, id := range toStringList((*o)[listKey]) {
+		if id != actorID {
+			list = append(list, id)
+		}
+	}
+	(*o)[listKey] = list
+
+	m := toStringMap((*o)[activityKey])
+	for k, v := range m {
+		if v == actorID {
+			delete(m, k)
+		}
+	}
+	(*o)[activityKey] = m
+}
+
+// toStringList 會把 []string 或是從 JSON 讀進來的 []interface{} 轉換成 []string
+func toStringList(v interface{}) []string {
+	switch l := v.(type) {
+	case []string:
+		return l
+	case []interface{}:
+		list := make([]string, 0, len(l))
+		for _, i := range l {
+			if s, ok := i.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return []string{}
+}
+
+// toStringMap 會把 map[string]string 或是從 JSON 讀進來的 map[string]interface{}
+// 轉換成 map[string]string
+func toStringMap(v interface{}) map[string]string {
+	switch m := v.(type) {
+	case map[string]string:
+		return m
+	case map[string]interface{}:
+		r := map[string]string{}
+		for k, val := range m {
+			r[k], _ = val.(string)
+		}
+		return r
+	}
+	return map[string]string{}
+}
+
+// toStringMapList 會把 []map[string]string 或是從 JSON 讀進來的 []interface{}
+// 轉換成 []map[string]string
+func toStringMapList(v interface{}) []map[string]string {
+	switch l := v.(type) {
+	case []map[string]string:
+		return l
+	case []interface{}:
+		list := []map[string]string{}
+		for _, i := range l {
+			if _, ok := i.(map[string]interface{}); !ok {
+				continue
+			}
+			list = append(list, toStringMap(i))
+		}
+		return list
+	}
+	return []map[string]string{}
+}
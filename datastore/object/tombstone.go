@@ -0,0 +1,47 @@
+package object
+
+import (
+	"time"
+)
+
+// https://www.w3.org/TR/activitystreams-vocabulary/#dfn-tombstone
+// 刪除的 object 會被換成 Tombstone，保留 id 讓其他人知道這個 object 曾經存在但已經被刪除了。
+
+// Tombstone 會把 object 換成 Tombstone，只保留 id、作者和發布時間，
+// 原本的 type 會記錄在 formerType 中。
+func (o *Object) Tombstone() {
+	formerType := o.GetType()
+	kept := map[string]interface{}{}
+	for _, k := range []string{"id", "attributedTo", "published"} {
+		if v, ok := (*o)[k]; ok {
+			kept[k] = v
+		}
+	}
+
+	for k := range *o {
+		delete(*o, k)
+	}
+	for k, v := range kept {
+		(*o)[k] = v
+	}
+	(*o)["type"] = "Tombstone"
+	(*o)["formerType"] = formerType
+	(*o)["deleted"] = time.Now().Format(time.RFC3339)
+}
+
+// IsTombstone 會回傳 object 是否已經被刪除
+func (o *Object) IsTombstone() bool {
+	return o.GetType() == "Tombstone"
+}
+
+// GetFormerType 會回傳 Tombstone 原本的 type
+func (o *Object) GetFormerType() string {
+	s, _ := (*o)["formerType"].(string)
+	return s
+}
+
+// GetDeleted 會回傳 Tombstone 被刪除的時間
+func (o *Object) GetDeleted() string {
+	s, _ := (*o)["deleted"].(string)
+	return s
+}
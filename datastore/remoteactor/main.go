@@ -0,0 +1,243 @@
+package remoteactor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// remoteactor 存放的是從其他伺服器取得的 actor 資料的快取，
+// 像是驗證簽章需要的 publicKey 或是送出 activity 需要的 inbox，
+// 不需要每次都重新向對方伺服器取得。
+// 這邊只保留我們會用到的欄位，並且記錄取得的時間以及過期的時間。
+
+type RemoteActor map[string]interface{}
+
+// 以 actor 的 ID 為 key 存放
+var datastore = &sync.Map{}
+
+// 快取可能會在背景更新，所以寫檔時需要鎖起來
+var saveLock = sync.Mutex{}
+
+// 從 actor 文件中保留下來的欄位
+var keptFields = []string{
+	"id",
+	"type",
+	"inbox",
+	"outbox",
+	"followers",
+	"following",
+	"endpoints",
+	"publicKey",
+	"preferredUsername",
+	"name",
+	"icon",
+	"url",
+}
+
+func LoadRemoteActor(filepath string) error {
+	slog.Debug("remoteactor.Load", "info", "load remote actors")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmpMap := map[string]interface{}{}
+	tmpDatastore := sync.Map{}
+
+	err = json.Unmarshal(f, &tmpMap)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range tmpMap {
+		m := v.(map[string]interface{})
+		a := RemoteActor(m)
+		tmpDatastore.Store(k, &a)
+	}
+
+	// old datastore should be garbage collected
+	datastore = &tmpDatastore
+	slog.Info("remoteactor.Load", "info", "remote actors loaded")
+	return nil
+}
+
+func SaveRemoteActor(filepath string) error {
+	slog.Debug("remoteactor.Save", "info", "save remote actors", "filepath", filepath)
+	saveLock.Lock()
+	defer saveLock.Unlock()
+
+	tmpMap := map[string]interface{}{}
+	datastore.Range(func(k, v interface{}) bool {
+		tmpMap[k.(string)] = v
+		return true
+	})
+
+	f, err := json.MarshalIndent(tmpMap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("remoteactor.Save", "info", "remote actors saved")
+	return nil
+}
+
+// NewRemoteActor 會從取得的 actor 文件中只保留需要的欄位，並記錄在 ttl 之後過期，
+// revalidate 為 true 時代表每次使用前都需要重新向對方確認 (Cache-Control: no-cache)。
+// 這邊不會存進快取，需要的話請使用 StoreRemoteActor。
+func NewRemoteActor(doc map[string]interface{}, ttl time.Duration, revalidate bool) (*RemoteActor, error) {
+	id, ok := doc["id"].(string)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("actor id not found")
+	}
+
+	now := time.Now().UTC()
+	a := RemoteActor{}
+	for _, field := range keptFields {
+		if v, ok := doc[field]; ok {
+			a[field] = v
+		}
+	}
+	a["fetchedAt"] = now.Format(time.RFC3339)
+	a["expiresAt"] = now.Add(ttl).Format(time.RFC3339)
+	if revalidate {
+		a["revalidate"] = true
+	}
+	return &a, nil
+}
+
+// StoreRemoteActor 會把取得的 actor 文件存進快取，並在 ttl 之後過期。
+// 快取中的資料不會被修改，更新時會整個替換掉，所以可以安全的在不同 goroutine 中讀取。
+func StoreRemoteActor(doc map[string]interface{}, ttl time.Duration, revalidate bool) (*RemoteActor, error) {
+	a, err := NewRemoteActor(doc, ttl, revalidate)
+	if err != nil {
+		return nil, err
+	}
+	datastore.Store(a.GetID(), a)
+	return a, nil
+}
+
+func FindRemoteActorByID(id string) (*RemoteActor, error) {
+	if v, ok := datastore.Load(id); ok {
+		return v.(*RemoteActor), nil
+	}
+	return nil, fmt.Errorf("remote actor not found")
+}
+
+// RemoveRemoteActor 會把 actor 從快取中移除，下次需要時就會重新取得，
+// 通常是收到該 actor 的 Update 或是 Delete 時呼叫。
+func RemoveRemoteActor(id string) {
+	datastore.Delete(id)
+}
+
+func (a *RemoteActor) GetID() string {
+	s, _ := (*a)["id"].(string)
+	return s
+}
+
+func (a *RemoteActor) GetType() string {
+	s, _ := (*a)["type"].(string)
+	return s
+}
+
+func (a *RemoteActor) GetInbox() string {
+	s, _ := (*a)["inbox"].(string)
+	return s
+}
+
+func (a *RemoteActor) GetSharedInbox() string {
+	endpoints, ok := (*a)["endpoints"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	s, _ := endpoints["sharedInbox"].(string)
+	return s
+}
+
+func (a *RemoteActor) GetFollowers() string {
+	s, _ := (*a)["followers"].(string)
+	return s
+}
+
+func (a *RemoteActor) GetPreferredUsername() string {
+	s, _ := (*a)["preferredUsername"].(string)
+	return s
+}
+
+func (a *RemoteActor) GetName() string {
+	s, _ := (*a)["name"].(string)
+	return s
+}
+
+// GetIcon 會回傳頭像的網址，icon 可能是字串、Image 物件或是陣列
+func (a *RemoteActor) GetIcon() string {
+	switch v := (*a)["icon"].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		s, _ := v["url"].(string)
+		return s
+	case []interface{}:
+		for _, i := range v {
+			if m, ok := i.(map[string]interface{}); ok {
+				if s, ok := m["url"].(string); ok {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// GetPublicKeys 會回傳 actor 所有的 publicKey，publicKey 可能是單一物件也可能是陣列
+func (a *RemoteActor) GetPublicKeys() []map[string]interface{} {
+	keys := []map[string]interface{}{}
+	switch p := (*a)["publicKey"].(type) {
+	case map[string]interface{}:
+		keys = append(keys, p)
+	case []interface{}:
+		for _, v := range p {
+			if k, ok := v.(map[string]interface{}); ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+func (a *RemoteActor) GetFetchedAt() time.Time {
+	return parseTime((*a)["fetchedAt"])
+}
+
+func (a *RemoteActor) GetExpiresAt() time.Time {
+	return parseTime((*a)["expiresAt"])
+}
+
+// MustRevalidate 會回傳使用快取之前是否需要先重新向對方確認
+func (a *RemoteActor) MustRevalidate() bool {
+	b, _ := (*a)["revalidate"].(bool)
+	return b
+}
+
+// IsExpired 會回傳快取在 now 的時間點是否已經過期
+func (a *RemoteActor) IsExpired(now time.Time) bool {
+	return now.After(a.GetExpiresAt())
+}
+
+func parseTime(v interface{}) time.Time {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
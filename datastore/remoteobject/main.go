@@ -0,0 +1,154 @@
+package remoteobject
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// remoteobject 存放的是本站使用者收到的、其他伺服器上的 object (例如 Note)，
+// 這樣 timeline 不需要每次都向對方伺服器取得，
+// 收到 Update 時也可以直接更新成最新的版本。
+
+type RemoteObject map[string]interface{}
+
+// 以 object 的 ID 為 key 存放
+var datastore = &sync.Map{}
+
+// inbox 可能同時收到多個請求，所以寫檔時需要鎖起來
+var saveLock = sync.Mutex{}
+
+func LoadRemoteObject(filepath string) error {
+	slog.Debug("remoteobject.Load", "info", "load remote objects")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmpMap := map[string]interface{}{}
+	tmpDatastore := sync.Map{}
+
+	err = json.Unmarshal(f, &tmpMap)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range tmpMap {
+		m := v.(map[string]interface{})
+		o := RemoteObject(m)
+		tmpDatastore.Store(k, &o)
+	}
+
+	// old datastore should be garbage collected
+	datastore = &tmpDatastore
+	slog.Info("remoteobject.Load", "info", "remote objects loaded")
+	return nil
+}
+
+func SaveRemoteObject(filepath string) error {
+	slog.Debug("remoteobject.Save", "info", "save remote objects", "filepath", filepath)
+	saveLock.Lock()
+	defer saveLock.Unlock()
+
+	tmpMap := map[string]interface{}{}
+	datastore.Range(func(k, v interface{}) bool {
+		tmpMap[k.(string)] = v
+		return true
+	})
+
+	f, err := json.MarshalIndent(tmpMap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("remoteobject.Save", "info", "remote objects saved")
+	return nil
+}
+
+// StoreRemoteObject 會把 object 存起來，已經存在的話會整個替換掉，
+// 所以存起來的資料不會被修改，可以安全的在不同 goroutine 中讀取。
+func StoreRemoteObject(doc map[string]interface{}) (*RemoteObject, error) {
+	id, ok := doc["id"].(string)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("object id not found")
+	}
+
+	o := RemoteObject{}
+	for k, v := range doc {
+		if k == "@context" {
+			continue
+		}
+		o[k] = v
+	}
+	o["fetchedAt"] = time.Now().UTC().Format(time.RFC3339)
+
+	datastore.Store(id, &o)
+	return &o, nil
+}
+
+func FindRemoteObjectByID(id string) (*RemoteObject, error) {
+	if v, ok := datastore.Load(id); ok {
+		return v.(*RemoteObject), nil
+	}
+	return nil, fmt.Errorf("remote object not found")
+}
+
+func RemoveRemoteObject(id string) {
+	datastore.Delete(id)
+}
+
+// RangeRemoteObjects 會依序把每個 object 傳給 f，f 回傳 false 時停止
+func RangeRemoteObjects(f func(o *RemoteObject) bool) {
+	datastore.Range(func(k, v interface{}) bool {
+		return f(v.(*RemoteObject))
+	})
+}
+
+func (o *RemoteObject) GetID() string {
+	s, _ := (*o)["id"].(string)
+	return s
+}
+
+func (o *RemoteObject) GetType() string {
+	s, _ := (*o)["type"].(string)
+	return s
+}
+
+// GetAttributedTo 會回傳作者的 actor ID，attributedTo 是物件的話取出其中的 id
+func (o *RemoteObject) GetAttributedTo() string {
+	switch v := (*o)["attributedTo"].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		s, _ := v["id"].(string)
+		return s
+	}
+	return ""
+}
+
+// ToMap 會回傳 object 的複本，呼叫的人可以任意修改
+func (o *RemoteObject) ToMap() map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range *o {
+		if k == "fetchedAt" {
+			continue
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// GetInReplyTo 會回傳這個 object 所回覆的 object ID，不是回覆的話回傳空字串
+func (o *RemoteObject) GetInReplyTo() string {
+	s, _ := (*o)["inReplyTo"].(string)
+	return s
+}
@@ -0,0 +1,98 @@
+package reply
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// reply 存放的是回覆的索引，記錄每個 object 有哪些回覆 (包含本站和其他站的)，
+// 以被回覆的 object ID 為 key，value 是依照收到的順序排列的回覆 object ID。
+// 討論串往下展開時就不需要掃過所有的 object。
+
+var datastore = map[string][]string{}
+
+// 索引會在 inbox 和 API 中同時被修改，所以讀寫都需要鎖起來
+var lock = sync.Mutex{}
+
+func LoadReply(filepath string) error {
+	slog.Debug("reply.Load", "info", "load replies")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmp := map[string][]string{}
+	err = json.Unmarshal(f, &tmp)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	datastore = tmp
+	lock.Unlock()
+	slog.Info("reply.Load", "info", "replies loaded")
+	return nil
+}
+
+func SaveReply(filepath string) error {
+	slog.Debug("reply.Save", "info", "save replies", "filepath", filepath)
+	lock.Lock()
+	f, err := json.MarshalIndent(datastore, "", "  ")
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("reply.Save", "info", "replies saved")
+	return nil
+}
+
+// AddReply 會把 replyID 記錄為 parentID 的回覆
+func AddReply(parentID string, replyID string) {
+	if parentID == "" || replyID == "" {
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, id := range datastore[parentID] {
+		if id == replyID {
+			return
+		}
+	}
+	datastore[parentID] = append(datastore[parentID], replyID)
+}
+
+// RemoveReply 會把 replyID 從 parentID 的回覆中移除
+func RemoveReply(parentID string, replyID string) {
+	lock.Lock()
+	defer lock.Unlock()
+	list := []string{}
+	for _, id := range datastore[parentID] {
+		if id != replyID {
+			list = append(list, id)
+		}
+	}
+	if len(list) == 0 {
+		delete(datastore, parentID)
+		return
+	}
+	datastore[parentID] = list
+}
+
+// GetReplyIDs 會回傳 parentID 的回覆，依照收到的順序排列
+func GetReplyIDs(parentID string) []string {
+	lock.Lock()
+	defer lock.Unlock()
+	list := make([]string, len(datastore[parentID]))
+	copy(list, datastore[parentID])
+	return list
+}
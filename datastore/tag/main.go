@@ -0,0 +1,148 @@
+package tag
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// tag 存放的是 hashtag 的索引，記錄每個 hashtag 有哪些 object (包含本站和其他站的)，
+// 以 hashtag 的名稱 (小寫、不含 #) 為 key，value 是依照收到的順序排列的 Entry。
+// 每個 Entry 都有一個只會遞增的序號，分頁時用來當作游標。
+
+type Entry struct {
+	ID  string `json:"id"`
+	Seq int64  `json:"seq"`
+}
+
+var datastore = map[string][]Entry{}
+
+// 下一個加入索引的 object 使用的序號
+var nextSeq int64 = 1
+
+// 索引會在 inbox 和 API 中同時被修改，所以讀寫都需要鎖起來
+var lock = sync.Mutex{}
+
+// tagFile 是 tag.json 的格式
+type tagFile struct {
+	Tags    map[string][]Entry `json:"tags"`
+	NextSeq int64              `json:"nextSeq"`
+}
+
+func LoadTag(filepath string) error {
+	slog.Debug("tag.Load", "info", "load tags")
+
+	f, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	tmp := tagFile{}
+	err = json.Unmarshal(f, &tmp)
+	if err != nil || tmp.Tags == nil {
+		// 舊的格式只有 object ID 的清單，依照目前的順序補上序號
+		legacy := map[string][]string{}
+		if err := json.Unmarshal(f, &legacy); err != nil {
+			return err
+		}
+		tmp = tagFile{Tags: map[string][]Entry{}, NextSeq: 1}
+		for name, ids := range legacy {
+			for _, id := range ids {
+				tmp.Tags[name] = append(tmp.Tags[name], Entry{ID: id, Seq: tmp.NextSeq})
+				tmp.NextSeq++
+			}
+		}
+	}
+
+	lock.Lock()
+	datastore = tmp.Tags
+	nextSeq = max(tmp.NextSeq, 1)
+	lock.Unlock()
+	slog.Info("tag.Load", "info", "tags loaded")
+	return nil
+}
+
+func SaveTag(filepath string) error {
+	slog.Debug("tag.Save", "info", "save tags", "filepath", filepath)
+	lock.Lock()
+	f, err := json.MarshalIndent(tagFile{Tags: datastore, NextSeq: nextSeq}, "", "  ")
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath, f, 0644)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("tag.Save", "info", "tags saved")
+	return nil
+}
+
+// NormalizeName 會把 hashtag 轉成索引使用的名稱，也就是去掉 # 並轉成小寫
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "#"))
+}
+
+// AddObject 會把 objectID 加進 name 這個 hashtag 的索引
+func AddObject(name string, objectID string) {
+	name = NormalizeName(name)
+	if name == "" {
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, e := range datastore[name] {
+		if e.ID == objectID {
+			return
+		}
+	}
+	datastore[name] = append(datastore[name], Entry{ID: objectID, Seq: nextSeq})
+	nextSeq++
+}
+
+// RemoveObject 會把 objectID 從所有 hashtag 的索引中移除
+func RemoveObject(objectID string) {
+	lock.Lock()
+	defer lock.Unlock()
+	for name, entries := range datastore {
+		list := []Entry{}
+		for _, e := range entries {
+			if e.ID != objectID {
+				list = append(list, e)
+			}
+		}
+		if len(list) == 0 {
+			delete(datastore, name)
+			continue
+		}
+		datastore[name] = list
+	}
+}
+
+// GetObjectIDs 會回傳 name 這個 hashtag 的 object ID，依照收到的順序排列
+func GetObjectIDs(name string) []string {
+	lock.Lock()
+	defer lock.Unlock()
+	entries := datastore[NormalizeName(name)]
+	list := make([]string, len(entries))
+	for i, e := range entries {
+		list[i] = e.ID
+	}
+	return list
+}
+
+// GetObjectSeqs 會回傳 name 這個 hashtag 中每個 object 加入索引時的序號
+func GetObjectSeqs(name string) map[string]int64 {
+	lock.Lock()
+	defer lock.Unlock()
+	seqs := map[string]int64{}
+	for _, e := range datastore[NormalizeName(name)] {
+		seqs[e.ID] = e.Seq
+	}
+	return seqs
+}
@@ -4,8 +4,12 @@ package fetcher
 // 之所以不讓前端直接取得是因為 CORS 的問題。
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
+
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/mediaproxy"
 )
 
 func Route(w http.ResponseWriter, r *http.Request) {
@@ -37,11 +41,25 @@ func Get(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Write(data)
+
+	// 對方回傳的內容會直接交給前端顯示，所以和存進來的 object 一樣要先清理 HTML，
+	// 不是 JSON 物件的話 (例如 HTML 頁面) 就不回傳，避免原樣交給前端。
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	activitypub.SanitizeObject(m)
+
+	// actor 的頭像和橫幅 (icon 和 image) 之類的檔案要換成 media proxy 的網址，
+	// 這樣前端顯示時才不會直接連到其他伺服器。
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mediaproxy.RewriteObject(m))
 }
@@ -6,6 +6,7 @@ require (
 	github.com/go-fed/httpsig v1.1.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/image v0.24.0
 )
 
 require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
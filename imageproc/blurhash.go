@@ -0,0 +1,110 @@
+package imageproc
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// blurhash 是把圖片壓縮成 20 到 30 個字元的模糊預覽，在圖片還沒有載入完成時顯示，
+// Mastodon 會放在 attachment 的 blurhash 欄位。
+// 相關文件請參閱: https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+
+const base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash 會計算 img 的 blurhash，componentsX 和 componentsY 必須在 1 到 9 之間，
+// 計算量和像素數量成正比，所以 img 最好先縮小。
+func Blurhash(img *image.RGBA, componentsX, componentsY int) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// 先把每個像素轉成線性的 RGB
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			linear[y*w+x] = [3]float64{
+				sRGBToLinear(img.Pix[i]),
+				sRGBToLinear(img.Pix[i+1]),
+				sRGBToLinear(img.Pix[i+2]),
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					p := linear[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := normalisation / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(encodeBase83((componentsX-1)+(componentsY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		b.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		b.WriteString(encodeBase83(0, 1))
+	}
+
+	b.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, f := range ac {
+		b.WriteString(encodeBase83(quantiseAC(f[0], maximumValue)*19*19+quantiseAC(f[1], maximumValue)*19+quantiseAC(f[2], maximumValue), 2))
+	}
+	return b.String()
+}
+
+func quantiseAC(v float64, maximumValue float64) int {
+	return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+}
+
+func signPow(v float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func encodeBase83(value int, length int) string {
+	var b strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		b.WriteByte(base83Characters[digit])
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package imageproc
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestEncodeBase83(t *testing.T) {
+	type TestCase struct {
+		value    int
+		length   int
+		expected string
+	}
+
+	testCases := []TestCase{
+		{value: 0, length: 1, expected: "0"},
+		{value: 82, length: 1, expected: "~"},
+		{value: 83, length: 2, expected: "10"},
+		{value: 3429, length: 2, expected: "fQ"},
+		{value: 0xFFFFFF, length: 4, expected: "TSUA"},
+	}
+
+	for _, tc := range testCases {
+		actual := encodeBase83(tc.value, tc.length)
+		if actual != tc.expected {
+			t.Errorf("encodeBase83(%d, %d) = %q, expected %q", tc.value, tc.length, actual, tc.expected)
+		}
+	}
+}
+
+func TestBlurhash(t *testing.T) {
+	type TestCase struct {
+		name     string
+		color    color.RGBA
+		expected string
+	}
+
+	// 和參考實作相同，basis 是在像素的左上角取樣的，所以單色的圖片在奇數的 component 也會有一點 AC，
+	// 黑色的話線性的值是 0，每一個 AC 都會是 quantise 之後的中間值 (9, 9, 9) 也就是 "fQ"
+	testCases := []TestCase{
+		{name: "white", color: color.RGBA{255, 255, 255, 255}, expected: "LsTSUA_3fQ_3~qt7fQt7fQfQfQfQ"},
+		{name: "red", color: color.RGBA{255, 0, 0, 255}, expected: "LsTI:j]9fQ]9|csUfQsUfQfQfQfQ"},
+		{name: "black", color: color.RGBA{0, 0, 0, 255}, expected: "L00000" + strings.Repeat("fQ", blurhashComponentsX*blurhashComponentsY-1)},
+	}
+
+	for _, tc := range testCases {
+		img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+		draw.Draw(img, img.Bounds(), &image.Uniform{tc.color}, image.Point{}, draw.Src)
+		actual := Blurhash(img, blurhashComponentsX, blurhashComponentsY)
+		if actual != tc.expected {
+			t.Errorf("%s: Blurhash() = %q, expected %q", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+func TestBlurhashMirror(t *testing.T) {
+	// 左黑右白和左白右黑的圖片，DC 相同但是水平方向的 AC 相反
+	left := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	right := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if x < 4 {
+				left.Set(x, y, color.White)
+				right.Set(x, y, color.Black)
+			} else {
+				left.Set(x, y, color.Black)
+				right.Set(x, y, color.White)
+			}
+		}
+	}
+
+	a := Blurhash(left, blurhashComponentsX, blurhashComponentsY)
+	b := Blurhash(right, blurhashComponentsX, blurhashComponentsY)
+	if len(a) != 28 || len(b) != 28 {
+		t.Fatalf("Blurhash() length = %d, %d, expected 28", len(a), len(b))
+	}
+	if a[:6] != b[:6] {
+		t.Errorf("Blurhash() size, maximum and DC differ: %q, %q", a[:6], b[:6])
+	}
+	if a[6:8] == b[6:8] {
+		t.Errorf("Blurhash() first AC component is the same: %q, %q", a, b)
+	}
+}
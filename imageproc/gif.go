@@ -0,0 +1,89 @@
+package imageproc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// gif.DecodeAll 會一次把所有畫格解碼到記憶體中，只檢查第一個畫格的大小的話，
+// 很小的檔案也可以塞進大量的畫格，所以解碼前要先掃過檔案，計算所有畫格加起來的像素數量。
+// 相關文件請參閱: https://www.w3.org/Graphics/GIF/spec-gif89a.txt
+
+// gifFramePixels 會回傳 GIF 中所有畫格的像素數量總和，不會解碼影像資料，
+// 超過 limit 的話就不再繼續計算並回傳錯誤。
+func gifFramePixels(data []byte, limit int) (int, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return 0, errors.New("invalid gif")
+	}
+
+	i := 13
+	// Global Color Table
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	if i >= len(data) {
+		return 0, errors.New("invalid gif color table")
+	}
+
+	total := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // Extension
+			if i+2 > len(data) {
+				return 0, errors.New("invalid gif extension")
+			}
+			next, err := skipGIFSubBlocks(data, i+2)
+			if err != nil {
+				return 0, err
+			}
+			i = next
+
+		case 0x2C: // Image Descriptor
+			if i+10 > len(data) {
+				return 0, errors.New("invalid gif image descriptor")
+			}
+			w := int(binary.LittleEndian.Uint16(data[i+5:]))
+			h := int(binary.LittleEndian.Uint16(data[i+7:]))
+			total += w * h
+			if total > limit {
+				return total, errors.New("gif too large")
+			}
+
+			flags := data[i+9]
+			i += 10
+			// Local Color Table
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			// LZW Minimum Code Size 之後是影像資料的 sub-block
+			next, err := skipGIFSubBlocks(data, i+1)
+			if err != nil {
+				return 0, err
+			}
+			i = next
+
+		case 0x3B: // Trailer
+			return total, nil
+
+		default:
+			return 0, errors.New("invalid gif block")
+		}
+	}
+	// 沒有 Trailer 的檔案 gif.DecodeAll 也能讀，這邊一樣接受
+	return total, nil
+}
+
+// skipGIFSubBlocks 會略過從 i 開始的 sub-block，回傳結尾 (長度為 0 的 block) 之後的位置
+func skipGIFSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errors.New("invalid gif sub-block")
+		}
+		n := int(data[i])
+		i++
+		if n == 0 {
+			return i, nil
+		}
+		i += n
+	}
+}
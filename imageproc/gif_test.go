@@ -0,0 +1,71 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// testGIF 會產生 frames 個畫格、每個畫格 w x h 的 GIF，使用 Local Color Table
+func testGIF(t *testing.T, frames, w, h int) []byte {
+	g := &gif.GIF{Config: image.Config{Width: w, Height: h, ColorModel: color.Palette(palette.Plan9)}}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFFramePixels(t *testing.T) {
+	type TestCase struct {
+		name     string
+		data     []byte
+		limit    int
+		expected int
+		err      bool
+	}
+
+	testCases := []TestCase{
+		{name: "single frame", data: testGIF(t, 1, 10, 20), limit: maxPixels, expected: 200},
+		{name: "animated", data: testGIF(t, 5, 10, 20), limit: maxPixels, expected: 1000},
+		{name: "over limit", data: testGIF(t, 5, 10, 20), limit: 999, err: true},
+		{name: "truncated", data: testGIF(t, 2, 10, 20)[:30], limit: maxPixels, err: true},
+		{name: "not gif", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00\x00"), limit: maxPixels, err: true},
+	}
+
+	for _, tc := range testCases {
+		actual, err := gifFramePixels(tc.data, tc.limit)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: gifFramePixels() error = %v, expected error %v", tc.name, err, tc.err)
+			continue
+		}
+		if !tc.err && actual != tc.expected {
+			t.Errorf("%s: gifFramePixels() = %d, expected %d", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+func TestProcessGIFMaxDimension(t *testing.T) {
+	data := testGIF(t, 2, 40, 20)
+
+	_, err := Process(data, "image/gif", 30)
+	if err == nil {
+		t.Errorf("Process() of a gif larger than maxDimension should fail")
+	}
+
+	result, err := Process(data, "image/gif", 40)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.Width != 40 || result.Height != 20 {
+		t.Errorf("Process() size = %dx%d, expected 40x20", result.Width, result.Height)
+	}
+}
@@ -0,0 +1,214 @@
+package imageproc
+
+// imageproc 負責處理使用者上傳的圖片，全部使用 Go 實作 (標準函式庫以及 golang.org/x/image)，
+// 不需要 libvips 之類的外部程式。
+//
+// 圖片會重新解碼再編碼，這樣 EXIF (例如手機照片中的 GPS 位置) 之類的 metadata 就不會被保留下來，
+// 太大的圖片會縮小到 maxDimension 以內，另外也會產生縮圖以及 blurhash。
+// 沒有 WebP 的編碼器，所以 WebP 會轉成 PNG (有透明的話) 或是 JPEG。
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	// 註冊 WebP 的解碼器，image.Decode 和 image.DecodeConfig 才能讀取 WebP
+	_ "golang.org/x/image/webp"
+)
+
+// 解碼前會先檢查像素數量，避免很小的檔案解碼出非常大的圖片 (decompression bomb)
+const maxPixels = 50_000_000
+
+// 縮圖的長邊
+const ThumbnailDimension = 400
+
+// 計算 blurhash 時使用的圖片大小以及 component 的數量
+const (
+	blurhashDimension   = 32
+	blurhashComponentsX = 4
+	blurhashComponentsY = 3
+)
+
+// Result 是處理完的圖片，Data 和 Thumbnail 都是已經編碼好的檔案內容
+type Result struct {
+	Data      []byte
+	MediaType string
+	Width     int
+	Height    int
+
+	Thumbnail          []byte
+	ThumbnailMediaType string
+
+	Blurhash string
+}
+
+// IsSupported 會回傳 Process 是否能處理 mediaType 的圖片
+func IsSupported(mediaType string) bool {
+	return mediaType == "image/jpeg" || mediaType == "image/png" || mediaType == "image/gif" || mediaType == "image/webp"
+}
+
+// Process 會處理 mediaType 的圖片 data，長邊超過 maxDimension 的話會等比例縮小。
+// JPEG 會依照 EXIF 的 Orientation 轉正之後再移除 EXIF，
+// GIF 為了保留動畫只會重新編碼而不會縮小，超過 maxDimension 的話回傳錯誤，縮圖和 blurhash 使用第一個畫格。
+// WebP 會轉成其他格式，所以 Result 的 MediaType 不一定和傳入的 mediaType 相同，動畫的 WebP 則會回傳錯誤。
+func Process(data []byte, mediaType string, maxDimension int) (*Result, error) {
+	if !IsSupported(mediaType) {
+		return nil, errors.New("unsupported image type: " + mediaType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, errors.New("image too large")
+	}
+
+	if mediaType == "image/webp" && IsAnimatedWebP(data) {
+		return nil, errors.New("animated webp not supported")
+	}
+
+	var img *image.RGBA
+	result := &Result{MediaType: mediaType}
+	if mediaType == "image/gif" {
+		// GIF 為了保留動畫不會縮小，所以太大的 GIF 直接拒絕
+		if maxDimension > 0 && (config.Width > maxDimension || config.Height > maxDimension) {
+			return nil, errors.New("gif too large")
+		}
+		if _, err := gifFramePixels(data, maxPixels); err != nil {
+			return nil, err
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		// 重新編碼時只會留下畫格和必要的資訊，註解之類的 extension 都會被拿掉
+		var buf bytes.Buffer
+		err = gif.EncodeAll(&buf, g)
+		if err != nil {
+			return nil, err
+		}
+		result.Data = buf.Bytes()
+		result.Width, result.Height = g.Config.Width, g.Config.Height
+		img = toRGBA(g.Image[0])
+	} else {
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		img = toRGBA(decoded)
+		if mediaType == "image/jpeg" {
+			img = applyOrientation(img, jpegOrientation(data))
+		}
+		img = fit(img, maxDimension)
+		if mediaType == "image/webp" {
+			result.MediaType = "image/jpeg"
+			if hasAlpha(img) {
+				result.MediaType = "image/png"
+			}
+		}
+		result.Data, err = encode(img, result.MediaType)
+		if err != nil {
+			return nil, err
+		}
+		result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	// 縮圖有透明的可能的話使用 PNG，其他的使用 JPEG
+	result.ThumbnailMediaType = "image/jpeg"
+	if result.MediaType != "image/jpeg" {
+		result.ThumbnailMediaType = "image/png"
+	}
+	result.Thumbnail, err = encode(fit(img, ThumbnailDimension), result.ThumbnailMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Blurhash = Blurhash(fit(img, blurhashDimension), blurhashComponentsX, blurhashComponentsY)
+	return result, nil
+}
+
+// encode 會把 img 編碼成 mediaType 的格式
+func encode(img image.Image, mediaType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mediaType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		err = errors.New("unsupported image type: " + mediaType)
+	}
+	return buf.Bytes(), err
+}
+
+// hasAlpha 會回傳 img 是否有不透明度不是 100% 的像素
+func hasAlpha(img *image.RGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return true
+		}
+	}
+	return false
+}
+
+// toRGBA 會把 img 轉成從 (0, 0) 開始的 *image.RGBA
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// fit 會把長邊超過 maxDimension 的圖片等比例縮小，沒有超過的話直接回傳 img
+func fit(img *image.RGBA, maxDimension int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if maxDimension <= 0 || (w <= maxDimension && h <= maxDimension) {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*maxDimension/w)
+		w = maxDimension
+	} else {
+		w = max(1, w*maxDimension/h)
+		h = maxDimension
+	}
+	return resize(img, w, h)
+}
+
+// resize 會用 box filter 把 img 縮小成 w x h，每個新的像素是原圖對應區域的平均值
+func resize(img *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				i := img.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(img.Pix[i])
+					g += uint64(img.Pix[i+1])
+					b += uint64(img.Pix[i+2])
+					a += uint64(img.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
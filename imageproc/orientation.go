@@ -0,0 +1,116 @@
+package imageproc
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// 手機拍的照片通常不會真的把像素轉正，而是在 EXIF 的 Orientation 記錄應該怎麼顯示，
+// 移除 EXIF 之前要先依照它把圖片轉正，不然照片會變成橫的或是倒過來的。
+// 相關文件請參閱: https://www.cipa.jp/std/documents/e/DC-008-2012_E.pdf
+
+// jpegOrientation 會從 JPEG 的 APP1 (Exif) 中取出 Orientation，找不到的話回傳 1 (不需要轉)
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// SOS 之後就是影像資料了，EXIF 一定在這之前
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation 會從 EXIF 的 TIFF 結構中的第一個 IFD 找出 Orientation (0x0112)
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		// Orientation 是 SHORT，值直接放在 entry 的最後 4 個 byte 的前 2 個 byte
+		v := int(order.Uint16(tiff[entry+8:]))
+		if v < 1 || v > 8 {
+			return 1
+		}
+		return v
+	}
+	return 1
+}
+
+// applyOrientation 會依照 Orientation 把 img 轉正
+func applyOrientation(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	// 5 到 8 需要轉 90 度，寬高會互換
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻轉
+				sx, sy = w-1-x, y
+			case 3: // 旋轉 180 度
+				sx, sy = w-1-x, h-1-y
+			case 4: // 垂直翻轉
+				sx, sy = x, h-1-y
+			case 5: // 沿左上到右下的對角線翻轉
+				sx, sy = y, x
+			case 6: // 順時針旋轉 90 度
+				sx, sy = y, h-1-x
+			case 7: // 沿右上到左下的對角線翻轉
+				sx, sy = w-1-y, h-1-x
+			case 8: // 逆時針旋轉 90 度
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):img.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
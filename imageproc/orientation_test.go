@@ -0,0 +1,105 @@
+package imageproc
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// exifJPEG 會產生只有 SOI、包含 Orientation 的 APP1 以及 SOS 的 JPEG 開頭，order 是 TIFF 的位元組順序
+func exifJPEG(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	// tag, type (SHORT), count, value
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(data[4:], uint16(len(segment)+2))
+	data = append(data, segment...)
+	return append(data, 0xFF, 0xDA, 0, 2)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	type TestCase struct {
+		name     string
+		data     []byte
+		expected int
+	}
+
+	// 在 EXIF 之前多放一個 APP0 (JFIF)
+	withJFIF := append([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 4, 'J', 'F'}, exifJPEG(binary.BigEndian, 8)[2:]...)
+
+	testCases := []TestCase{
+		{name: "little endian", data: exifJPEG(binary.LittleEndian, 6), expected: 6},
+		{name: "big endian", data: exifJPEG(binary.BigEndian, 3), expected: 3},
+		{name: "after other segment", data: withJFIF, expected: 8},
+		{name: "invalid value", data: exifJPEG(binary.LittleEndian, 9), expected: 1},
+		{name: "no exif", data: []byte{0xFF, 0xD8, 0xFF, 0xDA, 0, 2}, expected: 1},
+		{name: "truncated", data: exifJPEG(binary.LittleEndian, 6)[:20], expected: 1},
+		{name: "not jpeg", data: []byte("\x89PNG\r\n\x1a\n"), expected: 1},
+		{name: "empty", data: nil, expected: 1},
+	}
+
+	for _, tc := range testCases {
+		actual := jpegOrientation(tc.data)
+		if actual != tc.expected {
+			t.Errorf("%s: jpegOrientation() = %d, expected %d", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	type TestCase struct {
+		orientation int
+		expected    [][]byte
+	}
+
+	// 原圖是 2x3，每個像素的 R 是它的編號:
+	// 1 2
+	// 3 4
+	// 5 6
+	src := image.NewRGBA(image.Rect(0, 0, 2, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 2; x++ {
+			src.Set(x, y, color.RGBA{R: uint8(y*2 + x + 1), A: 255})
+		}
+	}
+
+	testCases := []TestCase{
+		{orientation: 1, expected: [][]byte{{1, 2}, {3, 4}, {5, 6}}},
+		{orientation: 2, expected: [][]byte{{2, 1}, {4, 3}, {6, 5}}},
+		{orientation: 3, expected: [][]byte{{6, 5}, {4, 3}, {2, 1}}},
+		{orientation: 4, expected: [][]byte{{5, 6}, {3, 4}, {1, 2}}},
+		{orientation: 5, expected: [][]byte{{1, 3, 5}, {2, 4, 6}}},
+		{orientation: 6, expected: [][]byte{{5, 3, 1}, {6, 4, 2}}},
+		{orientation: 7, expected: [][]byte{{6, 4, 2}, {5, 3, 1}}},
+		{orientation: 8, expected: [][]byte{{2, 4, 6}, {1, 3, 5}}},
+	}
+
+	for _, tc := range testCases {
+		dst := applyOrientation(src, tc.orientation)
+		if dst.Bounds().Dy() != len(tc.expected) || dst.Bounds().Dx() != len(tc.expected[0]) {
+			t.Errorf("orientation %d: size = %v, expected %dx%d", tc.orientation, dst.Bounds().Size(), len(tc.expected[0]), len(tc.expected))
+			continue
+		}
+		for y, row := range tc.expected {
+			for x, v := range row {
+				if r := dst.RGBAAt(x, y).R; r != v {
+					t.Errorf("orientation %d: pixel (%d, %d) = %d, expected %d", tc.orientation, x, y, r, v)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// 靜態的 WebP 會由 Process 解碼 (golang.org/x/image/webp) 之後重新編碼成 PNG 或 JPEG，
+// 但是解碼器不支援動畫，也沒有 WebP 的編碼器，所以動畫的 WebP 不會重新編碼，
+// 而是直接從 RIFF 結構中拿掉 EXIF 和 XMP 的 chunk，其他的 chunk (影像、動畫、ICC) 原樣保留。
+// 相關文件請參閱: https://developers.google.com/speed/webp/docs/riff_container
+
+// VP8X chunk 第一個 byte 中表示有 EXIF、XMP 以及動畫的 flag
+const (
+	webpFlagEXIF      = 0x08
+	webpFlagXMP       = 0x04
+	webpFlagAnimation = 0x02
+)
+
+// IsAnimatedWebP 會回傳 data 是否為動畫的 WebP，動畫的 WebP 沒辦法交給 Process 處理
+func IsAnimatedWebP(data []byte) bool {
+	// 有動畫的話第一個 chunk 一定是 VP8X
+	if len(data) < 21 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" || string(data[12:16]) != "VP8X" {
+		return false
+	}
+	return data[20]&webpFlagAnimation != 0
+}
+
+// StripWebPMetadata 會回傳移除 EXIF 和 XMP 之後的 WebP，data 不是合法的 WebP 的話回傳錯誤
+func StripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid webp")
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size < 4 || size+8 > len(data) {
+		return nil, errors.New("invalid webp size")
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for i := 12; i < size+8; {
+		if i+8 > size+8 {
+			return nil, errors.New("invalid webp chunk")
+		}
+		fourCC := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		// chunk 的長度是奇數的話後面會補一個 byte
+		end := i + 8 + length + length%2
+		if length < 0 || end > size+8 {
+			return nil, errors.New("invalid webp chunk")
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[i:end])
+			if length > 0 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			body.Write(chunk)
+		default:
+			body.Write(data[i:end])
+		}
+		i = end
+	}
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(body.Len()))
+	return append(out, body.Bytes()...), nil
+}
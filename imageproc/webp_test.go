@@ -0,0 +1,239 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// riff 會把 chunks 包成 WebP 的 RIFF 檔案
+func riff(chunks ...[]byte) []byte {
+	body := append([]byte("WEBP"), bytes.Join(chunks, nil)...)
+	data := append([]byte("RIFF"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(body)))
+	return append(data, body...)
+}
+
+// chunk 會產生 fourCC 的 chunk，長度是奇數的話補上一個 byte
+func chunk(fourCC string, payload []byte) []byte {
+	c := append([]byte(fourCC), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(c[4:], uint32(len(payload)))
+	c = append(c, payload...)
+	if len(payload)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	type TestCase struct {
+		name     string
+		data     []byte
+		expected []byte
+		err      bool
+	}
+
+	// VP8X 的 flag 有 ICC、EXIF 和 XMP，後面是 canvas 的大小
+	vp8x := []byte{0x20 | webpFlagEXIF | webpFlagXMP, 0, 0, 0, 9, 0, 0, 9, 0, 0}
+	stripped := []byte{0x20, 0, 0, 0, 9, 0, 0, 9, 0, 0}
+	iccp := chunk("ICCP", []byte("icc"))
+	image := chunk("VP8L", []byte("image data"))
+	exif := chunk("EXIF", []byte("Exif\x00\x00GPS"))
+	xmp := chunk("XMP ", []byte("<x:xmpmeta/>"))
+
+	testCases := []TestCase{
+		{
+			name:     "simple",
+			data:     riff(image),
+			expected: riff(image),
+		},
+		{
+			name:     "extended with metadata",
+			data:     riff(chunk("VP8X", vp8x), iccp, image, exif, xmp),
+			expected: riff(chunk("VP8X", stripped), iccp, image),
+		},
+		{
+			name: "not webp",
+			data: []byte("RIFF\x04\x00\x00\x00WAVE"),
+			err:  true,
+		},
+		{
+			name: "truncated chunk",
+			data: riff(image)[:20],
+			err:  true,
+		},
+		{
+			name: "chunk longer than file",
+			data: riff([]byte("VP8L\xff\x00\x00\x00")),
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		actual, err := StripWebPMetadata(tc.data)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: StripWebPMetadata() error = %v, expected error %v", tc.name, err, tc.err)
+			continue
+		}
+		if !tc.err && !bytes.Equal(actual, tc.expected) {
+			t.Errorf("%s: StripWebPMetadata() = %q, expected %q", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+// solidVP8L 會產生 w x h 的單色 VP8L (lossless) 影像，
+// 每個 prefix code 都只有一個 symbol，所以每個像素不需要任何 bit，整張圖都是同一個顏色。
+// 相關文件請參閱: https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+func solidVP8L(w, h int, r, g, b, a uint8) []byte {
+	var bits []bool
+	write := func(v uint32, n int) {
+		for i := 0; i < n; i++ {
+			bits = append(bits, v&(1<<i) != 0)
+		}
+	}
+
+	write(uint32(w-1), 14)
+	write(uint32(h-1), 14)
+	write(1, 1) // alpha_is_used
+	write(0, 3) // version
+	write(0, 1) // 沒有 transform
+	write(0, 1) // 沒有 color cache
+	write(0, 1) // 沒有 meta prefix code
+	// green、red、blue、alpha 以及 distance 的 prefix code
+	for _, symbol := range []uint8{g, r, b, a, 0} {
+		write(1, 1) // simple code
+		write(0, 1) // 一個 symbol
+		write(1, 1) // symbol 是 8 bit
+		write(uint32(symbol), 8)
+	}
+
+	payload := []byte{0x2f}
+	for i := 0; i < len(bits); i += 8 {
+		var v byte
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			if bits[i+j] {
+				v |= 1 << j
+			}
+		}
+		payload = append(payload, v)
+	}
+	return riff(chunk("VP8L", payload))
+}
+
+func TestIsAnimatedWebP(t *testing.T) {
+	type TestCase struct {
+		name     string
+		data     []byte
+		expected bool
+	}
+
+	canvas := []byte{0, 0, 0, 9, 0, 0, 9, 0, 0}
+	testCases := []TestCase{
+		{
+			name:     "simple",
+			data:     solidVP8L(2, 2, 0, 0, 0, 0xff),
+			expected: false,
+		},
+		{
+			name:     "extended without animation",
+			data:     riff(chunk("VP8X", append([]byte{0x20 | webpFlagEXIF}, canvas...)), chunk("VP8L", []byte("x"))),
+			expected: false,
+		},
+		{
+			name:     "animated",
+			data:     riff(chunk("VP8X", append([]byte{webpFlagAnimation}, canvas...)), chunk("ANIM", make([]byte, 6))),
+			expected: true,
+		},
+		{
+			name:     "truncated",
+			data:     []byte("RIFF\x00\x00\x00\x00WEBPVP8X"),
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		actual := IsAnimatedWebP(tc.data)
+		if actual != tc.expected {
+			t.Errorf("%s: IsAnimatedWebP() = %v, expected %v", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+func TestProcessWebP(t *testing.T) {
+	type TestCase struct {
+		name               string
+		data               []byte
+		maxDimension       int
+		mediaType          string
+		thumbnailMediaType string
+		width              int
+		height             int
+		err                bool
+	}
+
+	testCases := []TestCase{
+		{
+			// 沒有透明的話轉成 JPEG
+			name:               "opaque",
+			data:               solidVP8L(8, 4, 0xff, 0, 0, 0xff),
+			mediaType:          "image/jpeg",
+			thumbnailMediaType: "image/jpeg",
+			width:              8,
+			height:             4,
+		},
+		{
+			name:               "translucent",
+			data:               solidVP8L(8, 4, 0xff, 0, 0, 0x80),
+			mediaType:          "image/png",
+			thumbnailMediaType: "image/png",
+			width:              8,
+			height:             4,
+		},
+		{
+			name:               "resized",
+			data:               solidVP8L(8, 4, 0xff, 0, 0, 0xff),
+			maxDimension:       4,
+			mediaType:          "image/jpeg",
+			thumbnailMediaType: "image/jpeg",
+			width:              4,
+			height:             2,
+		},
+		{
+			name: "animated",
+			data: riff(chunk("VP8X", []byte{webpFlagAnimation, 0, 0, 0, 7, 0, 0, 3, 0, 0}), chunk("ANIM", make([]byte, 6))),
+			err:  true,
+		},
+		{
+			name: "invalid",
+			data: riff(chunk("VP8L", []byte("not an image"))),
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		result, err := Process(tc.data, "image/webp", tc.maxDimension)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: Process() error = %v, expected error %v", tc.name, err, tc.err)
+			continue
+		}
+		if tc.err {
+			continue
+		}
+		if result.MediaType != tc.mediaType || result.ThumbnailMediaType != tc.thumbnailMediaType {
+			t.Errorf("%s: Process() media type = %s, %s, expected %s, %s", tc.name, result.MediaType, result.ThumbnailMediaType, tc.mediaType, tc.thumbnailMediaType)
+		}
+		if result.Width != tc.width || result.Height != tc.height {
+			t.Errorf("%s: Process() size = %dx%d, expected %dx%d", tc.name, result.Width, result.Height, tc.width, tc.height)
+		}
+		if result.Blurhash == "" || len(result.Thumbnail) == 0 {
+			t.Errorf("%s: Process() has no thumbnail or blurhash", tc.name)
+		}
+
+		// 重新編碼的結果必須是宣稱的格式
+		_, format, err := image.DecodeConfig(bytes.NewReader(result.Data))
+		if err != nil || "image/"+format != tc.mediaType {
+			t.Errorf("%s: Process() data format = %s, %v, expected %s", tc.name, format, err, tc.mediaType)
+		}
+	}
+}
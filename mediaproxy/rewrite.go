@@ -0,0 +1,120 @@
+package mediaproxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+)
+
+// ProxyURL 會把其他站的網址換成透過本站 /media_proxy 取得的網址，
+// 本站的網址或是不是 http(s) 的網址會原封不動回傳。
+func ProxyURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return rawURL
+	}
+	if u.Host == config.GetDomain() {
+		return rawURL
+	}
+
+	q := url.Values{}
+	q.Set("url", rawURL)
+	q.Set("sig", sign(rawURL))
+	return "https://" + config.GetDomain() + "/media_proxy?" + q.Encode()
+}
+
+// sign 會用 login_jwt_secret 對網址產生 HMAC，只有本站產生的網址才能使用 proxy
+func sign(rawURL string) string {
+	mac := hmac.New(sha256.New, []byte("media_proxy:"+config.GetLoginJWTSecret()))
+	mac.Write([]byte(rawURL))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func verifySignature(rawURL string, sig string) bool {
+	return hmac.Equal([]byte(sign(rawURL)), []byte(sig))
+}
+
+// RewriteObject 會回傳 o 的複本，其中 attachment、icon 和 image 的網址都換成 ProxyURL，
+// 內嵌的 object (例如 Announce) 和 attributedTo 也會一起處理，o 本身不會被修改。
+func RewriteObject(o map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(o))
+	for k, v := range o {
+		m[k] = v
+	}
+
+	for _, field := range []string{"attachment", "icon", "image"} {
+		if v, ok := m[field]; ok {
+			m[field] = rewriteMedia(v)
+		}
+	}
+	for _, field := range []string{"object", "attributedTo"} {
+		if inner, ok := m[field].(map[string]interface{}); ok {
+			m[field] = RewriteObject(inner)
+		}
+	}
+	return m
+}
+
+// rewriteMedia 會處理 attachment 或 icon 這類的欄位，可能是網址、帶有 url 的物件或是陣列
+func rewriteMedia(v interface{}) interface{} {
+	switch f := v.(type) {
+	case string:
+		return ProxyURL(f)
+	case []interface{}:
+		list := make([]interface{}, 0, len(f))
+		for _, i := range f {
+			list = append(list, rewriteMedia(i))
+		}
+		return list
+	case []map[string]interface{}:
+		list := make([]interface{}, 0, len(f))
+		for _, i := range f {
+			list = append(list, rewriteMedia(i))
+		}
+		return list
+	case map[string]interface{}:
+		// 個人資料欄位沒有檔案
+		if f["type"] == "PropertyValue" {
+			return f
+		}
+		m := make(map[string]interface{}, len(f))
+		for k, val := range f {
+			m[k] = val
+		}
+		switch u := m["url"].(type) {
+		case string:
+			m["url"] = ProxyURL(u)
+		case map[string]interface{}, []interface{}:
+			m["url"] = rewriteLink(u)
+		}
+		return m
+	}
+	return v
+}
+
+// rewriteLink 會處理 url 欄位是 Link 物件 (或陣列) 的情況，網址放在 href 中
+func rewriteLink(v interface{}) interface{} {
+	switch l := v.(type) {
+	case []interface{}:
+		list := make([]interface{}, 0, len(l))
+		for _, i := range l {
+			list = append(list, rewriteLink(i))
+		}
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(l))
+		for k, val := range l {
+			m[k] = val
+		}
+		if href, ok := m["href"].(string); ok {
+			m["href"] = ProxyURL(href)
+		}
+		return m
+	case string:
+		return ProxyURL(l)
+	}
+	return v
+}
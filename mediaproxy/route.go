@@ -0,0 +1,190 @@
+package mediaproxy
+
+// mediaproxy 的用途是讓前端透過本站取得其他站的圖片和影片，
+// 這樣使用者的 IP 不會被其他站知道，對方的伺服器掛掉時也還能從快取中顯示。
+// 和 fetcher 不同的是，這邊只允許有本站簽章的網址，避免被當成任意網址的 proxy 使用。
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/mediacache"
+	"github.com/pichuchen/hatsuaki/netguard"
+)
+
+// client 只會連線到公開的 IP，避免透過 proxy 存取到內部網路的服務，
+// 所以這邊也不使用環境變數中的 HTTP proxy (不然檢查到的會是 proxy 的 IP)
+var client = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: netguard.RejectPrivateAddress,
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errors.New("unsupported scheme")
+		}
+		return nil
+	},
+}
+
+func Route(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		Get(w, r)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+// Get 會傳入參數 url 以及 ProxyURL 產生的 sig，回傳 url 的檔案內容，
+// 快取中有的話直接回傳快取，沒有的話向對方取得並放進快取。
+func Get(w http.ResponseWriter, r *http.Request) {
+	rawURL := r.URL.Query().Get("url")
+	if rawURL == "" || !verifySignature(rawURL, r.URL.Query().Get("sig")) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if e, ok := mediacache.Get(rawURL); ok {
+		f, err := os.Open(filepath.Join(config.GetMediaCacheDir(), e.File))
+		if err == nil {
+			defer f.Close()
+			serveCached(w, r, e, f)
+			return
+		}
+		// 檔案不見了 (例如被手動刪除) 的話重新取得
+		slog.Warn("mediaproxy.Get", "warn", "cached file missing", "url", rawURL, "error", err)
+		mediacache.Remove(rawURL)
+	}
+
+	e, err := fetch(rawURL)
+	if err != nil {
+		slog.Warn("mediaproxy.Get", "warn", "fetch failed", "url", rawURL, "error", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(config.GetMediaCacheDir(), e.File))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	serveCached(w, r, e, f)
+}
+
+func serveCached(w http.ResponseWriter, r *http.Request, e mediacache.Entry, f *os.File) {
+	w.Header().Set("Content-Type", e.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "public, max-age=604800")
+	modtime := time.Time{}
+	if info, err := f.Stat(); err == nil {
+		modtime = info.ModTime()
+	}
+	http.ServeContent(w, r, "", modtime, f)
+}
+
+// fetch 會向對方取得 rawURL 並寫進快取資料夾，只接受圖片、影片和聲音，
+// 大小超過 media_proxy_max_bytes 的話會放棄，寫入之後如果超過快取的空間上限會刪除最久沒用的檔案。
+func fetch(rawURL string) (mediacache.Entry, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return mediacache.Entry{}, err
+	}
+	req.Header.Set("Accept", "image/*, video/*, audio/*")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return mediacache.Entry{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return mediacache.Entry{}, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !isAllowedType(contentType) {
+		return mediacache.Entry{}, fmt.Errorf("content type not allowed: %s", resp.Header.Get("Content-Type"))
+	}
+	maxBytes := config.GetMediaProxyMaxBytes()
+	if resp.ContentLength > maxBytes {
+		return mediacache.Entry{}, errors.New("file too large")
+	}
+
+	dir := config.GetMediaCacheDir()
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return mediacache.Entry{}, err
+	}
+
+	// 先寫到暫存檔，確定完整之後才換成正式的檔名
+	sum := sha256.Sum256([]byte(rawURL))
+	file := hex.EncodeToString(sum[:])
+	tmp, err := os.CreateTemp(dir, file+".*.tmp")
+	if err != nil {
+		return mediacache.Entry{}, err
+	}
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, maxBytes+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size > maxBytes {
+		err = errors.New("file too large")
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, file))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return mediacache.Entry{}, err
+	}
+
+	e := mediacache.Entry{
+		URL:         rawURL,
+		File:        file,
+		ContentType: contentType,
+		Size:        size,
+	}
+	mediacache.Put(e)
+	for _, evicted := range mediacache.Evict(config.GetMediaCacheMaxBytes(), rawURL) {
+		os.Remove(filepath.Join(dir, evicted.File))
+	}
+
+	err = mediacache.SaveMediaCache("./media_cache.json")
+	if err != nil {
+		slog.Warn("mediaproxy.fetch", "error", "media cache save error", "err", err)
+	}
+	return e, nil
+}
+
+// isAllowedType 只允許圖片、影片和聲音，SVG 可以包含 script 所以不允許
+func isAllowedType(contentType string) bool {
+	if contentType == "image/svg+xml" {
+		return false
+	}
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "audio/")
+}
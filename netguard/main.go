@@ -0,0 +1,69 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// netguard 是向使用者指定的位址連線時使用的檢查，
+// media proxy 的網址、提及的 domain 這類由外部決定的位址，都不能讓它連到本站的內部網路。
+// 用法是設定為 net.Dialer 的 Control，這樣連線前 (包含 redirect 和 DNS 解析之後) 都會檢查實際的 IP。
+
+// deniedPrefixes 是不允許連線的位址範圍，
+// 除了 loopback、私有網路、link-local 和 multicast 之外，也包含 CGNAT、NAT64 這類可能通到內部網路的範圍。
+// 相關文件請參閱: https://www.iana.org/assignments/iana-ipv4-special-registry/
+// 以及 https://www.iana.org/assignments/iana-ipv6-special-registry/
+var deniedPrefixes = []netip.Prefix{
+	// IPv4
+	netip.MustParsePrefix("0.0.0.0/8"),      // this network
+	netip.MustParsePrefix("10.0.0.0/8"),     // private
+	netip.MustParsePrefix("100.64.0.0/10"),  // shared address space (CGNAT)
+	netip.MustParsePrefix("127.0.0.0/8"),    // loopback
+	netip.MustParsePrefix("169.254.0.0/16"), // link-local (包含雲端的 metadata 服務)
+	netip.MustParsePrefix("172.16.0.0/12"),  // private
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("192.168.0.0/16"), // private
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("224.0.0.0/4"),    // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved (包含 broadcast)
+
+	// IPv6
+	netip.MustParsePrefix("::/128"),         // unspecified
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("fc00::/7"),       // unique local
+	netip.MustParsePrefix("fe80::/10"),      // link-local
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+}
+
+// RejectPrivateAddress 會在連線之前檢查 IP，拒絕 deniedPrefixes 中的位址
+func RejectPrivateAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return errors.New("invalid ip: " + host)
+	}
+	if IsDeniedAddr(ip) {
+		return errors.New("address not allowed: " + host)
+	}
+	return nil
+}
+
+// IsDeniedAddr 會回傳 ip 是否在不允許連線的範圍中，
+// IPv4-mapped 的 IPv6 位址 (::ffff:127.0.0.1) 會以 IPv4 的規則判斷。
+func IsDeniedAddr(ip netip.Addr) bool {
+	// 帶有 zone 的位址 (fe80::1%eth0) 不會被 Prefix.Contains 包含，所以要先拿掉
+	ip = ip.WithZone("").Unmap()
+	for _, p := range deniedPrefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package netguard
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsDeniedAddr(t *testing.T) {
+	type TestCase struct {
+		ip       string
+		expected bool
+	}
+
+	testCases := []TestCase{
+		// 公開的位址
+		{"93.184.215.14", false},
+		{"8.8.8.8", false},
+		{"100.63.255.255", false},
+		{"100.128.0.0", false},
+		{"198.20.0.1", false},
+		{"2606:4700::1111", false},
+		{"64:ff9c::1", false},
+
+		// IPv4
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"10.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"127.0.0.1", true},
+		{"127.255.255.254", true},
+		{"169.254.169.254", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.0.0.8", true},
+		{"192.168.1.1", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"224.0.0.1", true},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+
+		// IPv6
+		{"::", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:8.8.8.8", false},
+		{"64:ff9b::7f00:1", true},
+		{"64:ff9b::808:808", true},
+		{"fc00::1", true},
+		{"fd12:3456::1", true},
+		{"fe80::1", true},
+		{"fe80::1%eth0", true},
+		{"ff02::1", true},
+	}
+
+	for _, tc := range testCases {
+		actual := IsDeniedAddr(netip.MustParseAddr(tc.ip))
+		if actual != tc.expected {
+			t.Errorf("IsDeniedAddr(%s) = %v, expected %v", tc.ip, actual, tc.expected)
+		}
+	}
+}
+
+func TestRejectPrivateAddress(t *testing.T) {
+	type TestCase struct {
+		address string
+		isErr   bool
+	}
+
+	testCases := []TestCase{
+		{"93.184.215.14:443", false},
+		{"[2606:4700::1111]:443", false},
+		{"127.0.0.1:443", true},
+		{"[::1]:443", true},
+		{"[::ffff:169.254.169.254]:80", true},
+		// Control 收到的一定是 IP，不會是 hostname
+		{"localhost:443", true},
+		{"127.0.0.1", true},
+	}
+
+	for _, tc := range testCases {
+		err := RejectPrivateAddress("tcp", tc.address, nil)
+		if (err != nil) != tc.isErr {
+			t.Errorf("RejectPrivateAddress(%q) error = %v, expected error %v", tc.address, err, tc.isErr)
+		}
+	}
+}
@@ -8,9 +8,18 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/pichuchen/hatsuaki/activitypub"
+	"github.com/pichuchen/hatsuaki/api/auth"
 	"github.com/pichuchen/hatsuaki/datastore/actor"
 	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/datastore/delivery"
+	"github.com/pichuchen/hatsuaki/datastore/media"
+	"github.com/pichuchen/hatsuaki/datastore/mediacache"
 	"github.com/pichuchen/hatsuaki/datastore/object"
+	"github.com/pichuchen/hatsuaki/datastore/remoteactor"
+	"github.com/pichuchen/hatsuaki/datastore/remoteobject"
+	"github.com/pichuchen/hatsuaki/datastore/reply"
+	"github.com/pichuchen/hatsuaki/datastore/tag"
 )
 
 var (
@@ -103,6 +112,88 @@ func main() {
 		slog.Error("main", "error", err)
 	}
 
+	err = delivery.LoadDelivery("./delivery.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "delivery", "delivery.json not found, creating a new one")
+		err = delivery.SaveDelivery("./delivery.json")
+		if err != nil {
+			slog.Error("main", "error", err)
+		}
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+
+	err = remoteactor.LoadRemoteActor("./remote_actor.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "remote_actor", "remote_actor.json not found, creating a new one")
+		err = remoteactor.SaveRemoteActor("./remote_actor.json")
+		if err != nil {
+			slog.Error("main", "error", err)
+		}
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+
+	err = remoteobject.LoadRemoteObject("./remote_object.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "remote_object", "remote_object.json not found, creating a new one")
+		err = remoteobject.SaveRemoteObject("./remote_object.json")
+		if err != nil {
+			slog.Error("main", "error", err)
+		}
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+	// 舊版存下來的 object 可能還沒有清理過 HTML
+	activitypub.SanitizeRemoteObjects()
+
+	err = media.LoadMedia("./media.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "media", "media.json not found, creating a new one")
+		err = media.SaveMedia("./media.json")
+		if err != nil {
+			slog.Error("main", "error", err)
+		}
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+
+	err = mediacache.LoadMediaCache("./media_cache.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "media_cache", "media_cache.json not found, creating a new one")
+		err = mediacache.SaveMediaCache("./media_cache.json")
+		if err != nil {
+			slog.Error("main", "error", err)
+		}
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+
+	err = tag.LoadTag("./tag.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "tag", "tag.json not found, creating a new one")
+		err = tag.SaveTag("./tag.json")
+		if err != nil {
+			slog.Error("main", "error", err)
+		}
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+
+	err = reply.LoadReply("./reply.json")
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("main", "reply", "reply.json not found, rebuilding from objects")
+		activitypub.RebuildReplyIndex()
+	} else if err != nil {
+		slog.Error("main", "error", err)
+	}
+
+	// 讀取 inbox 或是不公開的 object 時，本站的使用者使用和 API 相同的 token
+	activitypub.SetLocalUserVerifier(auth.VerifyRequest)
+
+	// 在背景送出佇列中的 activity，包含上次關閉前還沒送完的部分
+	activitypub.StartDeliveryWorker()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		XForwardedFor := r.Header.Get("X-Forwarded-For")
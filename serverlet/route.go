@@ -6,6 +6,7 @@ import (
 	"github.com/pichuchen/hatsuaki/activitypub"
 	"github.com/pichuchen/hatsuaki/api"
 	"github.com/pichuchen/hatsuaki/fetcher"
+	"github.com/pichuchen/hatsuaki/mediaproxy"
 	"github.com/pichuchen/hatsuaki/web"
 	"github.com/pichuchen/hatsuaki/webfinger"
 )
@@ -17,6 +18,12 @@ func Route(mux *http.ServeMux) *http.ServeMux {
 	// 在 .activitypub 裡面實作的主要是處理 activitypub 的請求
 	mux.HandleFunc("/.activitypub/", activitypub.Route)
 
+	// hashtag 的頁面，依照 Accept 回傳 ActivityPub 的 OrderedCollection 或是給前端使用的 JSON
+	mux.HandleFunc("GET /tags/{name}", activitypub.RouteTag)
+
+	// 使用者上傳的檔案
+	mux.HandleFunc("GET /media/{file}", api.RouteMediaFile)
+
 	// 在 web 裡面實作的主要是處理網頁的請求
 	mux.HandleFunc("/", web.Route)
 
@@ -25,6 +32,9 @@ func Route(mux *http.ServeMux) *http.ServeMux {
 	mux.HandleFunc("/1/", api.Route)
 
 	mux.HandleFunc("/fetcher", fetcher.Route)
+
+	// 其他站的圖片和影片透過本站取得並快取，網址由 mediaproxy.ProxyURL 產生
+	mux.HandleFunc("/media_proxy", mediaproxy.Route)
 	// mux.HandleFunc("/world", world)
 
 	return mux
@@ -0,0 +1,145 @@
+package webfinger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pichuchen/hatsuaki/datastore/actor"
+	"github.com/pichuchen/hatsuaki/datastore/config"
+	"github.com/pichuchen/hatsuaki/netguard"
+)
+
+// client 是向其他伺服器查詢 WebFinger 時使用的 HTTP client，
+// 提及的 domain 是由使用者輸入的，所以和 media proxy 一樣拒絕連到內部網路的位址。
+var client = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: netguard.RejectPrivateAddress,
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "https" {
+			return errors.New("unsupported scheme")
+		}
+		return nil
+	},
+}
+
+// Resolve 會把 @alice@example.com、alice@example.com 或是 @alice 這樣的 handle 解析成 actor 的 ID，
+// 沒有 domain 或是 domain 為本站的話會直接在本站中查詢，其他的則會透過 WebFinger 向對方伺服器查詢。
+// 如果傳入的已經是 https:// 開頭的網址，則直接回傳，本站的網址則會確認 actor 存在。
+func Resolve(handle string) (string, error) {
+	if strings.HasPrefix(handle, "https://") {
+		if strings.HasPrefix(handle, "https://"+config.GetDomain()+"/") {
+			a, err := actor.FindActorByFullID(handle)
+			if err != nil {
+				return "", err
+			}
+			return a.GetFullID(), nil
+		}
+		return handle, nil
+	}
+
+	username, domain, err := SplitHandle(handle)
+	if err != nil {
+		return "", err
+	}
+
+	if domain == "" || strings.EqualFold(domain, config.GetDomain()) {
+		a, err := actor.FindActorByUsername(username)
+		if err != nil {
+			return "", err
+		}
+		return a.GetFullID(), nil
+	}
+
+	return lookup(username, domain)
+}
+
+// SplitHandle 會把 @alice@example.com 拆成 alice 和 example.com，沒有 domain 的話 domain 會是空字串
+func SplitHandle(handle string) (string, string, error) {
+	handle = strings.TrimPrefix(strings.TrimPrefix(handle, "acct:"), "@")
+	parts := strings.Split(handle, "@")
+	if len(parts) > 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid handle: %s", handle)
+	}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	if parts[1] == "" {
+		return "", "", fmt.Errorf("invalid handle: %s", handle)
+	}
+	return parts[0], parts[1], nil
+}
+
+// lookup 會向 domain 的 WebFinger 查詢 username 的 actor ID
+func lookup(username string, domain string) (string, error) {
+	q := url.Values{}
+	q.Set("resource", "acct:"+username+"@"+domain)
+	reqURL := "https://" + domain + "/.well-known/webfinger?" + q.Encode()
+
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("webfinger.lookup", "error", err, "resource", q.Get("resource"))
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	m := struct {
+		Links []map[string]interface{} `json:"links"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&m)
+	if err != nil {
+		slog.Warn("webfinger.lookup", "error", err, "resource", q.Get("resource"))
+		return "", err
+	}
+
+	return findSelfLink(m.Links)
+}
+
+// findSelfLink 會從 WebFinger 的 links 中找出 rel=self 的 actor 連結，
+// type 可能是 activity+json 或是 ld+json，href 必須是 https 的網址。
+func findSelfLink(links []map[string]interface{}) (string, error) {
+	for _, link := range links {
+		rel, _ := link["rel"].(string)
+		linkType, _ := link["type"].(string)
+		href, _ := link["href"].(string)
+		if rel != "self" {
+			continue
+		}
+		if !strings.HasPrefix(linkType, "application/activity+json") && !strings.HasPrefix(linkType, "application/ld+json") {
+			continue
+		}
+		// href 是對方伺服器決定的，不是 https 的網址 (例如 javascript: 或是沒有 host) 就不使用
+		u, err := url.Parse(href)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			slog.Warn("webfinger.findSelfLink", "error", "invalid href", "href", href)
+			continue
+		}
+		return href, nil
+	}
+
+	return "", errors.New("actor link not found")
+}
@@ -0,0 +1,116 @@
+package webfinger
+
+import (
+	"testing"
+)
+
+func TestFindSelfLink(t *testing.T) {
+	type TestCase struct {
+		name     string
+		links    []map[string]interface{}
+		expected string
+		isErr    bool
+	}
+
+	link := func(rel, linkType, href string) map[string]interface{} {
+		return map[string]interface{}{"rel": rel, "type": linkType, "href": href}
+	}
+	const actorID = "https://remote.example/users/bob"
+
+	testCases := []TestCase{
+		{
+			name:     "activity+json",
+			links:    []map[string]interface{}{link("self", "application/activity+json", actorID)},
+			expected: actorID,
+		},
+		{
+			name:     "ld+json with profile",
+			links:    []map[string]interface{}{link("self", `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, actorID)},
+			expected: actorID,
+		},
+		{
+			name: "profile page before self",
+			links: []map[string]interface{}{
+				link("http://webfinger.net/rel/profile-page", "text/html", "https://remote.example/@bob"),
+				link("self", "application/activity+json", actorID),
+			},
+			expected: actorID,
+		},
+		{
+			name:  "self with html type",
+			links: []map[string]interface{}{link("self", "text/html", actorID)},
+			isErr: true,
+		},
+		{
+			name:  "http href",
+			links: []map[string]interface{}{link("self", "application/activity+json", "http://remote.example/users/bob")},
+			isErr: true,
+		},
+		{
+			name:  "javascript href",
+			links: []map[string]interface{}{link("self", "application/activity+json", "javascript:alert(1)")},
+			isErr: true,
+		},
+		{
+			name:  "href without host",
+			links: []map[string]interface{}{link("self", "application/activity+json", "https:///users/bob")},
+			isErr: true,
+		},
+		{
+			name:  "relative href",
+			links: []map[string]interface{}{link("self", "application/activity+json", "/users/bob")},
+			isErr: true,
+		},
+		{
+			name:  "empty href",
+			links: []map[string]interface{}{link("self", "application/activity+json", "")},
+			isErr: true,
+		},
+		{
+			name: "invalid href before valid",
+			links: []map[string]interface{}{
+				link("self", "application/activity+json", "http://remote.example/users/bob"),
+				link("self", "application/activity+json", actorID),
+			},
+			expected: actorID,
+		},
+		{
+			name:  "no links",
+			links: []map[string]interface{}{},
+			isErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		actual, err := findSelfLink(tc.links)
+		if (err != nil) != tc.isErr || actual != tc.expected {
+			t.Errorf("%s: findSelfLink() = %q, %v, expected %q, error %v", tc.name, actual, err, tc.expected, tc.isErr)
+		}
+	}
+}
+
+func TestSplitHandle(t *testing.T) {
+	type TestCase struct {
+		handle   string
+		username string
+		domain   string
+		isErr    bool
+	}
+
+	testCases := []TestCase{
+		{handle: "@alice@example.com", username: "alice", domain: "example.com"},
+		{handle: "alice@example.com", username: "alice", domain: "example.com"},
+		{handle: "acct:alice@example.com", username: "alice", domain: "example.com"},
+		{handle: "@alice", username: "alice"},
+		{handle: "@alice@", isErr: true},
+		{handle: "@", isErr: true},
+		{handle: "@alice@example.com@evil.example", isErr: true},
+	}
+
+	for _, tc := range testCases {
+		username, domain, err := SplitHandle(tc.handle)
+		if (err != nil) != tc.isErr || username != tc.username || domain != tc.domain {
+			t.Errorf("SplitHandle(%q) = %q, %q, %v, expected %q, %q, error %v", tc.handle, username, domain, err, tc.username, tc.domain, tc.isErr)
+		}
+	}
+}